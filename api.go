@@ -163,6 +163,7 @@ func (c *SQSExtended) ChangeMessageVisibilityRequest(input *ChangeMessageVisibil
 	output = &ChangeMessageVisibilityOutput{}
 	req = c.newRequest(op, input, output)
 	req.Handlers.Unmarshal.Swap(query.UnmarshalHandler.Name, protocol.UnmarshalDiscardBodyHandler)
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.ChangeMessageVisibility", Fn: c.changeMessageVisibilityHandler})
 	return
 }
 
@@ -221,6 +222,9 @@ func (c *SQSExtended) ChangeMessageVisibilityRequest(input *ChangeMessageVisibil
 // (not to the value you set using the ChangeMessageVisibility action) the next
 // time the message is received.
 //
+// Receipt handles of offloaded messages, which embed the location of the
+// payload, are accepted and restored to the handle issued by SQS.
+//
 // Returns awserr.Error for service API and SDK errors. Use runtime type assertions
 // with awserr.Error's Code and Message methods to get detailed information about
 // the error.
@@ -296,6 +300,7 @@ func (c *SQSExtended) ChangeMessageVisibilityBatchRequest(input *ChangeMessageVi
 
 	output = &ChangeMessageVisibilityBatchOutput{}
 	req = c.newRequest(op, input, output)
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.ChangeMessageVisibilityBatch", Fn: c.changeMessageVisibilityBatchHandler})
 	return
 }
 
@@ -318,6 +323,10 @@ func (c *SQSExtended) ChangeMessageVisibilityBatchRequest(input *ChangeMessageVi
 //
 // &Attribute.2=second
 //
+// Receipt handles of offloaded messages are accepted as in ChangeMessageVisibility.
+// Entry Ids are sent unchanged, so the Successful and Failed entries of the
+// output refer to the entries of the input.
+//
 // Returns awserr.Error for service API and SDK errors. Use runtime type assertions
 // with awserr.Error's Code and Message methods to get detailed information about
 // the error.
@@ -526,6 +535,7 @@ func (c *SQSExtended) DeleteMessageRequest(input *DeleteMessageInput) (req *requ
 	output = &DeleteMessageOutput{}
 	req = c.newRequest(op, input, output)
 	req.Handlers.Unmarshal.Swap(query.UnmarshalHandler.Name, protocol.UnmarshalDiscardBodyHandler)
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.DeleteMessage", Fn: c.deleteMessageHandler})
 	return
 }
 
@@ -552,6 +562,11 @@ func (c *SQSExtended) DeleteMessageRequest(input *DeleteMessageInput) (req *requ
 // is idempotent, so that receiving a message more than once does not cause
 // issues.
 //
+// If the receipt handle refers to a message whose payload was offloaded, the
+// payload is deleted from the payload store after the message is deleted from
+// the queue.
+// An awserr.Error with code ErrCodeDeletePayload is returned if that fails.
+//
 // Returns awserr.Error for service API and SDK errors. Use runtime type assertions
 // with awserr.Error's Code and Message methods to get detailed information about
 // the error.
@@ -627,6 +642,7 @@ func (c *SQSExtended) DeleteMessageBatchRequest(input *DeleteMessageBatchInput)
 
 	output = &DeleteMessageBatchOutput{}
 	req = c.newRequest(op, input, output)
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.DeleteMessageBatch", Fn: c.deleteMessageBatchHandler})
 	return
 }
 
@@ -648,6 +664,10 @@ func (c *SQSExtended) DeleteMessageBatchRequest(input *DeleteMessageBatchInput)
 //
 // &Attribute.2=second
 //
+// The offloaded payloads of successfully deleted messages are deleted as
+// well. If any of them cannot be deleted, the output is still returned along
+// with an awserr.BatchedErrors with code ErrCodeDeletePayload.
+//
 // Returns awserr.Error for service API and SDK errors. Use runtime type assertions
 // with awserr.Error's Code and Message methods to get detailed information about
 // the error.
@@ -1337,6 +1357,8 @@ func (c *SQSExtended) ReceiveMessageRequest(input *ReceiveMessageInput) (req *re
 
 	output = &ReceiveMessageOutput{}
 	req = c.newRequest(op, input, output)
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.ReceivePayloadAttribute", Fn: c.receivePayloadAttributeHandler})
+	req.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{Name: "sqsextended.ResolvePayloads", Fn: c.resolvePayloadsHandler})
 	return
 }
 
@@ -1390,6 +1412,28 @@ func (c *SQSExtended) ReceiveMessageRequest(input *ReceiveMessageInput) (req *re
 // this action, we recommend that you structure your code so that it can handle
 // new attributes gracefully.
 //
+// Messages whose payload was offloaded are returned with the original body,
+// and without the ReservedAttributeName message attribute. Messages sent by
+// the Java Amazon SQS Extended Client Library, including ones marked with
+// LegacyReservedAttributeName, are resolved the same way. Encrypted messages
+// are decrypted, and compressed messages are decompressed. The receipt
+// handles of offloaded messages embed the location of the payload between
+// S3BucketNameMarker and S3KeyMaker, so that DeleteMessage can remove it as
+// well. Retrieved payloads are checked against the SHA-256 digest recorded in
+// the data type of the ReservedAttributeName message attribute, if any.
+//
+// If a payload cannot be retrieved, does not match its digest, or cannot be
+// decrypted or decompressed, the message is omitted from the output and an
+// awserr.BatchedErrors with code ErrCodeRetrievePayload is returned, holding
+// a *MessagePayloadError for each such message. A digest mismatch is reported
+// as a *PayloadDigestError in the MessagePayloadError. The output still
+// contains the messages that were resolved.
+//
+// Unless aws.Config.DisableComputeChecksums is set, the MD5 digests SQS returns
+// for the body and attributes of each message are verified against the
+// message as received, before payloads are resolved. A mismatch is returned as
+// an awserr.Error with code ErrCodeInvalidChecksum.
+//
 // Returns awserr.Error for service API and SDK errors. Use runtime type assertions
 // with awserr.Error's Code and Message methods to get detailed information about
 // the error.
@@ -1551,6 +1595,10 @@ func (c *SQSExtended) SendMessageRequest(input *SendMessageInput) (req *request.
 
 	output = &SendMessageOutput{}
 	req = c.newRequest(op, input, output)
+	req.Handlers.Validate.PushBackNamed(request.NamedHandler{Name: "sqsextended.ValidateSendMessage", Fn: c.validateSendMessageHandler})
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.OffloadSendMessage", Fn: c.offloadSendMessageHandler})
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.EncryptSendMessage", Fn: c.encryptSendMessageHandler})
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.CompressSendMessage", Fn: c.compressSendMessageHandler})
 	return
 }
 
@@ -1566,6 +1614,32 @@ func (c *SQSExtended) SendMessageRequest(input *SendMessageInput) (req *request.
 // Any characters not included in this list will be rejected. For more information,
 // see the W3C specification for characters (http://www.w3.org/TR/REC-xml/#charsets).
 //
+// If large payload support is enabled and the size of the message body and
+// attributes exceeds the message size threshold, or AlwaysThroughS3 is set in
+// the ExtendedClientConfiguration, the body is put in the payload store, S3 by
+// default, and a pointer to it is sent in its place, in the format of the
+// Java Amazon SQS Extended Client Library. The size of the original body is
+// recorded in the ReservedAttributeName message attribute, whose custom data
+// type carries the SHA-256 digest of the body, e.g. "Number.sha256-9f86d0...".
+// Messages may therefore not use ReservedAttributeName themselves, and carry at
+// most MaxAllowedAttributes attributes while large payload support is enabled.
+//
+// If a Codec is configured, the body is compressed before the size is
+// evaluated, and the codec is recorded in the CompressionAttributeName
+// message attribute, which takes up another attribute.
+//
+// If a KeyProvider is configured, the body is then encrypted with AES-256-GCM
+// under a new data key, which is sent wrapped by the key provider in the
+// EncryptionAttributeName message attribute. This takes up another attribute,
+// and the size of the message is evaluated after encryption. If a data key
+// cannot be generated, an awserr.Error with code ErrCodeEncryptPayload is
+// returned.
+//
+// Unless aws.Config.DisableComputeChecksums is set, the MD5 digests SQS returns
+// are verified against the message as sent, including any pointer or encoded
+// body. A mismatch is returned as an awserr.Error with code
+// ErrCodeInvalidChecksum.
+//
 // Returns awserr.Error for service API and SDK errors. Use runtime type assertions
 // with awserr.Error's Code and Message methods to get detailed information about
 // the error.
@@ -1641,6 +1715,10 @@ func (c *SQSExtended) SendMessageBatchRequest(input *SendMessageBatchInput) (req
 
 	output = &SendMessageBatchOutput{}
 	req = c.newRequest(op, input, output)
+	req.Handlers.Validate.PushBackNamed(request.NamedHandler{Name: "sqsextended.ValidateSendMessageBatch", Fn: c.validateSendMessageBatchHandler})
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.OffloadSendMessageBatch", Fn: c.offloadSendMessageBatchHandler})
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.EncryptSendMessageBatch", Fn: c.encryptSendMessageBatchHandler})
+	req.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "sqsextended.CompressSendMessageBatch", Fn: c.compressSendMessageBatchHandler})
 	return
 }
 
@@ -1678,6 +1756,14 @@ func (c *SQSExtended) SendMessageBatchRequest(input *SendMessageBatchInput) (req
 //
 // &Attribute.2=second
 //
+// If large payload support is enabled, each entry whose body and attributes
+// exceed the message size threshold is offloaded as in SendMessage, or
+// every entry if AlwaysThroughS3 is set. If the batch as a whole is still too
+// large, the largest remaining entries are offloaded as well. Payloads of
+// entries that end up in the Failed list of the output are deleted from the
+// payload store again. Entries are compressed and encrypted as in
+// SendMessage, and their attributes are subject to the same restrictions.
+//
 // Returns awserr.Error for service API and SDK errors. Use runtime type assertions
 // with awserr.Error's Code and Message methods to get detailed information about
 // the error.
@@ -4250,6 +4336,7 @@ func (s *SendMessageBatchRequestEntry) Validate() error {
 			}
 		}
 	}
+	validateMessageAttributes(&invalidParams, s.MessageAttributes, maxMessageAttributes)
 	if s.MessageSystemAttributes != nil {
 		for i, v := range s.MessageSystemAttributes {
 			if v == nil {
@@ -4549,6 +4636,7 @@ func (s *SendMessageInput) Validate() error {
 			}
 		}
 	}
+	validateMessageAttributes(&invalidParams, s.MessageAttributes, maxMessageAttributes)
 	if s.MessageSystemAttributes != nil {
 		for i, v := range s.MessageSystemAttributes {
 			if v == nil {
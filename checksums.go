@@ -0,0 +1,253 @@
+package sqsextendedclient
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// ErrCodeInvalidChecksum is the error code returned when the MD5 digest of a
+// message body or its attributes, as reported by SQS, does not match the
+// message that was sent or received.
+const ErrCodeInvalidChecksum = "InvalidChecksum"
+
+var (
+	errChecksumMissingBody = fmt.Errorf("cannot compute checksum. missing body")
+	errChecksumMissingMD5  = fmt.Errorf("cannot verify checksum. missing response MD5")
+)
+
+// Transport type indexes SQS hashes in front of attribute values.
+const (
+	stringTypeFieldIndex     byte = 1
+	binaryTypeFieldIndex     byte = 2
+	stringListTypeFieldIndex byte = 3
+	binaryListTypeFieldIndex byte = 4
+)
+
+// setupChecksumValidation adds the handlers that verify the MD5 digests SQS
+// returns for sent and received messages, unless checksums are disabled with
+// aws.Config.DisableComputeChecksums.
+//
+// The handlers run before the extended client's own Unmarshal handlers, so
+// that the digests are checked against the messages as they were sent to and
+// received from SQS: for offloaded messages the pointer body, and for
+// compressed or encrypted messages the encoded body.
+func setupChecksumValidation(r *request.Request) {
+	if aws.BoolValue(r.Config.DisableComputeChecksums) {
+		return
+	}
+
+	switch r.Operation.Name {
+	case opSendMessage:
+		r.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{Name: "sqsextended.VerifySendMessage", Fn: verifySendMessage})
+	case opSendMessageBatch:
+		r.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{Name: "sqsextended.VerifySendMessageBatch", Fn: verifySendMessageBatch})
+	case opReceiveMessage:
+		r.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{Name: "sqsextended.VerifyReceiveMessage", Fn: verifyReceiveMessage})
+	}
+}
+
+// verifySendMessage checks the digests of a SendMessage response against the
+// sent message.
+func verifySendMessage(r *request.Request) {
+	if r.Error != nil || !r.DataFilled() || !r.ParamsFilled() {
+		return
+	}
+	in := r.Params.(*SendMessageInput)
+	out := r.Data.(*SendMessageOutput)
+
+	if err := checksumsMatch(in.MessageBody, out.MD5OfMessageBody); err != nil {
+		setChecksumError(r, err.Error())
+		return
+	}
+	if err := attributesChecksumMatch(in.MessageAttributes, out.MD5OfMessageAttributes); err != nil {
+		setChecksumError(r, err.Error())
+	}
+}
+
+// verifySendMessageBatch checks the digests of each successful entry of a
+// SendMessageBatch response against the sent entry.
+func verifySendMessageBatch(r *request.Request) {
+	if r.Error != nil || !r.DataFilled() || !r.ParamsFilled() {
+		return
+	}
+	entries := map[string]*SendMessageBatchResultEntry{}
+	ids := []string{}
+
+	out := r.Data.(*SendMessageBatchOutput)
+	for _, entry := range out.Successful {
+		entries[aws.StringValue(entry.Id)] = entry
+	}
+
+	in := r.Params.(*SendMessageBatchInput)
+	for _, entry := range in.Entries {
+		e, ok := entries[aws.StringValue(entry.Id)]
+		if !ok {
+			continue
+		}
+		if checksumsMatch(entry.MessageBody, e.MD5OfMessageBody) != nil ||
+			attributesChecksumMatch(entry.MessageAttributes, e.MD5OfMessageAttributes) != nil ||
+			systemAttributesChecksumMatch(entry.MessageSystemAttributes, e.MD5OfMessageSystemAttributes) != nil {
+			ids = append(ids, aws.StringValue(e.MessageId))
+		}
+	}
+	if len(ids) > 0 {
+		setChecksumError(r, "invalid messages: %s", strings.Join(ids, ", "))
+	}
+}
+
+// verifyReceiveMessage checks the digests of each received message.
+func verifyReceiveMessage(r *request.Request) {
+	if r.Error != nil || !r.DataFilled() || !r.ParamsFilled() {
+		return
+	}
+	ids := []string{}
+	out := r.Data.(*ReceiveMessageOutput)
+	for i, msg := range out.Messages {
+		err := checksumsMatch(msg.Body, msg.MD5OfBody)
+		if err == nil {
+			err = attributesChecksumMatch(msg.MessageAttributes, msg.MD5OfMessageAttributes)
+		}
+		if err == nil {
+			continue
+		}
+		if msg.MessageId == nil {
+			if r.Config.Logger != nil {
+				r.Config.Logger.Log(fmt.Sprintf(
+					"WARN: SQSExtended.ReceiveMessage failed checksum request id: %s, message %d has no message ID.",
+					r.RequestID, i,
+				))
+			}
+			continue
+		}
+		ids = append(ids, *msg.MessageId)
+	}
+	if len(ids) > 0 {
+		setChecksumError(r, "invalid messages: %s", strings.Join(ids, ", "))
+	}
+}
+
+// checksumsMatch compares the MD5 digest of body with expectedMD5.
+func checksumsMatch(body, expectedMD5 *string) error {
+	if body == nil {
+		return errChecksumMissingBody
+	} else if expectedMD5 == nil {
+		return errChecksumMissingMD5
+	}
+
+	msum := md5.Sum([]byte(*body))
+	return compareChecksum(hex.EncodeToString(msum[:]), *expectedMD5)
+}
+
+// attributesChecksumMatch compares the MD5 digest of attrs with expectedMD5.
+// SQS returns no digest for a message without attributes.
+func attributesChecksumMatch(attrs map[string]*MessageAttributeValue, expectedMD5 *string) error {
+	if len(attrs) == 0 {
+		return nil
+	} else if expectedMD5 == nil {
+		return errChecksumMissingMD5
+	}
+	return compareChecksum(md5OfMessageAttributes(attrs), *expectedMD5)
+}
+
+// systemAttributesChecksumMatch is the message system attribute equivalent
+// of attributesChecksumMatch.
+func systemAttributesChecksumMatch(attrs map[string]*MessageSystemAttributeValue, expectedMD5 *string) error {
+	if len(attrs) == 0 {
+		return nil
+	} else if expectedMD5 == nil {
+		return errChecksumMissingMD5
+	}
+	return compareChecksum(md5OfMessageSystemAttributes(attrs), *expectedMD5)
+}
+
+// md5OfMessageAttributes returns the hex encoded MD5 digest SQS computes for
+// attrs. Attributes are hashed in order of their names.
+func md5OfMessageAttributes(attrs map[string]*MessageAttributeValue) string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := md5.New()
+	for _, name := range names {
+		v := attrs[name]
+		hashAttribute(h, name, v.DataType, v.StringValue, v.BinaryValue, v.StringListValues, v.BinaryListValues)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// md5OfMessageSystemAttributes is the message system attribute equivalent of
+// md5OfMessageAttributes.
+func md5OfMessageSystemAttributes(attrs map[string]*MessageSystemAttributeValue) string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := md5.New()
+	for _, name := range names {
+		v := attrs[name]
+		hashAttribute(h, name, v.DataType, v.StringValue, v.BinaryValue, v.StringListValues, v.BinaryListValues)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashAttribute adds an attribute to h the way SQS does: the name, data type
+// and value, each prefixed with its length as a 4 byte big-endian integer,
+// with a byte identifying the transport type before the value.
+func hashAttribute(h hash.Hash, name string, dataType, stringValue *string, binaryValue []byte, stringListValues []*string, binaryListValues [][]byte) {
+	hashLengthAndBytes(h, []byte(name))
+	hashLengthAndBytes(h, []byte(aws.StringValue(dataType)))
+
+	switch {
+	case stringValue != nil:
+		h.Write([]byte{stringTypeFieldIndex})
+		hashLengthAndBytes(h, []byte(*stringValue))
+	case binaryValue != nil:
+		h.Write([]byte{binaryTypeFieldIndex})
+		hashLengthAndBytes(h, binaryValue)
+	case len(stringListValues) > 0:
+		h.Write([]byte{stringListTypeFieldIndex})
+		for _, v := range stringListValues {
+			hashLengthAndBytes(h, []byte(aws.StringValue(v)))
+		}
+	case len(binaryListValues) > 0:
+		h.Write([]byte{binaryListTypeFieldIndex})
+		for _, v := range binaryListValues {
+			hashLengthAndBytes(h, v)
+		}
+	}
+}
+
+// hashLengthAndBytes adds b to h, prefixed with its length.
+func hashLengthAndBytes(h hash.Hash, b []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+	h.Write(n[:])
+	h.Write(b)
+}
+
+// compareChecksum returns an error if sum differs from expected.
+func compareChecksum(sum, expected string) error {
+	if sum != expected {
+		return fmt.Errorf("expected MD5 checksum '%s', got '%s'", expected, sum)
+	}
+	return nil
+}
+
+// setChecksumError sets r.Error to a retryable ErrCodeInvalidChecksum error.
+func setChecksumError(r *request.Request, format string, args ...interface{}) {
+	r.Retryable = aws.Bool(true)
+	r.Error = awserr.New(ErrCodeInvalidChecksum, fmt.Sprintf(format, args...), nil)
+}
@@ -0,0 +1,207 @@
+package sqsextendedclient_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+// checksumAttributes covers each attribute transport type SQS hashes.
+var checksumAttributes = map[string]*sqsextendedclient.MessageAttributeValue{
+	"string": {
+		DataType:    aws.String("String"),
+		StringValue: aws.String("value"),
+	},
+	"number": {
+		DataType:    aws.String("Number.int"),
+		StringValue: aws.String("42"),
+	},
+	"binary": {
+		DataType:    aws.String("Binary"),
+		BinaryValue: []byte{0, 1, 2, 0xfe, 0xff},
+	},
+	"strings": {
+		DataType:         aws.String("String"),
+		StringListValues: []*string{aws.String("a"), aws.String("bc")},
+	},
+	"binaries": {
+		DataType:         aws.String("Binary"),
+		BinaryListValues: [][]byte{{0}, {1, 2}},
+	},
+}
+
+func TestMessageChecksums(t *testing.T) {
+	cases := map[string]struct {
+		Body  string
+		Attrs map[string]*sqsextendedclient.MessageAttributeValue
+	}{
+		"body": {
+			Body: "hello",
+		},
+		"attributes": {
+			Body:  "hello",
+			Attrs: checksumAttributes,
+		},
+		// SQS digests the pointer, not the offloaded payload.
+		"offloaded": {
+			Body:  strings.Repeat("x", largeSize),
+			Attrs: checksumAttributes,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakes(t)
+
+			out, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+				QueueUrl:          aws.String(f.queueURL),
+				MessageBody:       aws.String(c.Body),
+				MessageAttributes: c.Attrs,
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if len(aws.StringValue(out.MD5OfMessageBody)) == 0 {
+				t.Errorf("expect body digest")
+			}
+
+			batch, err := f.svc.SendMessageBatch(&sqsextendedclient.SendMessageBatchInput{
+				QueueUrl: aws.String(f.queueURL),
+				Entries: []*sqsextendedclient.SendMessageBatchRequestEntry{{
+					Id:                aws.String("0"),
+					MessageBody:       aws.String(c.Body),
+					MessageAttributes: c.Attrs,
+				}},
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := 1, len(batch.Successful); e != a {
+				t.Errorf("expect %v successful entries, got %v", e, a)
+			}
+
+			received, err := f.svc.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+				QueueUrl:              aws.String(f.queueURL),
+				MaxNumberOfMessages:   aws.Int64(10),
+				MessageAttributeNames: []*string{aws.String("All")},
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := 2, len(received.Messages); e != a {
+				t.Fatalf("expect %v messages, got %v", e, a)
+			}
+			for _, msg := range received.Messages {
+				if e, a := c.Body, aws.StringValue(msg.Body); e != a {
+					t.Errorf("expect body of %v bytes, got %v bytes", len(e), len(a))
+				}
+			}
+		})
+	}
+}
+
+func TestMessageChecksumsMismatch(t *testing.T) {
+	cases := map[string]struct {
+		Corrupt func(*request.Request)
+		Call    func(*testing.T, *fakes) error
+	}{
+		"SendMessage body": {
+			Corrupt: func(r *request.Request) {
+				if out, ok := r.Data.(*sqsextendedclient.SendMessageOutput); ok {
+					out.MD5OfMessageBody = aws.String("00000000000000000000000000000000")
+				}
+			},
+			Call: func(t *testing.T, f *fakes) error {
+				_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+					QueueUrl:    aws.String(f.queueURL),
+					MessageBody: aws.String("hello"),
+				})
+				return err
+			},
+		},
+		"SendMessage attributes": {
+			Corrupt: func(r *request.Request) {
+				if out, ok := r.Data.(*sqsextendedclient.SendMessageOutput); ok {
+					out.MD5OfMessageAttributes = aws.String("00000000000000000000000000000000")
+				}
+			},
+			Call: func(t *testing.T, f *fakes) error {
+				_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+					QueueUrl:          aws.String(f.queueURL),
+					MessageBody:       aws.String("hello"),
+					MessageAttributes: checksumAttributes,
+				})
+				return err
+			},
+		},
+		"SendMessageBatch": {
+			Corrupt: func(r *request.Request) {
+				if out, ok := r.Data.(*sqsextendedclient.SendMessageBatchOutput); ok {
+					out.Successful[0].MD5OfMessageBody = aws.String("00000000000000000000000000000000")
+				}
+			},
+			Call: func(t *testing.T, f *fakes) error {
+				_, err := f.svc.SendMessageBatch(&sqsextendedclient.SendMessageBatchInput{
+					QueueUrl: aws.String(f.queueURL),
+					Entries: []*sqsextendedclient.SendMessageBatchRequestEntry{{
+						Id:          aws.String("0"),
+						MessageBody: aws.String("hello"),
+					}},
+				})
+				return err
+			},
+		},
+		"ReceiveMessage offloaded": {
+			Corrupt: func(r *request.Request) {
+				if out, ok := r.Data.(*sqsextendedclient.ReceiveMessageOutput); ok && len(out.Messages) > 0 {
+					out.Messages[0].MD5OfBody = aws.String("00000000000000000000000000000000")
+				}
+			},
+			Call: func(t *testing.T, f *fakes) error {
+				f.sendLarge(t)
+				_, err := f.svc.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+					QueueUrl: aws.String(f.queueURL),
+				})
+				return err
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakes(t)
+			f.svc.Handlers.Unmarshal.PushBack(c.Corrupt)
+
+			err := c.Call(t, f)
+			if err == nil {
+				t.Fatalf("expect error, got nil")
+			}
+			if e, a := sqsextendedclient.ErrCodeInvalidChecksum, err.(awserr.Error).Code(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestMessageChecksumsDisabled(t *testing.T) {
+	f := newFakes(t)
+	svc := sqsextendedclient.New(unit.Session, f.sqsConfig().WithDisableComputeChecksums(true))
+	svc.Handlers.Unmarshal.PushBack(func(r *request.Request) {
+		if out, ok := r.Data.(*sqsextendedclient.SendMessageOutput); ok {
+			out.MD5OfMessageBody = aws.String("00000000000000000000000000000000")
+		}
+	})
+
+	_, err := svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String("hello"),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+}
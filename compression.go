@@ -0,0 +1,207 @@
+package sqsextendedclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionAttributeName is the message attribute that names the Codec a
+// message body was compressed with. Like ReservedAttributeName it is reserved,
+// and counts against the attributes available to a message.
+const CompressionAttributeName = "ExtendedPayloadCompression"
+
+// Codec compresses message bodies. Compressed bodies are base64 encoded
+// before they are sent, to keep them within the characters SQS accepts.
+//
+// Implementations must be safe for concurrent use.
+type Codec interface {
+	// Name identifies the codec in the CompressionAttributeName attribute.
+	Name() string
+
+	// Compress returns the compressed form of b.
+	Compress(b []byte) ([]byte, error)
+
+	// Decompress reverses Compress.
+	Decompress(b []byte) ([]byte, error)
+}
+
+// GzipCodec is a Codec that compresses with gzip.
+type GzipCodec struct {
+	// Compression level, see compress/gzip. Zero selects the default level.
+	Level int
+}
+
+// Name returns "gzip".
+func (GzipCodec) Name() string {
+	return "gzip"
+}
+
+// Compress returns the gzip compressed form of b.
+func (c GzipCodec) Compress(b []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress returns the uncompressed form of the gzip stream b.
+func (GzipCodec) Decompress(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// ZstdCodec is a Codec that compresses with Zstandard.
+type ZstdCodec struct{}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// zstdCoders returns the shared encoder and decoder, which are safe for
+// concurrent use through EncodeAll and DecodeAll.
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil); zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+// Name returns "zstd".
+func (ZstdCodec) Name() string {
+	return "zstd"
+}
+
+// Compress returns the Zstandard compressed form of b.
+func (ZstdCodec) Compress(b []byte) ([]byte, error) {
+	enc, _, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return enc.EncodeAll(b, nil), nil
+}
+
+// Decompress returns the uncompressed form of the Zstandard frame b.
+func (ZstdCodec) Decompress(b []byte) ([]byte, error) {
+	_, dec, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return dec.DecodeAll(b, nil)
+}
+
+// compressSendMessageHandler is a Build handler that compresses the body of a
+// SendMessage request with the configured codec, if that makes the message
+// smaller. It runs before offloading, so that the message size threshold
+// applies to the compressed message.
+func (c *SQSExtended) compressSendMessageHandler(r *request.Request) {
+	if c.config.Codec == nil {
+		return
+	}
+	transformSendMessage(r, c.compressBody)
+}
+
+// compressSendMessageBatchHandler is the SendMessageBatch equivalent of
+// compressSendMessageHandler.
+func (c *SQSExtended) compressSendMessageBatchHandler(r *request.Request) {
+	if c.config.Codec == nil {
+		return
+	}
+	transformSendMessageBatch(r, c.compressBody)
+}
+
+// compressBody returns the compressed body and a copy of attrs naming the
+// codec. ok is false if compression would not make the message smaller.
+func (c *SQSExtended) compressBody(body *string, attrs map[string]*MessageAttributeValue) (*string, map[string]*MessageAttributeValue, bool, error) {
+	codec := c.config.Codec
+	b, err := codec.Compress([]byte(aws.StringValue(body)))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to compress message body with %s: %v", codec.Name(), err)
+	}
+
+	out := make(map[string]*MessageAttributeValue, len(attrs)+1)
+	for k, v := range attrs {
+		out[k] = v
+	}
+	out[CompressionAttributeName] = &MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(codec.Name()),
+	}
+	compressed := aws.String(base64.StdEncoding.EncodeToString(b))
+
+	if MessageSize(compressed, out) >= MessageSize(body, attrs) {
+		return nil, nil, false, nil
+	}
+	return compressed, out, true, nil
+}
+
+// decompressBody replaces the body of msg with its uncompressed form if the
+// message carries the compression attribute, and strips the attribute.
+func (c *SQSExtended) decompressBody(msg *Message) error {
+	attr, ok := msg.MessageAttributes[CompressionAttributeName]
+	if !ok {
+		return nil
+	}
+
+	name := aws.StringValue(attr.StringValue)
+	codec := c.codec(name)
+	if codec == nil {
+		return fmt.Errorf("unknown compression codec %q", name)
+	}
+	b, err := base64.StdEncoding.DecodeString(aws.StringValue(msg.Body))
+	if err != nil {
+		return fmt.Errorf("invalid compressed body: %v", err)
+	}
+	b, err = codec.Decompress(b)
+	if err != nil {
+		return fmt.Errorf("failed to decompress message body with %s: %v", name, err)
+	}
+
+	msg.Body = aws.String(string(b))
+	msg.MessageAttributes = withoutAttributes(msg.MessageAttributes, CompressionAttributeName)
+	return nil
+}
+
+// codec returns the codec with the given name: the configured one, or one
+// of the codecs built into the client.
+func (c *SQSExtended) codec(name string) Codec {
+	if c.config.Codec != nil && c.config.Codec.Name() == name {
+		return c.config.Codec
+	}
+	for _, codec := range []Codec{GzipCodec{}, ZstdCodec{}} {
+		if codec.Name() == name {
+			return codec
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package sqsextendedclient_test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+// words returns n bytes of words picked at random from a small vocabulary,
+// which compresses well, but not to nothing.
+func words(n int) string {
+	vocabulary := strings.Fields("alpha beta gamma delta epsilon zeta eta theta iota kappa lambda mu nu xi omicron pi")
+	r := rand.New(rand.NewSource(1))
+	var b strings.Builder
+	for b.Len() < n {
+		b.WriteString(vocabulary[r.Intn(len(vocabulary))])
+		b.WriteByte(' ')
+	}
+	return b.String()[:n]
+}
+
+func TestSendMessageCompression(t *testing.T) {
+	codecs := []sqsextendedclient.Codec{sqsextendedclient.GzipCodec{}, sqsextendedclient.ZstdCodec{}}
+	cases := map[string]struct {
+		Body       string
+		Threshold  int
+		Compressed bool
+		Offloaded  bool
+	}{
+		"incompressible": {
+			Body: "a",
+		},
+		"compressed inline": {
+			Body:       strings.Repeat(`{"id":1,"name":"report"},`, 20000),
+			Compressed: true,
+		},
+		"compressed and offloaded": {
+			Body:       words(100 * 1024),
+			Threshold:  1024,
+			Compressed: true,
+			Offloaded:  true,
+		},
+	}
+
+	for _, codec := range codecs {
+		for name, c := range cases {
+			t.Run(codec.Name()+" "+name, func(t *testing.T) {
+				f := newFakes(t, func(ext *sqsextendedclient.ExtendedClientConfiguration) {
+					ext.WithCompression(codec)
+					if c.Threshold > 0 {
+						ext.WithMessageSizeThreshold(c.Threshold)
+					}
+				})
+
+				_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+					QueueUrl:    aws.String(f.queueURL),
+					MessageBody: aws.String(c.Body),
+				})
+				if err != nil {
+					t.Fatalf("expect no error, got %v", err)
+				}
+
+				raw := f.receiveRaw(t)[0]
+				attr := raw.MessageAttributes[sqsextendedclient.CompressionAttributeName]
+				if e, a := c.Compressed, attr != nil; e != a {
+					t.Fatalf("expect compressed %v, got %v", e, a)
+				}
+				if c.Compressed {
+					if e, a := codec.Name(), aws.StringValue(attr.StringValue); e != a {
+						t.Errorf("expect %v, got %v", e, a)
+					}
+				}
+				if e, a := c.Offloaded, raw.MessageAttributes[sqsextendedclient.ReservedAttributeName] != nil; e != a {
+					t.Errorf("expect offloaded %v, got %v", e, a)
+				}
+				if !c.Offloaded && c.Compressed && len(aws.StringValue(raw.Body)) >= len(c.Body) {
+					t.Errorf("expect compressed body to be smaller than %v, got %v", len(c.Body), len(aws.StringValue(raw.Body)))
+				}
+
+				out := f.receive(t)
+				if e, a := 1, len(out.Messages); e != a {
+					t.Fatalf("expect %v message, got %v", e, a)
+				}
+				if aws.StringValue(out.Messages[0].Body) != c.Body {
+					t.Errorf("expect original body to be received")
+				}
+				if _, ok := out.Messages[0].MessageAttributes[sqsextendedclient.CompressionAttributeName]; ok {
+					t.Errorf("expect %s attribute to be stripped", sqsextendedclient.CompressionAttributeName)
+				}
+			})
+		}
+	}
+}
+
+func TestReceiveMessageUnknownCodec(t *testing.T) {
+	f := newFakes(t)
+	_, err := f.raw.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String("AAAA"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			sqsextendedclient.CompressionAttributeName: {DataType: aws.String("String"), StringValue: aws.String("lz4")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	out, err := f.svc.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+		QueueUrl: aws.String(f.queueURL),
+	})
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if e, a := sqsextendedclient.ErrCodeRetrievePayload, err.(awserr.Error).Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 0, len(out.Messages); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+	msgErr := err.(awserr.BatchedErrors).OrigErrs()[0].(*sqsextendedclient.MessagePayloadError)
+	if e, a := "lz4", msgErr.Err.Error(); !strings.Contains(a, e) {
+		t.Errorf("expect %v to be in %v", e, a)
+	}
+}
+
+func TestSendMessageCompressionOffloadedPayload(t *testing.T) {
+	f := newFakes(t, func(ext *sqsextendedclient.ExtendedClientConfiguration) {
+		ext.WithCompression(sqsextendedclient.GzipCodec{}).WithMessageSizeThreshold(1024)
+	})
+	body := words(100 * 1024)
+	_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String(body),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	// The payload store holds the compressed body.
+	var pointer sqsextendedclient.PayloadPointer
+	if err := json.Unmarshal([]byte(aws.StringValue(f.receiveRaw(t)[0].Body)), &pointer); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	payload, _ := f.s3.Object(testBucket, pointer.S3Key)
+	if len(payload) == 0 || len(payload) >= len(body) {
+		t.Errorf("expect compressed payload smaller than %v, got %v", len(body), len(payload))
+	}
+}
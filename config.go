@@ -0,0 +1,227 @@
+package sqsextendedclient
+
+import (
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// maxS3KeyPrefixLength is the longest key prefix that leaves room for the
+// random part of the key within the 1024 byte limit of S3 object keys.
+const maxS3KeyPrefixLength = 1024 - 36
+
+// s3KeyPrefixPattern matches the characters S3 considers safe in object keys.
+var s3KeyPrefixPattern = regexp.MustCompile(`^[a-zA-Z0-9!_.*'()/-]*$`)
+
+// ExtendedClientConfiguration holds the settings that extend the behaviour of
+// SQSExtended beyond the SQS API.
+//
+// Use NewExtendedClientConfiguration and the With methods to build one:
+//
+//	cfg := sqsextendedclient.NewExtendedClientConfiguration().
+//		WithLargePayloadSupport(s3.New(mySession), "my-bucket").
+//		WithS3KeyPrefix("payloads/")
+type ExtendedClientConfiguration struct {
+	// Store offloaded payloads are kept in. Takes precedence over S3Client,
+	// S3BucketName and S3KeyPrefix. Large payload support is enabled when
+	// PayloadStore is set, or both S3Client and S3BucketName are.
+	PayloadStore PayloadStore
+
+	// S3 client used to store, retrieve and delete offloaded payloads with
+	// an S3PayloadStore.
+	S3Client s3iface.S3API
+
+	// Name of the bucket offloaded payloads are stored in.
+	S3BucketName string
+
+	// Prefix prepended to the keys of offloaded payloads.
+	S3KeyPrefix string
+
+	// Messages whose body and attributes exceed MessageSizeThreshold bytes
+	// are offloaded. Defaults to DefaultMessageSizeThreshold, which is also
+	// the maximum.
+	MessageSizeThreshold *int
+
+	// Offload every message body regardless of its size, so that message
+	// content is never stored in SQS. Requires large payload support.
+	AlwaysThroughS3 bool
+
+	// Codec message bodies are compressed with before they are sent, when
+	// that makes them smaller. The message size threshold applies to the
+	// compressed message. Received messages are decompressed regardless.
+	Codec Codec
+
+	// KeyProvider the data keys of encrypted message bodies are generated
+	// and unwrapped with. If set, message bodies are encrypted after they
+	// are compressed and before they are offloaded, so that payloads are
+	// encrypted in the payload store as well.
+	KeyProvider KeyProvider
+}
+
+// NewExtendedClientConfiguration returns a new configuration with large
+// payload support disabled.
+func NewExtendedClientConfiguration() *ExtendedClientConfiguration {
+	return &ExtendedClientConfiguration{}
+}
+
+// WithLargePayloadSupport sets the S3 client and bucket used for offloaded
+// payloads, and returns the configuration for chaining.
+func (c *ExtendedClientConfiguration) WithLargePayloadSupport(s3c s3iface.S3API, bucketName string) *ExtendedClientConfiguration {
+	c.S3Client = s3c
+	c.S3BucketName = bucketName
+	return c
+}
+
+// WithPayloadStore sets the PayloadStore value returning the configuration
+// for chaining.
+func (c *ExtendedClientConfiguration) WithPayloadStore(store PayloadStore) *ExtendedClientConfiguration {
+	c.PayloadStore = store
+	return c
+}
+
+// WithS3KeyPrefix sets the S3KeyPrefix value returning the configuration for
+// chaining.
+func (c *ExtendedClientConfiguration) WithS3KeyPrefix(prefix string) *ExtendedClientConfiguration {
+	c.S3KeyPrefix = prefix
+	return c
+}
+
+// WithMessageSizeThreshold sets the MessageSizeThreshold value returning the
+// configuration for chaining.
+func (c *ExtendedClientConfiguration) WithMessageSizeThreshold(threshold int) *ExtendedClientConfiguration {
+	c.MessageSizeThreshold = &threshold
+	return c
+}
+
+// WithAlwaysThroughS3 sets the AlwaysThroughS3 value returning the
+// configuration for chaining.
+func (c *ExtendedClientConfiguration) WithAlwaysThroughS3(always bool) *ExtendedClientConfiguration {
+	c.AlwaysThroughS3 = always
+	return c
+}
+
+// WithCompression sets the Codec value returning the configuration for
+// chaining.
+func (c *ExtendedClientConfiguration) WithCompression(codec Codec) *ExtendedClientConfiguration {
+	c.Codec = codec
+	return c
+}
+
+// WithEncryption sets the KeyProvider value returning the configuration for
+// chaining.
+func (c *ExtendedClientConfiguration) WithEncryption(kp KeyProvider) *ExtendedClientConfiguration {
+	c.KeyProvider = kp
+	return c
+}
+
+// Validate inspects the fields of the configuration to determine if they are
+// valid.
+func (c *ExtendedClientConfiguration) Validate() error {
+	invalidParams := request.ErrInvalidParams{Context: "ExtendedClientConfiguration"}
+	if c.PayloadStore == nil {
+		if (c.S3Client != nil || c.AlwaysThroughS3) && len(c.S3BucketName) == 0 {
+			invalidParams.Add(request.NewErrParamRequired("S3BucketName"))
+		}
+		if c.S3Client == nil && (len(c.S3BucketName) > 0 || c.AlwaysThroughS3) {
+			invalidParams.Add(request.NewErrParamRequired("S3Client"))
+		}
+	}
+	if len(c.S3KeyPrefix) > maxS3KeyPrefixLength {
+		invalidParams.Add(request.NewErrParamMaxLen("S3KeyPrefix", maxS3KeyPrefixLength, c.S3KeyPrefix))
+	}
+	if !s3KeyPrefixPattern.MatchString(c.S3KeyPrefix) {
+		invalidParams.Add(request.NewErrParamFormat("S3KeyPrefix", s3KeyPrefixPattern.String(), c.S3KeyPrefix))
+	}
+	if c.MessageSizeThreshold != nil {
+		if *c.MessageSizeThreshold < 0 {
+			invalidParams.Add(request.NewErrParamMinValue("MessageSizeThreshold", 0))
+		}
+		if *c.MessageSizeThreshold > DefaultMessageSizeThreshold {
+			invalidParams.Add(NewErrParamMaxValue("MessageSizeThreshold", DefaultMessageSizeThreshold))
+		}
+	}
+
+	if invalidParams.Len() > 0 {
+		return invalidParams
+	}
+	return nil
+}
+
+// largePayloadSupport reports whether large payload support is enabled.
+func (c *ExtendedClientConfiguration) largePayloadSupport() bool {
+	return c.PayloadStore != nil || (c.S3Client != nil && len(c.S3BucketName) > 0)
+}
+
+// newPayloadStore returns the store offloaded payloads are kept in, or nil if
+// large payload support is disabled. Clients build it once, when they are
+// given the configuration.
+func (c *ExtendedClientConfiguration) newPayloadStore() PayloadStore {
+	if c.PayloadStore != nil {
+		return c.PayloadStore
+	}
+	if !c.largePayloadSupport() {
+		return nil
+	}
+	return &S3PayloadStore{
+		Client:     c.S3Client,
+		BucketName: c.S3BucketName,
+		KeyPrefix:  c.S3KeyPrefix,
+	}
+}
+
+// maxAllowedAttributes returns the number of message attributes left to the
+// caller once the reserved attributes in use are accounted for.
+func (c *ExtendedClientConfiguration) maxAllowedAttributes() int {
+	max := maxMessageAttributes
+	if c.largePayloadSupport() {
+		max--
+	}
+	if c.Codec != nil {
+		max--
+	}
+	if c.KeyProvider != nil {
+		max--
+	}
+	return max
+}
+
+// isLarge reports whether a message of the given size is to be offloaded.
+func (c *ExtendedClientConfiguration) isLarge(size int) bool {
+	return c.AlwaysThroughS3 || size > c.messageSizeThreshold()
+}
+
+// messageSizeThreshold returns the configured threshold, or the default.
+func (c *ExtendedClientConfiguration) messageSizeThreshold() int {
+	if c.MessageSizeThreshold == nil {
+		return DefaultMessageSizeThreshold
+	}
+	return *c.MessageSizeThreshold
+}
+
+// NewWithExtendedConfig creates a new instance of the SQSExtended client with
+// a session and extended client configuration. An error is returned if the
+// configuration is nil or not valid.
+//
+// Example:
+//
+//	mySession := session.Must(session.NewSession())
+//
+//	// Create a SQSExtended client that offloads large payloads to S3.
+//	svc, err := SQSExtended.NewWithExtendedConfig(mySession,
+//		SQSExtended.NewExtendedClientConfiguration().WithLargePayloadSupport(s3.New(mySession), "my-bucket"))
+func NewWithExtendedConfig(p client.ConfigProvider, ext *ExtendedClientConfiguration, cfgs ...*aws.Config) (*SQSExtended, error) {
+	if ext == nil {
+		return nil, request.NewErrParamRequired("ExtendedClientConfiguration")
+	}
+	if err := ext.Validate(); err != nil {
+		return nil, err
+	}
+
+	svc := New(p, cfgs...)
+	svc.config = *ext
+	svc.store = ext.newPayloadStore()
+	return svc, nil
+}
@@ -0,0 +1,64 @@
+package sqsextendedclient_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	"github.com/aws/aws-sdk-go/service/s3"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+func TestNewWithExtendedConfig(t *testing.T) {
+	cases := map[string]struct {
+		Config *sqsextendedclient.ExtendedClientConfiguration
+		Code   string
+	}{
+		"nil": {
+			Code: request.ParamRequiredErrCode,
+		},
+		"empty": {
+			Config: sqsextendedclient.NewExtendedClientConfiguration(),
+		},
+		"missing bucket": {
+			Config: sqsextendedclient.NewExtendedClientConfiguration().
+				WithLargePayloadSupport(s3.New(unit.Session), ""),
+			Code: request.InvalidParameterErrCode,
+		},
+		"always through S3 without bucket": {
+			Config: sqsextendedclient.NewExtendedClientConfiguration().WithAlwaysThroughS3(true),
+			Code:   request.InvalidParameterErrCode,
+		},
+		"threshold above maximum": {
+			Config: sqsextendedclient.NewExtendedClientConfiguration().
+				WithLargePayloadSupport(s3.New(unit.Session), "bucket").
+				WithMessageSizeThreshold(sqsextendedclient.DefaultMessageSizeThreshold + 1),
+			Code: request.InvalidParameterErrCode,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			svc, err := sqsextendedclient.NewWithExtendedConfig(unit.Session, c.Config)
+			if len(c.Code) == 0 {
+				if err != nil {
+					t.Fatalf("expect no error, got %v", err)
+				}
+				if svc == nil {
+					t.Errorf("expect client, got nil")
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expect error, got nil")
+			}
+			if e, a := c.Code, err.(awserr.Error).Code(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			if svc != nil {
+				t.Errorf("expect no client, got %v", svc)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package sqsextendedclient
+
+import "github.com/aws/aws-sdk-go/aws/request"
+
+func init() {
+	initRequest = func(r *request.Request) {
+		setupChecksumValidation(r)
+	}
+}
@@ -0,0 +1,271 @@
+package sqsextendedclient
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// ErrCodeEncryptPayload is the error code returned when a message body could
+// not be encrypted, typically because the KeyProvider failed to generate a
+// data key.
+const ErrCodeEncryptPayload = "EncryptPayloadError"
+
+// EncryptionAttributeName is the message attribute that carries the wrapped
+// data key and nonce of an encrypted message. Like ReservedAttributeName it
+// is reserved, and counts against the attributes available to a message.
+const EncryptionAttributeName = "ExtendedPayloadEncryption"
+
+// envelopeAlgorithm identifies the cipher message bodies are encrypted with.
+const envelopeAlgorithm = "AES256GCM"
+
+// dataKeySize is the size of the per-message data keys, in bytes.
+const dataKeySize = 32
+
+// KeyProvider generates and unwraps the data keys message bodies are
+// encrypted with. Each message is encrypted with a new data key, which is
+// sent along with the message in wrapped form.
+//
+// Implementations must be safe for concurrent use.
+type KeyProvider interface {
+	// GenerateDataKey returns a new 256-bit data key, both in plaintext and
+	// wrapped by the provider's master key.
+	GenerateDataKey(ctx aws.Context) (plaintext, wrapped []byte, err error)
+
+	// DecryptDataKey returns the plaintext of a data key wrapped by
+	// GenerateDataKey.
+	DecryptDataKey(ctx aws.Context, wrapped []byte) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider that wraps data keys with a fixed
+// AES-256 master key held in memory. It is meant for tests and for
+// deployments that manage the master key themselves.
+type StaticKeyProvider struct {
+	aead cipher.AEAD
+}
+
+// NewStaticKeyProvider returns a KeyProvider that wraps data keys with key,
+// which must be 32 bytes long.
+func NewStaticKeyProvider(key []byte) (*StaticKeyProvider, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticKeyProvider{aead: aead}, nil
+}
+
+// GenerateDataKey returns a random data key, and the key sealed with the
+// master key.
+func (p *StaticKeyProvider) GenerateDataKey(ctx aws.Context) ([]byte, []byte, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return key, p.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+// DecryptDataKey opens a data key sealed by GenerateDataKey.
+func (p *StaticKeyProvider) DecryptDataKey(ctx aws.Context, wrapped []byte) ([]byte, error) {
+	n := p.aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, fmt.Errorf("wrapped data key is too short")
+	}
+	return p.aead.Open(nil, wrapped[:n], wrapped[n:], nil)
+}
+
+// KMSKeyProvider is a KeyProvider that has AWS KMS generate and unwrap data
+// keys under a KMS key. For local development the KMS client can be pointed
+// at a KMS stand-in, such as local-kms, with aws.Config.Endpoint.
+type KMSKeyProvider struct {
+	// KMS client used to generate and decrypt data keys.
+	Client kmsiface.KMSAPI
+
+	// Identifier of the KMS key data keys are generated under: a key ID,
+	// key ARN, alias name or alias ARN.
+	KeyId string
+
+	// Encryption context passed to KMS with every request. Consumers must
+	// use the same context as producers.
+	EncryptionContext map[string]*string
+}
+
+// NewKMSKeyProvider returns a KeyProvider that generates data keys under the
+// given KMS key.
+func NewKMSKeyProvider(kmsc kmsiface.KMSAPI, keyID string) *KMSKeyProvider {
+	return &KMSKeyProvider{
+		Client: kmsc,
+		KeyId:  keyID,
+	}
+}
+
+// GenerateDataKey has KMS generate a new AES-256 data key.
+func (p *KMSKeyProvider) GenerateDataKey(ctx aws.Context) ([]byte, []byte, error) {
+	resp, err := p.Client.GenerateDataKeyWithContext(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             aws.String(p.KeyId),
+		KeySpec:           aws.String(kms.DataKeySpecAes256),
+		EncryptionContext: p.EncryptionContext,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Plaintext, resp.CiphertextBlob, nil
+}
+
+// DecryptDataKey has KMS decrypt a data key generated by GenerateDataKey.
+func (p *KMSKeyProvider) DecryptDataKey(ctx aws.Context, wrapped []byte) ([]byte, error) {
+	resp, err := p.Client.DecryptWithContext(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(p.KeyId),
+		CiphertextBlob:    wrapped,
+		EncryptionContext: p.EncryptionContext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+// envelope is the content of the EncryptionAttributeName attribute.
+type envelope struct {
+	Algorithm  string `json:"alg"`
+	WrappedKey []byte `json:"key"`
+	Nonce      []byte `json:"iv"`
+}
+
+// encryptSendMessageHandler is a Build handler that encrypts the body of a
+// SendMessage request with a new data key. It runs after compression, which
+// would gain nothing on ciphertext, and before offloading, so that offloaded
+// payloads are encrypted as well.
+func (c *SQSExtended) encryptSendMessageHandler(r *request.Request) {
+	if c.config.KeyProvider == nil {
+		return
+	}
+	transformSendMessage(r, c.bodyEncrypter(r.Context()))
+}
+
+// encryptSendMessageBatchHandler is the SendMessageBatch equivalent of
+// encryptSendMessageHandler.
+func (c *SQSExtended) encryptSendMessageBatchHandler(r *request.Request) {
+	if c.config.KeyProvider == nil {
+		return
+	}
+	transformSendMessageBatch(r, c.bodyEncrypter(r.Context()))
+}
+
+// bodyEncrypter returns a bodyTransform that encrypts message bodies, with
+// the key provider requests bound to ctx.
+func (c *SQSExtended) bodyEncrypter(ctx aws.Context) bodyTransform {
+	return func(body *string, attrs map[string]*MessageAttributeValue) (*string, map[string]*MessageAttributeValue, bool, error) {
+		encrypted, env, err := c.encryptBody(ctx, aws.StringValue(body))
+		if err != nil {
+			return nil, nil, false, awserr.New(ErrCodeEncryptPayload, "failed to encrypt message body", err)
+		}
+
+		out := make(map[string]*MessageAttributeValue, len(attrs)+1)
+		for k, v := range attrs {
+			out[k] = v
+		}
+		out[EncryptionAttributeName] = &MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(string(env)),
+		}
+		return aws.String(encrypted), out, true, nil
+	}
+}
+
+// encryptBody seals body with a new data key, and returns the base64 encoded
+// ciphertext and the JSON encoded envelope.
+func (c *SQSExtended) encryptBody(ctx aws.Context, body string) (string, []byte, error) {
+	key, wrapped, err := c.config.KeyProvider.GenerateDataKey(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+
+	env, err := json.Marshal(envelope{
+		Algorithm:  envelopeAlgorithm,
+		WrappedKey: wrapped,
+		Nonce:      nonce,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	sealed := aead.Seal(nil, nonce, []byte(body), []byte(envelopeAlgorithm))
+	return base64.StdEncoding.EncodeToString(sealed), env, nil
+}
+
+// decryptBody replaces the body of msg with its plaintext if the message
+// carries the encryption attribute, and strips the attribute.
+func (c *SQSExtended) decryptBody(ctx aws.Context, msg *Message) error {
+	attr, ok := msg.MessageAttributes[EncryptionAttributeName]
+	if !ok {
+		return nil
+	}
+	if c.config.KeyProvider == nil {
+		return fmt.Errorf("message is encrypted, but no key provider is configured")
+	}
+
+	var env envelope
+	if err := json.Unmarshal([]byte(aws.StringValue(attr.StringValue)), &env); err != nil {
+		return fmt.Errorf("invalid encryption envelope: %v", err)
+	}
+	if env.Algorithm != envelopeAlgorithm {
+		return fmt.Errorf("unknown encryption algorithm %q", env.Algorithm)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(aws.StringValue(msg.Body))
+	if err != nil {
+		return fmt.Errorf("invalid encrypted body: %v", err)
+	}
+
+	key, err := c.config.KeyProvider.DecryptDataKey(ctx, env.WrappedKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt data key: %v", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return fmt.Errorf("invalid encryption nonce")
+	}
+	b, err := aead.Open(nil, env.Nonce, sealed, []byte(env.Algorithm))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt message body: %v", err)
+	}
+
+	msg.Body = aws.String(string(b))
+	msg.MessageAttributes = withoutAttributes(msg.MessageAttributes, EncryptionAttributeName)
+	return nil
+}
+
+// newAEAD returns AES-256-GCM keyed with key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", dataKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
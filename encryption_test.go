@@ -0,0 +1,157 @@
+package sqsextendedclient_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+// newStaticKeyProvider returns a StaticKeyProvider with a master key made of
+// the byte b.
+func newStaticKeyProvider(t *testing.T, b byte) *sqsextendedclient.StaticKeyProvider {
+	t.Helper()
+
+	kp, err := sqsextendedclient.NewStaticKeyProvider(bytes.Repeat([]byte{b}, 32))
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	return kp
+}
+
+// stubKMS stands in for KMS, wrapping data keys with a StaticKeyProvider
+// under a single key ID.
+type stubKMS struct {
+	kmsiface.KMSAPI
+	keyID string
+	kp    *sqsextendedclient.StaticKeyProvider
+}
+
+func (s *stubKMS) GenerateDataKeyWithContext(ctx aws.Context, in *kms.GenerateDataKeyInput, opts ...request.Option) (*kms.GenerateDataKeyOutput, error) {
+	if aws.StringValue(in.KeyId) != s.keyID {
+		return nil, awserr.New(kms.ErrCodeNotFoundException, "key not found", nil)
+	}
+	plaintext, wrapped, err := s.kp.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyOutput{KeyId: in.KeyId, Plaintext: plaintext, CiphertextBlob: wrapped}, nil
+}
+
+func (s *stubKMS) DecryptWithContext(ctx aws.Context, in *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error) {
+	plaintext, err := s.kp.DecryptDataKey(ctx, in.CiphertextBlob)
+	if err != nil {
+		return nil, awserr.New(kms.ErrCodeInvalidCiphertextException, "invalid ciphertext", err)
+	}
+	return &kms.DecryptOutput{KeyId: aws.String(s.keyID), Plaintext: plaintext}, nil
+}
+
+func TestSendMessageEncryption(t *testing.T) {
+	providers := map[string]sqsextendedclient.KeyProvider{
+		"static": newStaticKeyProvider(t, 1),
+		"kms":    sqsextendedclient.NewKMSKeyProvider(&stubKMS{keyID: "alias/test", kp: newStaticKeyProvider(t, 2)}, "alias/test"),
+	}
+	bodies := map[string]string{
+		"inline":    "secret message",
+		"offloaded": "secret " + strings.Repeat("x", largeSize),
+	}
+
+	for pname, kp := range providers {
+		for bname, body := range bodies {
+			t.Run(pname+" "+bname, func(t *testing.T) {
+				f := newFakes(t, func(ext *sqsextendedclient.ExtendedClientConfiguration) {
+					ext.WithEncryption(kp)
+				})
+
+				_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+					QueueUrl:    aws.String(f.queueURL),
+					MessageBody: aws.String(body),
+				})
+				if err != nil {
+					t.Fatalf("expect no error, got %v", err)
+				}
+
+				raw := f.receiveRaw(t)[0]
+				if _, ok := raw.MessageAttributes[sqsextendedclient.EncryptionAttributeName]; !ok {
+					t.Errorf("expect %s attribute", sqsextendedclient.EncryptionAttributeName)
+				}
+				if strings.Contains(aws.StringValue(raw.Body), "secret") {
+					t.Errorf("expect body to be encrypted in SQS")
+				}
+				for _, key := range f.s3.Keys(testBucket) {
+					payload, _ := f.s3.Object(testBucket, key)
+					if bytes.Contains(payload, []byte("secret")) {
+						t.Errorf("expect payload to be encrypted in S3")
+					}
+				}
+
+				out := f.receive(t)
+				if e, a := 1, len(out.Messages); e != a {
+					t.Fatalf("expect %v message, got %v", e, a)
+				}
+				if aws.StringValue(out.Messages[0].Body) != body {
+					t.Errorf("expect plaintext body to be received")
+				}
+				if _, ok := out.Messages[0].MessageAttributes[sqsextendedclient.EncryptionAttributeName]; ok {
+					t.Errorf("expect %s attribute to be stripped", sqsextendedclient.EncryptionAttributeName)
+				}
+			})
+		}
+	}
+}
+
+func TestReceiveMessageEncryptionWrongKey(t *testing.T) {
+	f := newFakes(t, func(ext *sqsextendedclient.ExtendedClientConfiguration) {
+		ext.WithEncryption(newStaticKeyProvider(t, 1))
+	})
+	consumer := f.newClient(t, func(ext *sqsextendedclient.ExtendedClientConfiguration) {
+		ext.WithEncryption(newStaticKeyProvider(t, 2))
+	})
+
+	_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String("secret message"),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	out, err := consumer.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+		QueueUrl: aws.String(f.queueURL),
+	})
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if e, a := sqsextendedclient.ErrCodeRetrievePayload, err.(awserr.Error).Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 0, len(out.Messages); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
+
+func TestSendMessageEncryptionKeyProviderError(t *testing.T) {
+	f := newFakes(t, func(ext *sqsextendedclient.ExtendedClientConfiguration) {
+		ext.WithEncryption(sqsextendedclient.NewKMSKeyProvider(&stubKMS{keyID: "alias/test", kp: newStaticKeyProvider(t, 1)}, "alias/missing"))
+	})
+
+	_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String("secret message"),
+	})
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if e, a := sqsextendedclient.ErrCodeEncryptPayload, err.(awserr.Error).Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 0, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
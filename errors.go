@@ -0,0 +1,230 @@
+package sqsextendedclient
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+
+	// ErrCodeBatchEntryIdsNotDistinct for service response error code
+	// "AWS.SimpleQueueService.BatchEntryIdsNotDistinct".
+	//
+	// Two or more batch entries in the request have the same Id.
+	ErrCodeBatchEntryIdsNotDistinct = "AWS.SimpleQueueService.BatchEntryIdsNotDistinct"
+
+	// ErrCodeBatchRequestTooLong for service response error code
+	// "AWS.SimpleQueueService.BatchRequestTooLong".
+	//
+	// The length of all the messages put together is more than the limit.
+	ErrCodeBatchRequestTooLong = "AWS.SimpleQueueService.BatchRequestTooLong"
+
+	// ErrCodeEmptyBatchRequest for service response error code
+	// "AWS.SimpleQueueService.EmptyBatchRequest".
+	//
+	// The batch request doesn't contain any entries.
+	ErrCodeEmptyBatchRequest = "AWS.SimpleQueueService.EmptyBatchRequest"
+
+	// ErrCodeInvalidAttributeName for service response error code
+	// "InvalidAttributeName".
+	//
+	// The specified attribute doesn't exist.
+	ErrCodeInvalidAttributeName = "InvalidAttributeName"
+
+	// ErrCodeInvalidBatchEntryId for service response error code
+	// "AWS.SimpleQueueService.InvalidBatchEntryId".
+	//
+	// The Id of a batch entry in a batch request doesn't abide by the specification.
+	ErrCodeInvalidBatchEntryId = "AWS.SimpleQueueService.InvalidBatchEntryId"
+
+	// ErrCodeInvalidIdFormat for service response error code
+	// "InvalidIdFormat".
+	//
+	// The specified receipt handle isn't valid for the current version.
+	ErrCodeInvalidIdFormat = "InvalidIdFormat"
+
+	// ErrCodeInvalidMessageContents for service response error code
+	// "InvalidMessageContents".
+	//
+	// The message contains characters outside the allowed set.
+	ErrCodeInvalidMessageContents = "InvalidMessageContents"
+
+	// ErrCodeMessageNotInflight for service response error code
+	// "AWS.SimpleQueueService.MessageNotInflight".
+	//
+	// The specified message isn't in flight.
+	ErrCodeMessageNotInflight = "AWS.SimpleQueueService.MessageNotInflight"
+
+	// ErrCodeOverLimit for service response error code
+	// "OverLimit".
+	//
+	// The specified action violates a limit. For example, ReceiveMessage returns
+	// this error if the maximum number of inflight messages is reached and AddPermission
+	// returns this error if the maximum number of permissions for the queue is
+	// reached.
+	ErrCodeOverLimit = "OverLimit"
+
+	// ErrCodePurgeQueueInProgress for service response error code
+	// "AWS.SimpleQueueService.PurgeQueueInProgress".
+	//
+	// Indicates that the specified queue previously received a PurgeQueue request
+	// within the last 60 seconds (the time it can take to delete the messages in
+	// the queue).
+	ErrCodePurgeQueueInProgress = "AWS.SimpleQueueService.PurgeQueueInProgress"
+
+	// ErrCodeQueueDeletedRecently for service response error code
+	// "AWS.SimpleQueueService.QueueDeletedRecently".
+	//
+	// You must wait 60 seconds after deleting a queue before you can create another
+	// queue with the same name.
+	ErrCodeQueueDeletedRecently = "AWS.SimpleQueueService.QueueDeletedRecently"
+
+	// ErrCodeQueueDoesNotExist for service response error code
+	// "AWS.SimpleQueueService.NonExistentQueue".
+	//
+	// The specified queue doesn't exist.
+	ErrCodeQueueDoesNotExist = "AWS.SimpleQueueService.NonExistentQueue"
+
+	// ErrCodeQueueNameExists for service response error code
+	// "QueueAlreadyExists".
+	//
+	// A queue with this name already exists. Amazon SQS returns this error only
+	// if the request includes attributes whose values differ from those of the
+	// existing queue.
+	ErrCodeQueueNameExists = "QueueAlreadyExists"
+
+	// ErrCodeReceiptHandleIsInvalid for service response error code
+	// "ReceiptHandleIsInvalid".
+	//
+	// The specified receipt handle isn't valid.
+	ErrCodeReceiptHandleIsInvalid = "ReceiptHandleIsInvalid"
+
+	// ErrCodeTooManyEntriesInBatchRequest for service response error code
+	// "AWS.SimpleQueueService.TooManyEntriesInBatchRequest".
+	//
+	// The batch request contains more entries than permissible.
+	ErrCodeTooManyEntriesInBatchRequest = "AWS.SimpleQueueService.TooManyEntriesInBatchRequest"
+
+	// ErrCodeUnsupportedOperation for service response error code
+	// "AWS.SimpleQueueService.UnsupportedOperation".
+	//
+	// Error code 400. Unsupported operation.
+	ErrCodeUnsupportedOperation = "AWS.SimpleQueueService.UnsupportedOperation"
+)
+
+// errCodeIs reports whether err is an awserr.Error with the given code.
+func errCodeIs(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
+
+// IsBatchEntryIdsNotDistinct reports whether err is an awserr.Error with code
+// ErrCodeBatchEntryIdsNotDistinct.
+func IsBatchEntryIdsNotDistinct(err error) bool {
+	return errCodeIs(err, ErrCodeBatchEntryIdsNotDistinct)
+}
+
+// IsBatchRequestTooLong reports whether err is an awserr.Error with code
+// ErrCodeBatchRequestTooLong.
+func IsBatchRequestTooLong(err error) bool {
+	return errCodeIs(err, ErrCodeBatchRequestTooLong)
+}
+
+// IsEmptyBatchRequest reports whether err is an awserr.Error with code
+// ErrCodeEmptyBatchRequest.
+func IsEmptyBatchRequest(err error) bool {
+	return errCodeIs(err, ErrCodeEmptyBatchRequest)
+}
+
+// IsInvalidAttributeName reports whether err is an awserr.Error with code
+// ErrCodeInvalidAttributeName.
+func IsInvalidAttributeName(err error) bool {
+	return errCodeIs(err, ErrCodeInvalidAttributeName)
+}
+
+// IsInvalidBatchEntryId reports whether err is an awserr.Error with code
+// ErrCodeInvalidBatchEntryId.
+func IsInvalidBatchEntryId(err error) bool {
+	return errCodeIs(err, ErrCodeInvalidBatchEntryId)
+}
+
+// IsInvalidIdFormat reports whether err is an awserr.Error with code
+// ErrCodeInvalidIdFormat.
+func IsInvalidIdFormat(err error) bool {
+	return errCodeIs(err, ErrCodeInvalidIdFormat)
+}
+
+// IsInvalidMessageContents reports whether err is an awserr.Error with code
+// ErrCodeInvalidMessageContents.
+func IsInvalidMessageContents(err error) bool {
+	return errCodeIs(err, ErrCodeInvalidMessageContents)
+}
+
+// IsMessageNotInflight reports whether err is an awserr.Error with code
+// ErrCodeMessageNotInflight.
+func IsMessageNotInflight(err error) bool {
+	return errCodeIs(err, ErrCodeMessageNotInflight)
+}
+
+// IsOverLimit reports whether err is an awserr.Error with code
+// ErrCodeOverLimit.
+func IsOverLimit(err error) bool {
+	return errCodeIs(err, ErrCodeOverLimit)
+}
+
+// IsPurgeQueueInProgress reports whether err is an awserr.Error with code
+// ErrCodePurgeQueueInProgress.
+func IsPurgeQueueInProgress(err error) bool {
+	return errCodeIs(err, ErrCodePurgeQueueInProgress)
+}
+
+// IsQueueDeletedRecently reports whether err is an awserr.Error with code
+// ErrCodeQueueDeletedRecently.
+func IsQueueDeletedRecently(err error) bool {
+	return errCodeIs(err, ErrCodeQueueDeletedRecently)
+}
+
+// IsQueueDoesNotExist reports whether err is an awserr.Error with code
+// ErrCodeQueueDoesNotExist.
+func IsQueueDoesNotExist(err error) bool {
+	return errCodeIs(err, ErrCodeQueueDoesNotExist)
+}
+
+// IsQueueNameExists reports whether err is an awserr.Error with code
+// ErrCodeQueueNameExists.
+func IsQueueNameExists(err error) bool {
+	return errCodeIs(err, ErrCodeQueueNameExists)
+}
+
+// IsReceiptHandleIsInvalid reports whether err is an awserr.Error with code
+// ErrCodeReceiptHandleIsInvalid.
+func IsReceiptHandleIsInvalid(err error) bool {
+	return errCodeIs(err, ErrCodeReceiptHandleIsInvalid)
+}
+
+// IsTooManyEntriesInBatchRequest reports whether err is an awserr.Error with
+// code ErrCodeTooManyEntriesInBatchRequest.
+func IsTooManyEntriesInBatchRequest(err error) bool {
+	return errCodeIs(err, ErrCodeTooManyEntriesInBatchRequest)
+}
+
+// IsUnsupportedOperation reports whether err is an awserr.Error with code
+// ErrCodeUnsupportedOperation.
+func IsUnsupportedOperation(err error) bool {
+	return errCodeIs(err, ErrCodeUnsupportedOperation)
+}
+
+// IsPayloadError reports whether err was raised by the payload handling of
+// the extended client rather than by SQS: storing, retrieving, deleting or
+// encrypting an offloaded or inline payload. Individual payload store
+// failures are reported as *PayloadStoreError.
+func IsPayloadError(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case ErrCodeStorePayload, ErrCodeRetrievePayload, ErrCodeDeletePayload, ErrCodeEncryptPayload:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package sqsextendedclient_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+func TestErrorCodes(t *testing.T) {
+	// The codes are the ones SQS returns, as the SQS package defines them.
+	cases := map[string]struct {
+		Code, Expect string
+	}{
+		"BatchEntryIdsNotDistinct":     {sqsextendedclient.ErrCodeBatchEntryIdsNotDistinct, sqs.ErrCodeBatchEntryIdsNotDistinct},
+		"BatchRequestTooLong":          {sqsextendedclient.ErrCodeBatchRequestTooLong, sqs.ErrCodeBatchRequestTooLong},
+		"EmptyBatchRequest":            {sqsextendedclient.ErrCodeEmptyBatchRequest, sqs.ErrCodeEmptyBatchRequest},
+		"InvalidAttributeName":         {sqsextendedclient.ErrCodeInvalidAttributeName, sqs.ErrCodeInvalidAttributeName},
+		"InvalidBatchEntryId":          {sqsextendedclient.ErrCodeInvalidBatchEntryId, sqs.ErrCodeInvalidBatchEntryId},
+		"InvalidIdFormat":              {sqsextendedclient.ErrCodeInvalidIdFormat, sqs.ErrCodeInvalidIdFormat},
+		"InvalidMessageContents":       {sqsextendedclient.ErrCodeInvalidMessageContents, sqs.ErrCodeInvalidMessageContents},
+		"MessageNotInflight":           {sqsextendedclient.ErrCodeMessageNotInflight, sqs.ErrCodeMessageNotInflight},
+		"OverLimit":                    {sqsextendedclient.ErrCodeOverLimit, sqs.ErrCodeOverLimit},
+		"PurgeQueueInProgress":         {sqsextendedclient.ErrCodePurgeQueueInProgress, sqs.ErrCodePurgeQueueInProgress},
+		"QueueDeletedRecently":         {sqsextendedclient.ErrCodeQueueDeletedRecently, sqs.ErrCodeQueueDeletedRecently},
+		"QueueDoesNotExist":            {sqsextendedclient.ErrCodeQueueDoesNotExist, sqs.ErrCodeQueueDoesNotExist},
+		"QueueNameExists":              {sqsextendedclient.ErrCodeQueueNameExists, sqs.ErrCodeQueueNameExists},
+		"ReceiptHandleIsInvalid":       {sqsextendedclient.ErrCodeReceiptHandleIsInvalid, sqs.ErrCodeReceiptHandleIsInvalid},
+		"TooManyEntriesInBatchRequest": {sqsextendedclient.ErrCodeTooManyEntriesInBatchRequest, sqs.ErrCodeTooManyEntriesInBatchRequest},
+		"UnsupportedOperation":         {sqsextendedclient.ErrCodeUnsupportedOperation, sqs.ErrCodeUnsupportedOperation},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if e, a := c.Expect, c.Code; e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestErrorPredicates(t *testing.T) {
+	predicates := map[string]func(error) bool{
+		sqsextendedclient.ErrCodeBatchEntryIdsNotDistinct:     sqsextendedclient.IsBatchEntryIdsNotDistinct,
+		sqsextendedclient.ErrCodeBatchRequestTooLong:          sqsextendedclient.IsBatchRequestTooLong,
+		sqsextendedclient.ErrCodeEmptyBatchRequest:            sqsextendedclient.IsEmptyBatchRequest,
+		sqsextendedclient.ErrCodeInvalidAttributeName:         sqsextendedclient.IsInvalidAttributeName,
+		sqsextendedclient.ErrCodeInvalidBatchEntryId:          sqsextendedclient.IsInvalidBatchEntryId,
+		sqsextendedclient.ErrCodeInvalidIdFormat:              sqsextendedclient.IsInvalidIdFormat,
+		sqsextendedclient.ErrCodeInvalidMessageContents:       sqsextendedclient.IsInvalidMessageContents,
+		sqsextendedclient.ErrCodeMessageNotInflight:           sqsextendedclient.IsMessageNotInflight,
+		sqsextendedclient.ErrCodeOverLimit:                    sqsextendedclient.IsOverLimit,
+		sqsextendedclient.ErrCodePurgeQueueInProgress:         sqsextendedclient.IsPurgeQueueInProgress,
+		sqsextendedclient.ErrCodeQueueDeletedRecently:         sqsextendedclient.IsQueueDeletedRecently,
+		sqsextendedclient.ErrCodeQueueDoesNotExist:            sqsextendedclient.IsQueueDoesNotExist,
+		sqsextendedclient.ErrCodeQueueNameExists:              sqsextendedclient.IsQueueNameExists,
+		sqsextendedclient.ErrCodeReceiptHandleIsInvalid:       sqsextendedclient.IsReceiptHandleIsInvalid,
+		sqsextendedclient.ErrCodeTooManyEntriesInBatchRequest: sqsextendedclient.IsTooManyEntriesInBatchRequest,
+		sqsextendedclient.ErrCodeUnsupportedOperation:         sqsextendedclient.IsUnsupportedOperation,
+	}
+
+	// Each predicate matches the code of the error itself, as the SDK's error
+	// codes do, not the codes of the errors it wraps.
+	inputs := map[string]struct {
+		Err   func(code string) error
+		Match bool
+	}{
+		"error": {
+			Err:   func(code string) error { return awserr.New(code, "message", nil) },
+			Match: true,
+		},
+		"with cause": {
+			Err:   func(code string) error { return awserr.New(code, "message", errors.New("cause")) },
+			Match: true,
+		},
+		"request failure": {
+			Err: func(code string) error {
+				return awserr.NewRequestFailure(awserr.New(code, "message", nil), 400, "request")
+			},
+			Match: true,
+		},
+		"batched errors": {
+			Err: func(code string) error {
+				return awserr.NewBatchError(code, "message", []error{errors.New("a"), errors.New("b")})
+			},
+			Match: true,
+		},
+		"cause of another code": {
+			Err: func(code string) error {
+				return awserr.New("Other", "message", awserr.New(code, "message", nil))
+			},
+		},
+		"in batched errors of another code": {
+			Err: func(code string) error {
+				return awserr.NewBatchError("Other", "message", []error{awserr.New(code, "message", nil)})
+			},
+		},
+		"wrapped by fmt": {
+			Err: func(code string) error {
+				return fmt.Errorf("send: %w", awserr.New(code, "message", nil))
+			},
+		},
+		"other code": {
+			Err: func(code string) error { return awserr.New("Other", code, nil) },
+		},
+		"plain error": {
+			Err: func(code string) error { return errors.New(code) },
+		},
+		"nil": {
+			Err: func(code string) error { return nil },
+		},
+	}
+
+	for code, is := range predicates {
+		for name, c := range inputs {
+			t.Run(code+"/"+name, func(t *testing.T) {
+				if e, a := c.Match, is(c.Err(code)); e != a {
+					t.Errorf("expect %v, got %v", e, a)
+				}
+			})
+		}
+
+		// No predicate matches the codes of the others.
+		for other := range predicates {
+			if other != code && is(awserr.New(other, "message", nil)) {
+				t.Errorf("expect predicate of %v not to match %v", code, other)
+			}
+		}
+	}
+}
+
+func TestIsPayloadError(t *testing.T) {
+	cases := map[string]struct {
+		Err    error
+		Expect bool
+	}{
+		"store": {
+			Err:    &sqsextendedclient.PayloadStoreError{Op: "PutPayload", Err: errors.New("cause")},
+			Expect: true,
+		},
+		"retrieve": {
+			Err:    &sqsextendedclient.PayloadStoreError{Op: "GetPayload", Err: errors.New("cause")},
+			Expect: true,
+		},
+		"delete": {
+			Err:    &sqsextendedclient.PayloadStoreError{Op: "DeletePayload", Err: errors.New("cause")},
+			Expect: true,
+		},
+		"encrypt": {
+			Err:    awserr.New(sqsextendedclient.ErrCodeEncryptPayload, "message", nil),
+			Expect: true,
+		},
+		"batched delete errors": {
+			Err: awserr.NewBatchError(sqsextendedclient.ErrCodeDeletePayload, "message", []error{
+				&sqsextendedclient.PayloadStoreError{Op: "DeletePayload", Err: errors.New("a")},
+				&sqsextendedclient.PayloadStoreError{Op: "DeletePayload", Err: errors.New("b")},
+			}),
+			Expect: true,
+		},
+		"request failure": {
+			Err:    awserr.NewRequestFailure(awserr.New(sqsextendedclient.ErrCodeStorePayload, "message", nil), 500, "request"),
+			Expect: true,
+		},
+		"digest mismatch": {
+			Err: &sqsextendedclient.PayloadDigestError{},
+		},
+		"sqs": {
+			Err: awserr.New(sqsextendedclient.ErrCodeQueueDoesNotExist, "message", nil),
+		},
+		"checksum": {
+			Err: awserr.New(sqsextendedclient.ErrCodeInvalidChecksum, "message", nil),
+		},
+		"cause": {
+			Err: awserr.New("Other", "message", &sqsextendedclient.PayloadStoreError{Op: "PutPayload"}),
+		},
+		"wrapped by fmt": {
+			Err: fmt.Errorf("send: %w", &sqsextendedclient.PayloadStoreError{Op: "PutPayload"}),
+		},
+		"plain error": {
+			Err: errors.New(sqsextendedclient.ErrCodeStorePayload),
+		},
+		"nil": {},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if e, a := c.Expect, sqsextendedclient.IsPayloadError(c.Err); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestPayloadStoreError(t *testing.T) {
+	cause := errors.New("cause")
+	pointer := sqsextendedclient.PayloadPointer{S3BucketName: "bucket", S3Key: "key"}
+
+	cases := map[string]struct {
+		Op      string
+		Pointer sqsextendedclient.PayloadPointer
+		Code    string
+		Message string
+	}{
+		"PutPayload": {
+			Op:      "PutPayload",
+			Code:    sqsextendedclient.ErrCodeStorePayload,
+			Message: "failed to store message payload",
+		},
+		"GetPayload": {
+			Op:      "GetPayload",
+			Pointer: pointer,
+			Code:    sqsextendedclient.ErrCodeRetrievePayload,
+			Message: "failed to retrieve message payload bucket/key",
+		},
+		"DeletePayload": {
+			Op:      "DeletePayload",
+			Pointer: pointer,
+			Code:    sqsextendedclient.ErrCodeDeletePayload,
+			Message: "failed to delete message payload bucket/key",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var err error = &sqsextendedclient.PayloadStoreError{Op: c.Op, Pointer: c.Pointer, Err: cause}
+
+			aerr, ok := err.(awserr.Error)
+			if !ok {
+				t.Fatalf("expect awserr.Error, got %T", err)
+			}
+			if e, a := c.Code, aerr.Code(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			if e, a := c.Message, aerr.Message(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			if e, a := cause, aerr.OrigErr(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			if e, a := awserr.SprintError(c.Code, c.Message, "", cause), err.Error(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			if !sqsextendedclient.IsPayloadError(err) {
+				t.Errorf("expect payload error")
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package sqsextendedclient
+
+// Unexported functions used by the tests of package sqsextendedclient_test.
+var (
+	WrapReceiptHandle   = wrapReceiptHandle
+	UnwrapReceiptHandle = unwrapReceiptHandle
+)
+
+// IsLarge reports whether c offloads a message of the given size.
+func IsLarge(c *ExtendedClientConfiguration, size int) bool {
+	return c.isLarge(size)
+}
@@ -0,0 +1,142 @@
+package sqsextendedclient_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendedtest"
+)
+
+// testBucket is the bucket of the fake S3 server payloads are offloaded to.
+const testBucket = "payloads"
+
+// largeSize is the size of a message body that is offloaded by default.
+const largeSize = sqsextendedclient.DefaultMessageSizeThreshold + 1
+
+// fakes is a client under test, and the fake services it talks to.
+type fakes struct {
+	svc      *sqsextendedclient.SQSExtended
+	sqs      *sqsextendedtest.SQSServer
+	s3       *sqsextendedtest.S3Server
+	queueURL string
+
+	// raw is a plain SQS client, to inspect messages as they are in SQS.
+	raw *sqs.SQS
+}
+
+// newFakes starts a fake SQS server with a queue, and a fake S3 server with
+// testBucket, and returns a client with large payload support talking to
+// them. Requests are not retried. Pass in options to customize the extended
+// client configuration.
+func newFakes(t *testing.T, options ...func(*sqsextendedclient.ExtendedClientConfiguration)) *fakes {
+	t.Helper()
+
+	f := &fakes{
+		sqs: sqsextendedtest.NewSQSServer(),
+		s3:  sqsextendedtest.NewS3Server(),
+	}
+	t.Cleanup(f.sqs.Close)
+	t.Cleanup(f.s3.Close)
+
+	f.svc = f.newClient(t, options...)
+	f.raw = sqs.New(unit.Session, f.sqsConfig())
+
+	out, err := f.svc.CreateQueue(&sqsextendedclient.CreateQueueInput{
+		QueueName: aws.String("queue"),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	f.queueURL = aws.StringValue(out.QueueUrl)
+	return f
+}
+
+// newClient returns another client with large payload support talking to
+// the fake servers, such as a consumer configured differently from the
+// producer.
+func (f *fakes) newClient(t *testing.T, options ...func(*sqsextendedclient.ExtendedClientConfiguration)) *sqsextendedclient.SQSExtended {
+	t.Helper()
+
+	svc, err := sqsextendedtest.NewClient(unit.Session, f.sqs, f.s3, testBucket, options...)
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	return svc
+}
+
+// sqsConfig returns the configuration of plain clients of the fake SQS
+// server.
+func (f *fakes) sqsConfig() *aws.Config {
+	return f.sqs.Config().WithMaxRetries(0)
+}
+
+// receiveRaw receives the messages in the queue with the plain SQS client,
+// with all their attributes, and makes them visible again.
+func (f *fakes) receiveRaw(t *testing.T) []*sqs.Message {
+	t.Helper()
+
+	out, err := f.raw.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(f.queueURL),
+		MaxNumberOfMessages:   aws.Int64(10),
+		MessageAttributeNames: []*string{aws.String("All")},
+		VisibilityTimeout:     aws.Int64(0),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	return out.Messages
+}
+
+// receive receives up to 10 messages with the client under test.
+func (f *fakes) receive(t *testing.T) *sqsextendedclient.ReceiveMessageOutput {
+	t.Helper()
+
+	out, err := f.svc.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+		QueueUrl:            aws.String(f.queueURL),
+		MaxNumberOfMessages: aws.Int64(10),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	return out
+}
+
+// messages returns the number of messages in the queue, visible or not.
+func (f *fakes) messages(t *testing.T) int {
+	t.Helper()
+
+	out, err := f.raw.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(f.queueURL),
+		AttributeNames: []*string{aws.String("All")},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	n := 0
+	for _, name := range []string{"ApproximateNumberOfMessages", "ApproximateNumberOfMessagesNotVisible", "ApproximateNumberOfMessagesDelayed"} {
+		v, _ := strconv.Atoi(aws.StringValue(out.Attributes[name]))
+		n += v
+	}
+	return n
+}
+
+// sendLarge sends a message of largeSize bytes, which the client under test
+// offloads, and returns its body.
+func (f *fakes) sendLarge(t *testing.T) string {
+	t.Helper()
+
+	body := strings.Repeat("x", largeSize)
+	_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String(body),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	return body
+}
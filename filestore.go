@@ -0,0 +1,120 @@
+package sqsextendedclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol"
+)
+
+// fileKeyPattern matches the keys FilePayloadStore hands out: a two character
+// shard directory followed by a random file name.
+var fileKeyPattern = regexp.MustCompile(`^[0-9A-Fa-f]{2}/[0-9A-Fa-f-]+$`)
+
+// FilePayloadStore is a PayloadStore that keeps payloads as files in a local
+// directory, for development and on-premises deployments without S3.
+// Payloads are spread over subdirectories named after the first two
+// characters of their key, and written to a temporary file that is renamed
+// into place, so that readers never see a partially written payload.
+//
+// Producers and consumers must share the directory.
+type FilePayloadStore struct {
+	name string
+	dir  string
+}
+
+// NewFilePayloadStore returns a store that keeps payloads in dir, creating the
+// directory if needed. The name takes the place of the bucket name in the
+// pointers the store hands out.
+func NewFilePayloadStore(name, dir string) (*FilePayloadStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FilePayloadStore{
+		name: name,
+		dir:  dir,
+	}, nil
+}
+
+// PutPayload writes payload to a new file.
+func (s *FilePayloadStore) PutPayload(ctx aws.Context, payload string) (PayloadPointer, error) {
+	id := protocol.GetIdempotencyToken()
+	pointer := PayloadPointer{
+		S3BucketName: s.name,
+		S3Key:        id[:2] + "/" + id,
+	}
+
+	shard := filepath.Join(s.dir, id[:2])
+	if err := os.MkdirAll(shard, 0700); err != nil {
+		return PayloadPointer{}, err
+	}
+
+	f, err := ioutil.TempFile(shard, ".tmp-")
+	if err != nil {
+		return PayloadPointer{}, err
+	}
+	tmp := f.Name()
+	if _, err := f.WriteString(payload); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return PayloadPointer{}, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return PayloadPointer{}, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return PayloadPointer{}, err
+	}
+	if err := os.Rename(tmp, filepath.Join(shard, id)); err != nil {
+		os.Remove(tmp)
+		return PayloadPointer{}, err
+	}
+	return pointer, nil
+}
+
+// GetPayload reads the file pointer refers to.
+func (s *FilePayloadStore) GetPayload(ctx aws.Context, pointer PayloadPointer) (string, error) {
+	path, err := s.path(pointer)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// DeletePayload removes the file pointer refers to. Deleting a payload that
+// does not exist is not an error.
+func (s *FilePayloadStore) DeletePayload(ctx aws.Context, pointer PayloadPointer) error {
+	path, err := s.path(pointer)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path returns the file pointer refers to, checking that it points into the
+// store's directory.
+func (s *FilePayloadStore) path(pointer PayloadPointer) (string, error) {
+	if pointer.S3BucketName != s.name {
+		return "", fmt.Errorf("pointer refers to store %s, not %s", pointer.S3BucketName, s.name)
+	}
+	if !fileKeyPattern.MatchString(pointer.S3Key) {
+		return "", fmt.Errorf("invalid payload key %q", pointer.S3Key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(pointer.S3Key)), nil
+}
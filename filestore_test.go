@@ -0,0 +1,135 @@
+package sqsextendedclient_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+func TestFilePayloadStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "payloads")
+	store, err := sqsextendedclient.NewFilePayloadStore("files", dir)
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	ctx := aws.BackgroundContext()
+
+	pointer, err := store.PutPayload(ctx, "hello")
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := "files", pointer.S3BucketName; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	// Payloads are sharded by the first two characters of their file name.
+	parts := strings.Split(pointer.S3Key, "/")
+	if e, a := 2, len(parts); e != a {
+		t.Fatalf("expect %v key parts, got %v", e, a)
+	}
+	if e, a := parts[1][:2], parts[0]; e != a {
+		t.Errorf("expect shard %v, got %v", e, a)
+	}
+	shard, err := ioutil.ReadDir(filepath.Join(dir, parts[0]))
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 1, len(shard); e != a {
+		t.Fatalf("expect %v files in the shard, got %v", e, a)
+	}
+	if e, a := parts[1], shard[0].Name(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	payload, err := store.GetPayload(ctx, pointer)
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := "hello", payload; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := store.DeletePayload(ctx, pointer); err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(pointer.S3Key))); !os.IsNotExist(err) {
+		t.Errorf("expect payload file to be removed, got %v", err)
+	}
+	if _, err := store.GetPayload(ctx, pointer); err == nil {
+		t.Errorf("expect error for deleted payload, got nil")
+	}
+}
+
+func TestFilePayloadStoreInvalidPointers(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "payloads")
+	store, err := sqsextendedclient.NewFilePayloadStore("files", dir)
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	ctx := aws.BackgroundContext()
+
+	// A file outside the store that traversal keys would reach.
+	outside := filepath.Join(root, "secret")
+	if err := ioutil.WriteFile(outside, []byte("secret"), 0600); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	cases := map[string]struct {
+		Pointer sqsextendedclient.PayloadPointer
+		// Missing keys are well-formed: only GetPayload fails.
+		Missing bool
+	}{
+		"other store": {
+			Pointer: sqsextendedclient.PayloadPointer{S3BucketName: "other", S3Key: "ab/abcdef"},
+		},
+		"missing key": {
+			Pointer: sqsextendedclient.PayloadPointer{S3BucketName: "files", S3Key: "ab/abcdef"},
+			Missing: true,
+		},
+		"empty key": {
+			Pointer: sqsextendedclient.PayloadPointer{S3BucketName: "files"},
+		},
+		"no shard": {
+			Pointer: sqsextendedclient.PayloadPointer{S3BucketName: "files", S3Key: "abcdef"},
+		},
+		"parent directory": {
+			Pointer: sqsextendedclient.PayloadPointer{S3BucketName: "files", S3Key: "../secret"},
+		},
+		"traversal in shard": {
+			Pointer: sqsextendedclient.PayloadPointer{S3BucketName: "files", S3Key: "ab/../../secret"},
+		},
+		"absolute path": {
+			Pointer: sqsextendedclient.PayloadPointer{S3BucketName: "files", S3Key: outside},
+		},
+		"backslash": {
+			Pointer: sqsextendedclient.PayloadPointer{S3BucketName: "files", S3Key: `ab\..\..\secret`},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.GetPayload(ctx, c.Pointer); err == nil {
+				t.Errorf("expect GetPayload error, got nil")
+			}
+			err := store.DeletePayload(ctx, c.Pointer)
+			if c.Missing {
+				if err != nil {
+					t.Errorf("expect no DeletePayload error, got %v", err)
+				}
+			} else if err == nil {
+				t.Errorf("expect DeletePayload error, got nil")
+			}
+			if _, err := os.Stat(outside); err != nil {
+				t.Errorf("expect file outside the store to be kept, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package sqsextendedclient_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+// The golden files in testdata/java hold pointers, receipt handles and
+// messages in the format of the Java Amazon SQS Extended Client Library:
+// payloadoffloading PayloadS3Pointer for 2.x, and MessageS3Pointer with the
+// SQSLargePayloadSize attribute for 1.x. See testdata/java/README.md for how
+// they are captured. The tests read the S3 keys, which are random, from the
+// files, so that they can be captured again without changing the tests.
+
+// javaReceiptHandle is the SQS receipt handle the stubs of the capture
+// program hand out, which the Java client wraps.
+const javaReceiptHandle = "AQEBpzt3TP3+/YQY+MDDtjdqI1EvrirShZHFIMaA0OAO9WLHn4NB8ti1CoGSlqjgYoEAOPyEtf4cg6btRhvvVPRPK8VwHEXoiCY/aMYVnyjcCWJZ0GOTOZ/0M6epmp2jRfTur5RzEmeNFlp2l2jvzhT+CpIhw0XTNN5UoBsylgQR/CGKEIDz"
+
+// javaKeyPattern extracts the S3 key from a golden pointer without decoding
+// it, so that the expectation does not depend on the code under test.
+var javaKeyPattern = regexp.MustCompile(`"s3Key":"([^"]+)"`)
+
+// goldenJava returns the content of a golden file in testdata/java, without
+// the trailing newline.
+func goldenJava(t *testing.T, name string) string {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "java", name))
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	return strings.TrimSuffix(string(b), "\n")
+}
+
+// goldenJavaKey returns the S3 key of the pointer in a golden file.
+func goldenJavaKey(t *testing.T, name string) string {
+	t.Helper()
+
+	m := javaKeyPattern.FindStringSubmatch(goldenJava(t, name))
+	if m == nil {
+		t.Fatalf("expect %s to hold a pointer", name)
+	}
+	return m[1]
+}
+
+func TestJavaPayloadPointerRoundTrip(t *testing.T) {
+	cases := map[string]struct {
+		Golden string
+		Bucket string
+		Legacy bool
+	}{
+		"PayloadS3Pointer": {
+			Golden: "payload_s3_pointer.json",
+			Bucket: "payloads",
+		},
+		"MessageS3Pointer": {
+			Golden: "message_s3_pointer.json",
+			Bucket: "payloads",
+			Legacy: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			golden := goldenJava(t, c.Golden)
+			key := goldenJavaKey(t, c.Golden)
+
+			var pointer sqsextendedclient.PayloadPointer
+			if err := json.Unmarshal([]byte(golden), &pointer); err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := c.Bucket, pointer.S3BucketName; e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			if e, a := key, pointer.S3Key; e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+
+			// Pointers are always written in the 2.x format.
+			expect := golden
+			if c.Legacy {
+				expect = strings.Replace(golden, "com.amazon.sqs.javamessaging.MessageS3Pointer",
+					"software.amazon.payloadoffloading.PayloadS3Pointer", 1)
+			}
+			if e, a := expect, pointer.String(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestJavaReceiptHandleRoundTrip(t *testing.T) {
+	golden := goldenJava(t, "receipt_handle.txt")
+	// The capture program wraps the handle of the message it sent.
+	key := goldenJavaKey(t, "payload_s3_pointer.json")
+
+	handle, pointer, ok := sqsextendedclient.UnwrapReceiptHandle(golden)
+	if !ok {
+		t.Fatalf("expect receipt handle to be wrapped")
+	}
+	if e, a := "payloads", pointer.S3BucketName; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := key, pointer.S3Key; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := javaReceiptHandle, handle; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	if e, a := golden, sqsextendedclient.WrapReceiptHandle(handle, pointer); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+}
+
+// javaMessage is a message sent by the Java extended client, and the payload
+// it offloaded.
+type javaMessage struct {
+	Body              string
+	MessageAttributes map[string]*sqs.MessageAttributeValue
+	Payload           string
+}
+
+func TestJavaMessageReceiveAndDelete(t *testing.T) {
+	cases := []string{
+		"extended_payload_size_message.json",
+		"sqs_large_payload_size_message.json",
+	}
+
+	for _, name := range cases {
+		t.Run(name, func(t *testing.T) {
+			var golden javaMessage
+			if err := json.Unmarshal([]byte(goldenJava(t, name)), &golden); err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			var pointer sqsextendedclient.PayloadPointer
+			if err := json.Unmarshal([]byte(golden.Body), &pointer); err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+
+			f := newFakes(t)
+			f.s3.SetObject(pointer.S3BucketName, pointer.S3Key, []byte(golden.Payload))
+			_, err := f.raw.SendMessage(&sqs.SendMessageInput{
+				QueueUrl:          aws.String(f.queueURL),
+				MessageBody:       aws.String(golden.Body),
+				MessageAttributes: golden.MessageAttributes,
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+
+			out, err := f.svc.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+				QueueUrl:              aws.String(f.queueURL),
+				MessageAttributeNames: []*string{aws.String("All")},
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := 1, len(out.Messages); e != a {
+				t.Fatalf("expect %v message, got %v", e, a)
+			}
+			msg := out.Messages[0]
+			if e, a := golden.Payload, aws.StringValue(msg.Body); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			for _, attr := range []string{sqsextendedclient.ReservedAttributeName, sqsextendedclient.LegacyReservedAttributeName} {
+				if _, ok := msg.MessageAttributes[attr]; ok {
+					t.Errorf("expect %s attribute to be stripped", attr)
+				}
+			}
+			if e, a := len(golden.MessageAttributes)-1, len(msg.MessageAttributes); e != a {
+				t.Errorf("expect %v attributes, got %v", e, a)
+			}
+
+			_, err = f.svc.DeleteMessage(&sqsextendedclient.DeleteMessageInput{
+				QueueUrl:      aws.String(f.queueURL),
+				ReceiptHandle: msg.ReceiptHandle,
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if _, ok := f.s3.Object(pointer.S3BucketName, pointer.S3Key); ok {
+				t.Errorf("expect payload to be deleted")
+			}
+			if e, a := 0, f.messages(t); e != a {
+				t.Errorf("expect %v messages, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestSendMessagePointerIsJavaCompatible(t *testing.T) {
+	f := newFakes(t)
+	f.sendLarge(t)
+
+	raw := f.receiveRaw(t)[0]
+	body := aws.StringValue(raw.Body)
+	var pointer sqsextendedclient.PayloadPointer
+	if err := json.Unmarshal([]byte(body), &pointer); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	// The body must be the Java pointer, field for field, so that Java
+	// consumers can read it.
+	golden := goldenJava(t, "payload_s3_pointer.json")
+	expect := strings.Replace(golden, goldenJavaKey(t, "payload_s3_pointer.json"), pointer.S3Key, 1)
+	if e, a := expect, body; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	size := raw.MessageAttributes[sqsextendedclient.ReservedAttributeName]
+	if size == nil || !strings.HasPrefix(aws.StringValue(size.DataType), "Number") {
+		t.Errorf("expect Number %s attribute, got %v", sqsextendedclient.ReservedAttributeName, size)
+	}
+}
@@ -0,0 +1,84 @@
+package sqsextendedclient
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol"
+)
+
+// MemoryPayloadStore is a PayloadStore that keeps payloads in memory. It is
+// meant for tests and local development, where messages are produced and
+// consumed by the same process.
+type MemoryPayloadStore struct {
+	name string
+
+	mu       sync.RWMutex
+	payloads map[string]string
+}
+
+// NewMemoryPayloadStore returns an empty in-memory store. The name takes the
+// place of the bucket name in the pointers the store hands out.
+func NewMemoryPayloadStore(name string) *MemoryPayloadStore {
+	return &MemoryPayloadStore{
+		name:     name,
+		payloads: map[string]string{},
+	}
+}
+
+// PutPayload stores payload under a new random key.
+func (s *MemoryPayloadStore) PutPayload(ctx aws.Context, payload string) (PayloadPointer, error) {
+	pointer := PayloadPointer{
+		S3BucketName: s.name,
+		S3Key:        protocol.GetIdempotencyToken(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payloads[pointer.S3Key] = payload
+	return pointer, nil
+}
+
+// GetPayload returns the payload pointer refers to.
+func (s *MemoryPayloadStore) GetPayload(ctx aws.Context, pointer PayloadPointer) (string, error) {
+	if err := s.checkPointer(pointer); err != nil {
+		return "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	payload, ok := s.payloads[pointer.S3Key]
+	if !ok {
+		return "", fmt.Errorf("payload %s not found in store %s", pointer.S3Key, s.name)
+	}
+	return payload, nil
+}
+
+// DeletePayload deletes the payload pointer refers to. Deleting a payload
+// that does not exist is not an error.
+func (s *MemoryPayloadStore) DeletePayload(ctx aws.Context, pointer PayloadPointer) error {
+	if err := s.checkPointer(pointer); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.payloads, pointer.S3Key)
+	return nil
+}
+
+// Len returns the number of payloads in the store.
+func (s *MemoryPayloadStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.payloads)
+}
+
+// checkPointer returns an error if pointer refers to a different store.
+func (s *MemoryPayloadStore) checkPointer(pointer PayloadPointer) error {
+	if pointer.S3BucketName != s.name {
+		return fmt.Errorf("pointer refers to store %s, not %s", pointer.S3BucketName, s.name)
+	}
+	return nil
+}
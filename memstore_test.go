@@ -0,0 +1,66 @@
+package sqsextendedclient_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+func TestMemoryPayloadStore(t *testing.T) {
+	store := sqsextendedclient.NewMemoryPayloadStore("memory")
+	ctx := aws.BackgroundContext()
+
+	pointer, err := store.PutPayload(ctx, "hello")
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := "memory", pointer.S3BucketName; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if len(pointer.S3Key) == 0 {
+		t.Errorf("expect key")
+	}
+	if e, a := 1, store.Len(); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+
+	payload, err := store.GetPayload(ctx, pointer)
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := "hello", payload; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	cases := map[string]sqsextendedclient.PayloadPointer{
+		"other store": {S3BucketName: "other", S3Key: pointer.S3Key},
+		"missing key": {S3BucketName: "memory", S3Key: "missing"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.GetPayload(ctx, c); err == nil {
+				t.Errorf("expect error, got nil")
+			}
+		})
+	}
+
+	if err := store.DeletePayload(ctx, sqsextendedclient.PayloadPointer{S3BucketName: "other", S3Key: pointer.S3Key}); err == nil {
+		t.Errorf("expect error deleting from another store, got nil")
+	}
+	if e, a := 1, store.Len(); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := store.DeletePayload(ctx, pointer); err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+	}
+	if e, a := 0, store.Len(); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+	if _, err := store.GetPayload(ctx, pointer); err == nil {
+		t.Errorf("expect error for deleted payload, got nil")
+	}
+}
@@ -0,0 +1,520 @@
+package sqsextendedclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const (
+	// ErrCodeStorePayload is the error code returned when an offloaded message
+	// payload could not be written to the payload store.
+	ErrCodeStorePayload = "StorePayloadError"
+
+	// ErrCodeRetrievePayload is the error code returned when the offloaded
+	// payloads of one or more received messages could not be read from the
+	// payload store.
+	// The batched errors are of type *MessagePayloadError.
+	ErrCodeRetrievePayload = "RetrievePayloadError"
+)
+
+// payloadDigestDataType prefixes the hex encoded SHA-256 digest of an
+// offloaded payload in the custom data type of its ReservedAttributeName
+// attribute, e.g. "Number.sha256-9f86d0...". The digest is kept out of the
+// pointer, which the Java extended client has to be able to read, and out of
+// an attribute of its own, which would take one from the caller.
+const payloadDigestDataType = "Number.sha256-"
+
+// MessagePayloadError is returned for each received message whose offloaded
+// payload could not be retrieved. The message is left on the queue and is
+// omitted from ReceiveMessageOutput.Messages.
+type MessagePayloadError struct {
+	// MessageId and ReceiptHandle of the message as received from SQS.
+	MessageId     string
+	ReceiptHandle string
+
+	// Err is the underlying error: a *PayloadStoreError if the payload store
+	// failed, a *PayloadDigestError if the payload did not match its digest,
+	// or an error decoding the message.
+	Err error
+}
+
+// Error returns the string representation of the error.
+func (e *MessagePayloadError) Error() string {
+	return fmt.Sprintf("failed to retrieve payload of message %s: %v", e.MessageId, e.Err)
+}
+
+// OrigErr returns the underlying error.
+func (e *MessagePayloadError) OrigErr() error {
+	return e.Err
+}
+
+// PayloadDigestError is the underlying error of a MessagePayloadError when the
+// payload retrieved for a message does not match the SHA-256 digest recorded
+// in the data type of its ReservedAttributeName attribute, because the payload
+// was modified or only partially written.
+type PayloadDigestError struct {
+	// Pointer to the payload.
+	Pointer PayloadPointer
+
+	// Hex encoded SHA-256 digests recorded for the payload when it was
+	// offloaded, and of the retrieved payload.
+	Expected string
+	Digest   string
+}
+
+// Error returns the string representation of the error.
+func (e *PayloadDigestError) Error() string {
+	return fmt.Sprintf("payload %s in %s has SHA-256 digest %s, expected %s",
+		e.Pointer.S3Key, e.Pointer.S3BucketName, e.Digest, e.Expected)
+}
+
+// largePayloadSupportEnabled reports whether payloads may be offloaded.
+func (c *SQSExtended) largePayloadSupportEnabled() bool {
+	return c.store != nil
+}
+
+// offloadSendMessageHandler is a Build handler that stores the body of a
+// SendMessage request in the payload store when the message exceeds the
+// message size threshold or AlwaysThroughS3 is set, and replaces it with a
+// pointer to the payload. The caller's input is left untouched.
+func (c *SQSExtended) offloadSendMessageHandler(r *request.Request) {
+	if !c.largePayloadSupportEnabled() {
+		return
+	}
+
+	in := r.Params.(*SendMessageInput)
+	if !c.config.isLarge(in.MessageSize()) {
+		return
+	}
+
+	body := aws.StringValue(in.MessageBody)
+	pointer, err := c.storePayload(r.Context(), body)
+	if err != nil {
+		r.Error = err
+		return
+	}
+
+	params := *in
+	params.MessageAttributes = withPayloadAttributes(in.MessageAttributes, body)
+	params.MessageBody = aws.String(pointer.String())
+	r.Params = &params
+}
+
+// offloadSendMessageBatchHandler is a Build handler that stores the bodies of
+// SendMessageBatch entries in the payload store and replaces them with
+// pointers. Every entry that exceeds the message size threshold on its own,
+// or every entry if AlwaysThroughS3 is set, is offloaded, followed by the
+// largest remaining entries until the batch as a whole fits within
+// DefaultMessageSizeThreshold.
+//
+// The payloads of entries that SQS reports as failed are deleted again. If
+// that fails, the output is returned along with an awserr.BatchedErrors with
+// code ErrCodeDeletePayload.
+//
+// If the request fails, the payloads are deleted only if the batch is known
+// not to have been enqueued: the request was never sent, could not connect,
+// or was rejected by SQS. Otherwise, such as when the response was lost or
+// timed out, or failed checksum validation, SQS may have enqueued messages
+// pointing to the payloads, which are kept and reported to the logger.
+func (c *SQSExtended) offloadSendMessageBatchHandler(r *request.Request) {
+	if !c.largePayloadSupportEnabled() {
+		return
+	}
+
+	in := r.Params.(*SendMessageBatchInput)
+	entries := make([]*SendMessageBatchRequestEntry, len(in.Entries))
+	sizes := make([]int, len(in.Entries))
+	total := 0
+	for i, e := range in.Entries {
+		entries[i] = e
+		if e == nil {
+			continue
+		}
+		sizes[i] = e.MessageSize()
+		total += sizes[i]
+	}
+
+	pointers := make([]*PayloadPointer, len(in.Entries))
+	cleanup := func() {
+		for _, pointer := range pointers {
+			if pointer == nil {
+				continue
+			}
+			if err := c.deletePayload(r.Context(), *pointer); err != nil && r.Config.LogLevel.Matches(aws.LogDebugWithRequestErrors) {
+				r.Config.Logger.Log(fmt.Sprintf("DEBUG: %s/%s failed to clean up payload, %v",
+					r.ClientInfo.ServiceName, r.Operation.Name, err))
+			}
+		}
+	}
+	offload := func(i int) error {
+		e := in.Entries[i]
+		body := aws.StringValue(e.MessageBody)
+		pointer, err := c.storePayload(r.Context(), body)
+		if err != nil {
+			return err
+		}
+		pointers[i] = &pointer
+
+		entry := *e
+		entry.MessageAttributes = withPayloadAttributes(e.MessageAttributes, body)
+		entry.MessageBody = aws.String(pointer.String())
+		entries[i] = &entry
+
+		size := entry.MessageSize()
+		total += size - sizes[i]
+		sizes[i] = size
+		return nil
+	}
+
+	offloaded := false
+	for i, e := range entries {
+		if e == nil || !c.config.isLarge(sizes[i]) {
+			continue
+		}
+		if err := offload(i); err != nil {
+			cleanup()
+			r.Error = err
+			return
+		}
+		offloaded = true
+	}
+	for total > DefaultMessageSizeThreshold {
+		largest := -1
+		for i, e := range entries {
+			if e == nil || pointers[i] != nil {
+				continue
+			}
+			if largest < 0 || sizes[i] > sizes[largest] {
+				largest = i
+			}
+		}
+		if largest < 0 {
+			break
+		}
+		if err := offload(largest); err != nil {
+			cleanup()
+			r.Error = err
+			return
+		}
+		offloaded = true
+	}
+	if !offloaded {
+		return
+	}
+
+	params := *in
+	params.Entries = entries
+	r.Params = &params
+
+	settled, maybeSent := false, false
+	r.Handlers.Retry.PushFrontNamed(request.NamedHandler{
+		Name: "sqsextended.TrackSentPayloads",
+		Fn: func(r *request.Request) {
+			if !notEnqueued(r.Error) {
+				maybeSent = true
+			}
+		},
+	})
+	r.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{
+		Name: "sqsextended.DeleteFailedPayloads",
+		Fn: func(r *request.Request) {
+			if r.Error != nil {
+				return
+			}
+			settled = true
+
+			failed := map[string]bool{}
+			for _, f := range r.Data.(*SendMessageBatchOutput).Failed {
+				failed[aws.StringValue(f.Id)] = true
+			}
+			var errs []error
+			for i, pointer := range pointers {
+				if pointer == nil || !failed[aws.StringValue(in.Entries[i].Id)] {
+					continue
+				}
+				if err := c.deletePayload(r.Context(), *pointer); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			if len(errs) > 0 {
+				r.Retryable = aws.Bool(false)
+				r.Error = awserr.NewBatchError(ErrCodeDeletePayload,
+					"failed to delete offloaded payloads of failed entries", errs)
+			}
+		},
+	})
+	r.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "sqsextended.DeleteUnsentPayloads",
+		Fn: func(r *request.Request) {
+			if settled || r.Error == nil {
+				return
+			}
+			if !maybeSent {
+				cleanup()
+				return
+			}
+			if r.Config.Logger != nil {
+				var keys []string
+				for _, pointer := range pointers {
+					if pointer != nil {
+						keys = append(keys, pointer.S3BucketName+"/"+pointer.S3Key)
+					}
+				}
+				r.Config.Logger.Log(fmt.Sprintf(
+					"WARN: %s/%s failed after the batch may have been enqueued, keeping offloaded payloads %s, %v",
+					r.ClientInfo.ServiceName, r.Operation.Name, strings.Join(keys, ", "), r.Error))
+			}
+		},
+	})
+}
+
+// notEnqueued reports whether err, the error of a request attempt, shows that
+// SQS did not act on the request: it could not connect, or responded with a
+// client error, rejecting the request as a whole.
+func notEnqueued(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		return reqErr.StatusCode() >= 400 && reqErr.StatusCode() < 500
+	}
+	for err != nil {
+		if opErr, ok := err.(*net.OpError); ok {
+			return opErr.Op == "dial"
+		}
+		if aerr, ok := err.(awserr.Error); ok {
+			err = aerr.OrigErr()
+		} else {
+			err = errors.Unwrap(err)
+		}
+	}
+	return false
+}
+
+// storePayload puts body in the payload store.
+func (c *SQSExtended) storePayload(ctx aws.Context, body string) (PayloadPointer, error) {
+	pointer, err := c.store.PutPayload(ctx, body)
+	if err != nil {
+		return PayloadPointer{}, &PayloadStoreError{Op: "PutPayload", Err: err}
+	}
+	return pointer, nil
+}
+
+// payloadDigest returns the hex encoded SHA-256 digest of payload.
+func payloadDigest(payload string) string {
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// receivePayloadAttributeHandler is a Build handler that makes sure a
+// ReceiveMessage request asks for the reserved attributes, which is how
+// offloaded and compressed messages are recognised.
+func (c *SQSExtended) receivePayloadAttributeHandler(r *request.Request) {
+	in := r.Params.(*ReceiveMessageInput)
+	for _, name := range in.MessageAttributeNames {
+		switch aws.StringValue(name) {
+		case "All", ".*":
+			return
+		}
+	}
+
+	params := *in
+	params.MessageAttributeNames = append(append([]*string{}, in.MessageAttributeNames...),
+		aws.String(ReservedAttributeName), aws.String(LegacyReservedAttributeName),
+		aws.String(CompressionAttributeName), aws.String(EncryptionAttributeName))
+	r.Params = &params
+}
+
+// resolvePayloadsHandler is an Unmarshal handler that replaces the body of
+// each received message that carries a reserved attribute with the payload
+// it points to, and strips the attribute. Messages whose payload cannot be
+// retrieved are dropped from the output and reported in a batched error.
+func (c *SQSExtended) resolvePayloadsHandler(r *request.Request) {
+	if r.Error != nil {
+		return
+	}
+	out := r.Data.(*ReceiveMessageOutput)
+
+	var errs []error
+	msgs := out.Messages[:0]
+	for _, msg := range out.Messages {
+		if err := c.resolvePayload(r.Context(), msg); err != nil {
+			errs = append(errs, &MessagePayloadError{
+				MessageId:     aws.StringValue(msg.MessageId),
+				ReceiptHandle: aws.StringValue(msg.ReceiptHandle),
+				Err:           err,
+			})
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	out.Messages = msgs
+
+	if len(errs) > 0 {
+		// The messages have already been received; retrying would hide them
+		// for another visibility timeout.
+		r.Retryable = aws.Bool(false)
+		r.Error = awserr.NewBatchError(ErrCodeRetrievePayload,
+			"failed to retrieve offloaded message payloads", errs)
+	}
+}
+
+// resolvePayload restores the original body of msg, retrieving its offloaded
+// payload if the message carries either of the reserved attributes, and
+// decrypting and decompressing it if the message was encrypted or compressed.
+func (c *SQSExtended) resolvePayload(ctx aws.Context, msg *Message) error {
+	if isOffloaded(msg.MessageAttributes) {
+		if err := c.retrievePayload(ctx, msg); err != nil {
+			return err
+		}
+	}
+	if err := c.decryptBody(ctx, msg); err != nil {
+		return err
+	}
+	return c.decompressBody(msg)
+}
+
+// retrievePayload replaces the body of msg with the payload it points to,
+// after checking the payload against the digest recorded in the data type of
+// the reserved attribute, if there is one. Messages sent by the Java extended
+// client do not have one.
+func (c *SQSExtended) retrievePayload(ctx aws.Context, msg *Message) error {
+	store := c.store
+	if store == nil {
+		return fmt.Errorf("large payload support is not enabled")
+	}
+
+	var pointer PayloadPointer
+	if err := json.Unmarshal([]byte(aws.StringValue(msg.Body)), &pointer); err != nil {
+		return fmt.Errorf("invalid payload pointer: %v", err)
+	}
+
+	body, err := store.GetPayload(ctx, pointer)
+	if err != nil {
+		return &PayloadStoreError{Op: "GetPayload", Pointer: pointer, Err: err}
+	}
+	if expected, ok := recordedDigest(msg.MessageAttributes); ok {
+		if digest := payloadDigest(body); !strings.EqualFold(digest, expected) {
+			return &PayloadDigestError{Pointer: pointer, Expected: expected, Digest: digest}
+		}
+	}
+
+	msg.MessageAttributes = withoutAttributes(msg.MessageAttributes, ReservedAttributeName, LegacyReservedAttributeName)
+	msg.Body = aws.String(body)
+	msg.ReceiptHandle = aws.String(wrapReceiptHandle(aws.StringValue(msg.ReceiptHandle), pointer))
+	return nil
+}
+
+// isOffloaded reports whether attrs mark a message whose payload is in a
+// payload store.
+func isOffloaded(attrs map[string]*MessageAttributeValue) bool {
+	if _, ok := attrs[ReservedAttributeName]; ok {
+		return true
+	}
+	_, ok := attrs[LegacyReservedAttributeName]
+	return ok
+}
+
+// recordedDigest returns the payload digest recorded in the data type of the
+// reserved attribute of attrs, if any.
+func recordedDigest(attrs map[string]*MessageAttributeValue) (string, bool) {
+	attr, ok := attrs[ReservedAttributeName]
+	if !ok {
+		return "", false
+	}
+	dataType := aws.StringValue(attr.DataType)
+	if !strings.HasPrefix(dataType, payloadDigestDataType) {
+		return "", false
+	}
+	return strings.TrimPrefix(dataType, payloadDigestDataType), true
+}
+
+// withPayloadAttributes returns a copy of attrs with the reserved attribute
+// set to the size of the offloaded payload, labelled with its SHA-256 digest.
+func withPayloadAttributes(attrs map[string]*MessageAttributeValue, payload string) map[string]*MessageAttributeValue {
+	out := make(map[string]*MessageAttributeValue, len(attrs)+1)
+	for k, v := range attrs {
+		out[k] = v
+	}
+	out[ReservedAttributeName] = &MessageAttributeValue{
+		DataType:    aws.String(payloadDigestDataType + payloadDigest(payload)),
+		StringValue: aws.String(strconv.Itoa(len(payload))),
+	}
+	return out
+}
+
+// withoutAttributes returns a copy of attrs without the named attributes.
+func withoutAttributes(attrs map[string]*MessageAttributeValue, names ...string) map[string]*MessageAttributeValue {
+	out := make(map[string]*MessageAttributeValue, len(attrs))
+	for k, v := range attrs {
+		out[k] = v
+	}
+	for _, name := range names {
+		delete(out, name)
+	}
+	return out
+}
+
+// bodyTransform rewrites a message body and attributes before it is sent. ok
+// is false if the message is to be sent as it is.
+type bodyTransform func(body *string, attrs map[string]*MessageAttributeValue) (*string, map[string]*MessageAttributeValue, bool, error)
+
+// transformSendMessage applies fn to the message of a SendMessage request,
+// leaving the caller's input untouched.
+func transformSendMessage(r *request.Request, fn bodyTransform) {
+	in := r.Params.(*SendMessageInput)
+	body, attrs, ok, err := fn(in.MessageBody, in.MessageAttributes)
+	if err != nil {
+		r.Error = err
+		return
+	}
+	if !ok {
+		return
+	}
+
+	params := *in
+	params.MessageBody = body
+	params.MessageAttributes = attrs
+	r.Params = &params
+}
+
+// transformSendMessageBatch applies fn to each entry of a SendMessageBatch
+// request, leaving the caller's input untouched.
+func transformSendMessageBatch(r *request.Request, fn bodyTransform) {
+	in := r.Params.(*SendMessageBatchInput)
+	transformed := false
+	entries := make([]*SendMessageBatchRequestEntry, len(in.Entries))
+	for i, e := range in.Entries {
+		entries[i] = e
+		if e == nil {
+			continue
+		}
+		body, attrs, ok, err := fn(e.MessageBody, e.MessageAttributes)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		if !ok {
+			continue
+		}
+		entry := *e
+		entry.MessageBody = body
+		entry.MessageAttributes = attrs
+		entries[i] = &entry
+		transformed = true
+	}
+	if !transformed {
+		return
+	}
+
+	params := *in
+	params.Entries = entries
+	r.Params = &params
+}
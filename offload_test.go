@@ -0,0 +1,623 @@
+package sqsextendedclient_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendedtest"
+)
+
+func TestSendMessageOffload(t *testing.T) {
+	attr := &sqsextendedclient.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(strings.Repeat("a", 100)),
+	}
+	cases := map[string]struct {
+		Body      string
+		Attrs     map[string]*sqsextendedclient.MessageAttributeValue
+		Offloaded bool
+	}{
+		"small": {
+			Body: "hello",
+		},
+		"at threshold": {
+			Body: strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold),
+		},
+		"over threshold": {
+			Body:      strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold+1),
+			Offloaded: true,
+		},
+		"over threshold with attributes": {
+			Body:      strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold-100),
+			Attrs:     map[string]*sqsextendedclient.MessageAttributeValue{"attr": attr},
+			Offloaded: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakes(t)
+
+			input := &sqsextendedclient.SendMessageInput{
+				QueueUrl:          aws.String(f.queueURL),
+				MessageBody:       aws.String(c.Body),
+				MessageAttributes: c.Attrs,
+			}
+			if _, err := f.svc.SendMessage(input); err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if aws.StringValue(input.MessageBody) != c.Body {
+				t.Errorf("expect input body to be left untouched")
+			}
+			if e, a := len(c.Attrs), len(input.MessageAttributes); e != a {
+				t.Errorf("expect %v input attributes, got %v", e, a)
+			}
+
+			msgs := f.receiveRaw(t)
+			if e, a := 1, len(msgs); e != a {
+				t.Fatalf("expect %v message, got %v", e, a)
+			}
+			msg := msgs[0]
+			keys := f.s3.Keys(testBucket)
+
+			if !c.Offloaded {
+				if aws.StringValue(msg.Body) != c.Body {
+					t.Errorf("expect body to be sent inline")
+				}
+				if _, ok := msg.MessageAttributes[sqsextendedclient.ReservedAttributeName]; ok {
+					t.Errorf("expect no %s attribute", sqsextendedclient.ReservedAttributeName)
+				}
+				if e, a := 0, len(keys); e != a {
+					t.Errorf("expect %v payloads, got %v", e, a)
+				}
+				return
+			}
+
+			var pointer sqsextendedclient.PayloadPointer
+			if err := json.Unmarshal([]byte(aws.StringValue(msg.Body)), &pointer); err != nil {
+				t.Fatalf("expect body to be a payload pointer, got %v", err)
+			}
+			if e, a := testBucket, pointer.S3BucketName; e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			payload, ok := f.s3.Object(testBucket, pointer.S3Key)
+			if !ok {
+				t.Fatalf("expect payload %v to be stored, got %v", pointer.S3Key, keys)
+			}
+			if string(payload) != c.Body {
+				t.Errorf("expect payload to be the message body")
+			}
+
+			size := msg.MessageAttributes[sqsextendedclient.ReservedAttributeName]
+			if size == nil {
+				t.Fatalf("expect %s attribute", sqsextendedclient.ReservedAttributeName)
+			}
+			sum := sha256.Sum256([]byte(c.Body))
+			if e, a := "Number.sha256-"+hex.EncodeToString(sum[:]), aws.StringValue(size.DataType); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			if e, a := strconv.Itoa(len(c.Body)), aws.StringValue(size.StringValue); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			for name := range c.Attrs {
+				if _, ok := msg.MessageAttributes[name]; !ok {
+					t.Errorf("expect attribute %v to be sent", name)
+				}
+			}
+		})
+	}
+}
+
+func TestSendMessageOffloadStoreError(t *testing.T) {
+	f := newFakes(t)
+	f.s3.InjectFault(sqsextendedtest.Fault{Method: "PUT", Key: "*", StatusCode: 500})
+
+	_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String(strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold+1)),
+	})
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if e, a := sqsextendedclient.ErrCodeStorePayload, err.(awserr.Error).Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 0, len(f.receiveRaw(t)); e != a {
+		t.Errorf("expect %v messages to be sent, got %v", e, a)
+	}
+}
+
+func TestReceiveMessageResolvesPayloads(t *testing.T) {
+	f := newFakes(t)
+
+	large := strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold+1)
+	attrs := map[string]*sqsextendedclient.MessageAttributeValue{
+		"attr": {DataType: aws.String("String"), StringValue: aws.String("value")},
+	}
+	for _, body := range []string{"small", large} {
+		_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+			QueueUrl:          aws.String(f.queueURL),
+			MessageBody:       aws.String(body),
+			MessageAttributes: attrs,
+		})
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+	}
+
+	out, err := f.svc.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+		QueueUrl:              aws.String(f.queueURL),
+		MaxNumberOfMessages:   aws.Int64(10),
+		MessageAttributeNames: []*string{aws.String("attr")},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 2, len(out.Messages); e != a {
+		t.Fatalf("expect %v messages, got %v", e, a)
+	}
+	bodies := map[string]bool{}
+	for _, msg := range out.Messages {
+		bodies[aws.StringValue(msg.Body)] = true
+		if _, ok := msg.MessageAttributes[sqsextendedclient.ReservedAttributeName]; ok {
+			t.Errorf("expect %s attribute to be stripped", sqsextendedclient.ReservedAttributeName)
+		}
+		if e, a := "value", aws.StringValue(msg.MessageAttributes["attr"].StringValue); e != a {
+			t.Errorf("expect %v, got %v", e, a)
+		}
+	}
+	if !bodies["small"] || !bodies[large] {
+		t.Errorf("expect original bodies to be received")
+	}
+}
+
+func TestReceiveMessageAlwaysThroughS3MixedBatch(t *testing.T) {
+	always := func(c *sqsextendedclient.ExtendedClientConfiguration) {
+		c.WithAlwaysThroughS3(true)
+	}
+
+	// Consumers resolve every message in the batch, whatever their own
+	// offload settings.
+	cases := map[string][]func(*sqsextendedclient.ExtendedClientConfiguration){
+		"default consumer":           nil,
+		"always through S3 consumer": {always},
+	}
+
+	for name, options := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakes(t)
+			producer := f.newClient(t, always)
+
+			// The producer offloads even small messages; the client under
+			// test sends small messages inline.
+			for _, send := range []struct {
+				svc  *sqsextendedclient.SQSExtended
+				body string
+			}{
+				{f.svc, "inline 1"},
+				{producer, "offloaded 1"},
+				{f.svc, "inline 2"},
+				{producer, "offloaded 2"},
+			} {
+				_, err := send.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+					QueueUrl:    aws.String(f.queueURL),
+					MessageBody: aws.String(send.body),
+				})
+				if err != nil {
+					t.Fatalf("expect no error, got %v", err)
+				}
+			}
+			if e, a := 2, len(f.s3.Keys(testBucket)); e != a {
+				t.Fatalf("expect %v payloads, got %v", e, a)
+			}
+
+			consumer := f.newClient(t, options...)
+			out, err := consumer.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+				QueueUrl:            aws.String(f.queueURL),
+				MaxNumberOfMessages: aws.Int64(10),
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := 4, len(out.Messages); e != a {
+				t.Fatalf("expect %v messages in one batch, got %v", e, a)
+			}
+
+			var entries []*sqsextendedclient.DeleteMessageBatchRequestEntry
+			received := map[string]bool{}
+			for i, msg := range out.Messages {
+				body := aws.StringValue(msg.Body)
+				received[body] = true
+
+				_, _, wrapped := sqsextendedclient.UnwrapReceiptHandle(aws.StringValue(msg.ReceiptHandle))
+				if e, a := strings.HasPrefix(body, "offloaded"), wrapped; e != a {
+					t.Errorf("expect receipt handle of %q wrapped %v, got %v", body, e, a)
+				}
+				if _, ok := msg.MessageAttributes[sqsextendedclient.ReservedAttributeName]; ok {
+					t.Errorf("expect %s attribute of %q to be stripped", sqsextendedclient.ReservedAttributeName, body)
+				}
+				entries = append(entries, &sqsextendedclient.DeleteMessageBatchRequestEntry{
+					Id:            aws.String(strconv.Itoa(i)),
+					ReceiptHandle: msg.ReceiptHandle,
+				})
+			}
+			for _, body := range []string{"inline 1", "inline 2", "offloaded 1", "offloaded 2"} {
+				if !received[body] {
+					t.Errorf("expect %q to be received, got %v", body, received)
+				}
+			}
+
+			deleted, err := consumer.DeleteMessageBatch(&sqsextendedclient.DeleteMessageBatchInput{
+				QueueUrl: aws.String(f.queueURL),
+				Entries:  entries,
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := 4, len(deleted.Successful); e != a {
+				t.Errorf("expect %v successful entries, got %v", e, a)
+			}
+			if keys := f.s3.Keys(testBucket); len(keys) != 0 {
+				t.Errorf("expect payloads to be deleted, got %v", keys)
+			}
+			if e, a := 0, f.messages(t); e != a {
+				t.Errorf("expect %v messages, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestReceiveMessageRetrieveError(t *testing.T) {
+	f := newFakes(t)
+
+	for _, body := range []string{"small", strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold+1)} {
+		_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+			QueueUrl:    aws.String(f.queueURL),
+			MessageBody: aws.String(body),
+		})
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+	}
+	keys := f.s3.Keys(testBucket)
+	if e, a := 1, len(keys); e != a {
+		t.Fatalf("expect %v payload, got %v", e, a)
+	}
+	f.s3.RemoveObject(testBucket, keys[0])
+
+	out, err := f.svc.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+		QueueUrl:            aws.String(f.queueURL),
+		MaxNumberOfMessages: aws.Int64(10),
+	})
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if e, a := sqsextendedclient.ErrCodeRetrievePayload, err.(awserr.Error).Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 1, len(out.Messages); e != a {
+		t.Fatalf("expect %v message, got %v", e, a)
+	}
+	if e, a := "small", aws.StringValue(out.Messages[0].Body); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	errs := err.(awserr.BatchedErrors).OrigErrs()
+	if e, a := 1, len(errs); e != a {
+		t.Fatalf("expect %v errors, got %v", e, a)
+	}
+	msgErr, ok := errs[0].(*sqsextendedclient.MessagePayloadError)
+	if !ok {
+		t.Fatalf("expect *MessagePayloadError, got %T", errs[0])
+	}
+	if len(msgErr.MessageId) == 0 || len(msgErr.ReceiptHandle) == 0 {
+		t.Errorf("expect message id and receipt handle, got %#v", msgErr)
+	}
+	storeErr, ok := msgErr.Err.(*sqsextendedclient.PayloadStoreError)
+	if !ok {
+		t.Fatalf("expect *PayloadStoreError, got %T", msgErr.Err)
+	}
+	if e, a := keys[0], storeErr.Pointer.S3Key; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+}
+
+func TestSendMessageBatchOffload(t *testing.T) {
+	f := newFakes(t)
+
+	medium := strings.Repeat("m", 100*1024)
+	bodies := []string{"small", strings.Repeat("x", largeSize), medium, medium, medium}
+	input := &sqsextendedclient.SendMessageBatchInput{
+		QueueUrl: aws.String(f.queueURL),
+	}
+	for i, body := range bodies {
+		input.Entries = append(input.Entries, &sqsextendedclient.SendMessageBatchRequestEntry{
+			Id:          aws.String(strconv.Itoa(i)),
+			MessageBody: aws.String(body),
+		})
+	}
+	out, err := f.svc.SendMessageBatch(input)
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := len(bodies), len(out.Successful); e != a {
+		t.Fatalf("expect %v successful entries, got %v", e, a)
+	}
+	for i, entry := range input.Entries {
+		if aws.StringValue(entry.MessageBody) != bodies[i] {
+			t.Errorf("expect input entry %d to be left untouched", i)
+		}
+	}
+
+	// The entry over the threshold is offloaded, followed by the largest
+	// remaining entry, which brings the batch under the aggregate limit.
+	offloaded := 0
+	for _, msg := range f.receiveRaw(t) {
+		if _, ok := msg.MessageAttributes[sqsextendedclient.ReservedAttributeName]; ok {
+			offloaded++
+		}
+	}
+	if e, a := 2, offloaded; e != a {
+		t.Errorf("expect %v offloaded messages, got %v", e, a)
+	}
+	if e, a := 2, len(f.s3.Keys(testBucket)); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+
+	received := map[string]int{}
+	for _, msg := range f.receive(t).Messages {
+		received[aws.StringValue(msg.Body)]++
+	}
+	for _, body := range bodies {
+		if received[body] == 0 {
+			t.Errorf("expect body of %d bytes to be received", len(body))
+		}
+	}
+}
+
+func TestSendMessageBatchDeletesFailedPayloads(t *testing.T) {
+	f := newFakes(t)
+
+	// A MessageGroupId is not valid for a standard queue, so SQS fails the
+	// second entry.
+	out, err := f.svc.SendMessageBatch(&sqsextendedclient.SendMessageBatchInput{
+		QueueUrl: aws.String(f.queueURL),
+		Entries: []*sqsextendedclient.SendMessageBatchRequestEntry{
+			{Id: aws.String("ok"), MessageBody: aws.String(strings.Repeat("x", largeSize))},
+			{Id: aws.String("failed"), MessageBody: aws.String(strings.Repeat("x", largeSize)), MessageGroupId: aws.String("group")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 1, len(out.Failed); e != a {
+		t.Fatalf("expect %v failed entry, got %v", e, a)
+	}
+	if e, a := "failed", aws.StringValue(out.Failed[0].Id); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 1, len(f.s3.Keys(testBucket)); e != a {
+		t.Errorf("expect %v payload, got %v", e, a)
+	}
+}
+
+func TestSendMessageBatchRequestError(t *testing.T) {
+	cases := map[string]struct {
+		Setup    func(f *fakes, r *request.Request)
+		Payloads int
+	}{
+		"rejected by SQS": {
+			Setup: func(f *fakes, r *request.Request) {
+				r.Params.(*sqsextendedclient.SendMessageBatchInput).QueueUrl = aws.String(f.sqs.QueueURL("missing"))
+			},
+		},
+		"connection refused": {
+			Setup: func(f *fakes, r *request.Request) {
+				f.sqs.Close()
+			},
+		},
+		"response timed out": {
+			Setup: func(f *fakes, r *request.Request) {
+				r.Handlers.Unmarshal.PushBack(func(r *request.Request) {
+					r.Error = awserr.NewRequestFailure(
+						awserr.New(request.ErrCodeResponseTimeout, "read on body has reached the timeout limit", nil),
+						200, r.RequestID)
+				})
+			},
+			Payloads: 1,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakes(t)
+
+			req, _ := f.svc.SendMessageBatchRequest(&sqsextendedclient.SendMessageBatchInput{
+				QueueUrl: aws.String(f.queueURL),
+				Entries: []*sqsextendedclient.SendMessageBatchRequestEntry{
+					{Id: aws.String("0"), MessageBody: aws.String(strings.Repeat("x", largeSize))},
+				},
+			})
+			c.Setup(f, req)
+			if err := req.Send(); err == nil {
+				t.Fatalf("expect error, got nil")
+			}
+			if e, a := c.Payloads, len(f.s3.Keys(testBucket)); e != a {
+				t.Fatalf("expect %v payloads, got %v", e, a)
+			}
+			if c.Payloads == 0 {
+				return
+			}
+
+			// The batch was enqueued, so the message must still resolve.
+			msgs := f.receive(t).Messages
+			if e, a := 1, len(msgs); e != a {
+				t.Fatalf("expect %v message, got %v", e, a)
+			}
+			if e, a := largeSize, len(aws.StringValue(msgs[0].Body)); e != a {
+				t.Errorf("expect body of %v bytes, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestReceiveMessagePayloadDigest(t *testing.T) {
+	body := strings.Repeat("x", largeSize)
+	sum := sha256.Sum256([]byte(body))
+	cases := map[string]struct {
+		DataType string
+		Err      bool
+	}{
+		"digest": {
+			DataType: "Number.sha256-" + hex.EncodeToString(sum[:]),
+		},
+		"wrong digest": {
+			DataType: "Number.sha256-" + strings.Repeat("0", 64),
+			Err:      true,
+		},
+		// Messages sent by the Java extended client carry no digest, and
+		// are not verified.
+		"no digest": {
+			DataType: "Number",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakes(t)
+			f.s3.SetObject(testBucket, "payload", []byte(body))
+			pointer := sqsextendedclient.PayloadPointer{S3BucketName: testBucket, S3Key: "payload"}
+			_, err := f.raw.SendMessage(&sqs.SendMessageInput{
+				QueueUrl:    aws.String(f.queueURL),
+				MessageBody: aws.String(pointer.String()),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					sqsextendedclient.ReservedAttributeName: {
+						DataType:    aws.String(c.DataType),
+						StringValue: aws.String(strconv.Itoa(len(body))),
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+
+			out, err := f.svc.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+				QueueUrl:              aws.String(f.queueURL),
+				MessageAttributeNames: []*string{aws.String("All")},
+			})
+			if c.Err {
+				if err == nil {
+					t.Fatalf("expect error, got nil")
+				}
+				msgErr := err.(awserr.BatchedErrors).OrigErrs()[0].(*sqsextendedclient.MessagePayloadError)
+				if _, ok := msgErr.Err.(*sqsextendedclient.PayloadDigestError); !ok {
+					t.Errorf("expect *PayloadDigestError, got %T", msgErr.Err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			msg := out.Messages[0]
+			if e, a := body, aws.StringValue(msg.Body); e != a {
+				t.Errorf("expect body of %v bytes, got %v bytes", len(e), len(a))
+			}
+			if _, ok := msg.MessageAttributes[sqsextendedclient.ReservedAttributeName]; ok {
+				t.Errorf("expect %s attribute to be stripped", sqsextendedclient.ReservedAttributeName)
+			}
+		})
+	}
+}
+
+func TestReceiveMessagePayloadDigestMismatch(t *testing.T) {
+	f := newFakes(t)
+	body := f.sendLarge(t)
+	key := f.s3.Keys(testBucket)[0]
+	f.s3.SetObject(testBucket, key, []byte(body[:len(body)/2]))
+
+	out, err := f.svc.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+		QueueUrl: aws.String(f.queueURL),
+	})
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if e, a := 0, len(out.Messages); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+	msgErr := err.(awserr.BatchedErrors).OrigErrs()[0].(*sqsextendedclient.MessagePayloadError)
+	digestErr, ok := msgErr.Err.(*sqsextendedclient.PayloadDigestError)
+	if !ok {
+		t.Fatalf("expect *PayloadDigestError, got %T", msgErr.Err)
+	}
+	if e, a := key, digestErr.Pointer.S3Key; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	sum := sha256.Sum256([]byte(body))
+	if e, a := hex.EncodeToString(sum[:]), digestErr.Expected; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if digestErr.Digest == digestErr.Expected {
+		t.Errorf("expect digests to differ")
+	}
+}
+
+func TestSendMessageReservedAttributes(t *testing.T) {
+	attrs := func(n int, names ...string) map[string]*sqsextendedclient.MessageAttributeValue {
+		out := map[string]*sqsextendedclient.MessageAttributeValue{}
+		for i := 0; i < n; i++ {
+			names = append(names, "attr"+strconv.Itoa(i))
+		}
+		for _, name := range names {
+			out[name] = &sqsextendedclient.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String("v")}
+		}
+		return out
+	}
+	cases := map[string]struct {
+		Attrs map[string]*sqsextendedclient.MessageAttributeValue
+		Err   bool
+	}{
+		"room for the reserved attribute": {
+			Attrs: attrs(sqsextendedclient.MaxAllowedAttributes),
+		},
+		"no room for the reserved attribute": {
+			Attrs: attrs(sqsextendedclient.MaxAllowedAttributes + 1),
+			Err:   true,
+		},
+		"reserved attribute": {
+			Attrs: attrs(0, sqsextendedclient.ReservedAttributeName),
+			Err:   true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakes(t)
+			_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+				QueueUrl:          aws.String(f.queueURL),
+				MessageBody:       aws.String(strings.Repeat("x", largeSize)),
+				MessageAttributes: c.Attrs,
+			})
+			if !c.Err {
+				if err != nil {
+					t.Fatalf("expect no error, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expect error, got nil")
+			}
+			if e, a := request.InvalidParameterErrCode, err.(awserr.Error).Code(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+		})
+	}
+}
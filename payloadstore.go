@@ -0,0 +1,153 @@
+package sqsextendedclient
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// PayloadStore stores the payloads of messages that are offloaded from SQS.
+// The offload logic of SQSExtended talks to S3 through S3PayloadStore; other
+// implementations can be set with ExtendedClientConfiguration.WithPayloadStore.
+//
+// Implementations must be safe for concurrent use.
+type PayloadStore interface {
+	// PutPayload stores payload and returns a pointer to it.
+	PutPayload(ctx aws.Context, payload string) (PayloadPointer, error)
+
+	// GetPayload returns the payload pointer refers to.
+	GetPayload(ctx aws.Context, pointer PayloadPointer) (string, error)
+
+	// DeletePayload deletes the payload pointer refers to.
+	DeletePayload(ctx aws.Context, pointer PayloadPointer) error
+}
+
+// PayloadStoreError is returned when an operation on the PayloadStore fails.
+// It implements awserr.Error with code ErrCodeStorePayload,
+// ErrCodeRetrievePayload or ErrCodeDeletePayload, depending on the operation,
+// so that payload store failures can be told apart from SQS failures.
+type PayloadStoreError struct {
+	// Op is the PayloadStore method that failed: "PutPayload", "GetPayload"
+	// or "DeletePayload".
+	Op string
+
+	// Pointer to the payload. Empty for PutPayload.
+	Pointer PayloadPointer
+
+	// Err is the error returned by the store.
+	Err error
+}
+
+// Code returns the error code for the failed operation.
+func (e *PayloadStoreError) Code() string {
+	switch e.Op {
+	case "PutPayload":
+		return ErrCodeStorePayload
+	case "GetPayload":
+		return ErrCodeRetrievePayload
+	default:
+		return ErrCodeDeletePayload
+	}
+}
+
+// Message returns a description of the failed operation.
+func (e *PayloadStoreError) Message() string {
+	switch e.Op {
+	case "PutPayload":
+		return "failed to store message payload"
+	case "GetPayload":
+		return fmt.Sprintf("failed to retrieve message payload %s/%s", e.Pointer.S3BucketName, e.Pointer.S3Key)
+	default:
+		return fmt.Sprintf("failed to delete message payload %s/%s", e.Pointer.S3BucketName, e.Pointer.S3Key)
+	}
+}
+
+// Error returns the string representation of the error.
+func (e *PayloadStoreError) Error() string {
+	return awserr.SprintError(e.Code(), e.Message(), "", e.Err)
+}
+
+// OrigErr returns the error returned by the store.
+func (e *PayloadStoreError) OrigErr() error {
+	return e.Err
+}
+
+var _ awserr.Error = (*PayloadStoreError)(nil)
+
+// Class names the Java Amazon SQS Extended Client Library tags pointers with.
+const (
+	payloadS3PointerClass       = "software.amazon.payloadoffloading.PayloadS3Pointer"
+	legacyPayloadS3PointerClass = "com.amazon.sqs.javamessaging.MessageS3Pointer"
+)
+
+// PayloadPointer locates a payload in a PayloadStore. It is sent to SQS in
+// place of the payload, and embedded in the receipt handles of the message.
+//
+// The fields are named after the S3 bucket and key for compatibility with the
+// Java extended client. Stores other than S3PayloadStore use S3BucketName to
+// identify the store and S3Key to identify the payload within it.
+//
+// A pointer is encoded the way the Java extended client encodes it, as a class
+// name and object pair:
+//
+//	["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket","s3Key":"key"}]
+type PayloadPointer struct {
+	S3BucketName string `json:"s3BucketName"`
+	S3Key        string `json:"s3Key"`
+}
+
+// String returns the JSON encoding of the pointer.
+func (p PayloadPointer) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// MarshalJSON encodes the pointer with the Java class name.
+func (p PayloadPointer) MarshalJSON() ([]byte, error) {
+	type fields PayloadPointer
+	return json.Marshal([]interface{}{payloadS3PointerClass, fields(p)})
+}
+
+// UnmarshalJSON decodes a pointer written by this client or by either major
+// version of the Java extended client. A bare object without class name is
+// accepted as well.
+func (p *PayloadPointer) UnmarshalJSON(b []byte) error {
+	type fields PayloadPointer
+	var f fields
+	if err := json.Unmarshal(b, &f); err == nil {
+		*p = PayloadPointer(f)
+		return p.validate()
+	}
+
+	var tuple []json.RawMessage
+	if err := json.Unmarshal(b, &tuple); err != nil {
+		return err
+	}
+	if len(tuple) != 2 {
+		return fmt.Errorf("expected class name and object, got %d elements", len(tuple))
+	}
+	var class string
+	if err := json.Unmarshal(tuple[0], &class); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(tuple[1], &f); err != nil {
+		return err
+	}
+	switch class {
+	case payloadS3PointerClass, legacyPayloadS3PointerClass:
+	default:
+		return fmt.Errorf("unknown pointer class %q", class)
+	}
+	*p = PayloadPointer(f)
+	return p.validate()
+}
+
+// validate checks that the pointer refers to a payload.
+func (p PayloadPointer) validate() error {
+	if len(p.S3BucketName) == 0 || len(p.S3Key) == 0 {
+		return fmt.Errorf("pointer is missing s3BucketName or s3Key")
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package sqsextendedclient_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+func TestPayloadStoreRoundTrip(t *testing.T) {
+	cases := map[string]struct {
+		Store func(*testing.T) sqsextendedclient.PayloadStore
+		Name  string
+	}{
+		"memory": {
+			Store: func(t *testing.T) sqsextendedclient.PayloadStore {
+				return sqsextendedclient.NewMemoryPayloadStore("memory")
+			},
+			Name: "memory",
+		},
+		"file": {
+			Store: func(t *testing.T) sqsextendedclient.PayloadStore {
+				store, err := sqsextendedclient.NewFilePayloadStore("files", t.TempDir())
+				if err != nil {
+					t.Fatalf("expect no error, got %v", err)
+				}
+				return store
+			},
+			Name: "files",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			store := c.Store(t)
+			f := newFakes(t, func(config *sqsextendedclient.ExtendedClientConfiguration) {
+				config.WithPayloadStore(store)
+			})
+			ctx := aws.BackgroundContext()
+
+			body := strings.Repeat("x", largeSize)
+			_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+				QueueUrl:    aws.String(f.queueURL),
+				MessageBody: aws.String(body),
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if keys := f.s3.Keys(testBucket); len(keys) != 0 {
+				t.Errorf("expect no S3 objects, got %v", keys)
+			}
+
+			raw := f.receiveRaw(t)
+			if e, a := 1, len(raw); e != a {
+				t.Fatalf("expect %v messages, got %v", e, a)
+			}
+			var pointer sqsextendedclient.PayloadPointer
+			if err := json.Unmarshal([]byte(aws.StringValue(raw[0].Body)), &pointer); err != nil {
+				t.Fatalf("expect body to be a payload pointer, got %v", err)
+			}
+			if e, a := c.Name, pointer.S3BucketName; e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			payload, err := store.GetPayload(ctx, pointer)
+			if err != nil {
+				t.Fatalf("expect payload to be stored, got %v", err)
+			}
+			if payload != body {
+				t.Errorf("expect payload to be the message body")
+			}
+
+			out := f.receive(t)
+			if e, a := 1, len(out.Messages); e != a {
+				t.Fatalf("expect %v messages, got %v", e, a)
+			}
+			if aws.StringValue(out.Messages[0].Body) != body {
+				t.Errorf("expect message body to be resolved from the store")
+			}
+
+			_, err = f.svc.DeleteMessage(&sqsextendedclient.DeleteMessageInput{
+				QueueUrl:      aws.String(f.queueURL),
+				ReceiptHandle: out.Messages[0].ReceiptHandle,
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if _, err := store.GetPayload(ctx, pointer); err == nil {
+				t.Errorf("expect payload to be deleted")
+			}
+			if e, a := 0, f.messages(t); e != a {
+				t.Errorf("expect %v messages, got %v", e, a)
+			}
+		})
+	}
+}
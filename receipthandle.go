@@ -0,0 +1,193 @@
+package sqsextendedclient
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// ErrCodeDeletePayload is the error code returned when a message was deleted
+// from SQS but its offloaded payload could not be deleted from the payload
+// store.
+const ErrCodeDeletePayload = "DeletePayloadError"
+
+// wrapReceiptHandle embeds the location of an offloaded payload in a receipt
+// handle, so that it can be found again when the message is deleted.
+func wrapReceiptHandle(handle string, pointer PayloadPointer) string {
+	return S3BucketNameMarker + pointer.S3BucketName + S3BucketNameMarker +
+		S3KeyMaker + pointer.S3Key + S3KeyMaker + handle
+}
+
+// unwrapReceiptHandle returns the original receipt handle and payload location
+// embedded in handle by wrapReceiptHandle. ok is false if handle was not
+// wrapped, or the markers are malformed.
+func unwrapReceiptHandle(handle string) (orig string, pointer PayloadPointer, ok bool) {
+	bucket, rest, ok := cutMarker(handle, S3BucketNameMarker)
+	if !ok {
+		return handle, PayloadPointer{}, false
+	}
+	key, rest, ok := cutMarker(rest, S3KeyMaker)
+	if !ok {
+		return handle, PayloadPointer{}, false
+	}
+	return rest, PayloadPointer{S3BucketName: bucket, S3Key: key}, true
+}
+
+// cutMarker returns the text enclosed by a pair of markers at the start of s,
+// and the remainder of s after the closing marker.
+func cutMarker(s, marker string) (enclosed, rest string, ok bool) {
+	if !strings.HasPrefix(s, marker) {
+		return "", s, false
+	}
+	s = s[len(marker):]
+	i := strings.Index(s, marker)
+	if i < 0 {
+		return "", s, false
+	}
+	return s[:i], s[i+len(marker):], true
+}
+
+// deleteMessageHandler is a Build handler that restores the original receipt
+// handle of a DeleteMessage request, and deletes the offloaded payload once
+// the message has been deleted from SQS.
+func (c *SQSExtended) deleteMessageHandler(r *request.Request) {
+	in := r.Params.(*DeleteMessageInput)
+	handle, pointer, ok := unwrapReceiptHandle(aws.StringValue(in.ReceiptHandle))
+	if !ok {
+		return
+	}
+
+	params := *in
+	params.ReceiptHandle = aws.String(handle)
+	r.Params = &params
+
+	r.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{
+		Name: "sqsextended.DeletePayload",
+		Fn: func(r *request.Request) {
+			if r.Error != nil {
+				return
+			}
+			if err := c.deletePayload(r.Context(), pointer); err != nil {
+				r.Retryable = aws.Bool(false)
+				r.Error = err
+			}
+		},
+	})
+}
+
+// deleteMessageBatchHandler is a Build handler that restores the original
+// receipt handles of a DeleteMessageBatch request, and deletes the offloaded
+// payloads of the entries SQS reports as successfully deleted.
+func (c *SQSExtended) deleteMessageBatchHandler(r *request.Request) {
+	in := r.Params.(*DeleteMessageBatchInput)
+
+	pointers := map[string]PayloadPointer{}
+	entries := make([]*DeleteMessageBatchRequestEntry, len(in.Entries))
+	for i, e := range in.Entries {
+		entries[i] = e
+		if e == nil {
+			continue
+		}
+		handle, pointer, ok := unwrapReceiptHandle(aws.StringValue(e.ReceiptHandle))
+		if !ok {
+			continue
+		}
+		entry := *e
+		entry.ReceiptHandle = aws.String(handle)
+		entries[i] = &entry
+		pointers[aws.StringValue(e.Id)] = pointer
+	}
+	if len(pointers) == 0 {
+		return
+	}
+
+	params := *in
+	params.Entries = entries
+	r.Params = &params
+
+	r.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{
+		Name: "sqsextended.DeletePayloads",
+		Fn: func(r *request.Request) {
+			if r.Error != nil {
+				return
+			}
+			var errs []error
+			for _, res := range r.Data.(*DeleteMessageBatchOutput).Successful {
+				pointer, ok := pointers[aws.StringValue(res.Id)]
+				if !ok {
+					continue
+				}
+				if err := c.deletePayload(r.Context(), pointer); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			if len(errs) > 0 {
+				r.Retryable = aws.Bool(false)
+				r.Error = awserr.NewBatchError(ErrCodeDeletePayload,
+					"failed to delete offloaded message payloads", errs)
+			}
+		},
+	})
+}
+
+// changeMessageVisibilityHandler is a Build handler that restores the
+// original receipt handle of a ChangeMessageVisibility request.
+func (c *SQSExtended) changeMessageVisibilityHandler(r *request.Request) {
+	in := r.Params.(*ChangeMessageVisibilityInput)
+	handle, _, ok := unwrapReceiptHandle(aws.StringValue(in.ReceiptHandle))
+	if !ok {
+		return
+	}
+
+	params := *in
+	params.ReceiptHandle = aws.String(handle)
+	r.Params = &params
+}
+
+// changeMessageVisibilityBatchHandler is a Build handler that restores the
+// original receipt handles of a ChangeMessageVisibilityBatch request. Entry
+// Ids are left as they are, so the Successful and Failed entries of the
+// output refer to the caller's entries. Handles with malformed markers are
+// passed through, and reported by SQS as failed entries.
+func (c *SQSExtended) changeMessageVisibilityBatchHandler(r *request.Request) {
+	in := r.Params.(*ChangeMessageVisibilityBatchInput)
+
+	wrapped := false
+	entries := make([]*ChangeMessageVisibilityBatchRequestEntry, len(in.Entries))
+	for i, e := range in.Entries {
+		entries[i] = e
+		if e == nil {
+			continue
+		}
+		handle, _, ok := unwrapReceiptHandle(aws.StringValue(e.ReceiptHandle))
+		if !ok {
+			continue
+		}
+		entry := *e
+		entry.ReceiptHandle = aws.String(handle)
+		entries[i] = &entry
+		wrapped = true
+	}
+	if !wrapped {
+		return
+	}
+
+	params := *in
+	params.Entries = entries
+	r.Params = &params
+}
+
+// deletePayload deletes the payload pointer refers to from the payload store.
+func (c *SQSExtended) deletePayload(ctx aws.Context, pointer PayloadPointer) error {
+	store := c.store
+	if store == nil {
+		return awserr.New(ErrCodeDeletePayload, "large payload support is not enabled", nil)
+	}
+
+	if err := store.DeletePayload(ctx, pointer); err != nil {
+		return &PayloadStoreError{Op: "DeletePayload", Pointer: pointer, Err: err}
+	}
+	return nil
+}
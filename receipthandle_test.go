@@ -0,0 +1,198 @@
+package sqsextendedclient_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendedtest"
+)
+
+func TestReceiveMessageWrapsReceiptHandle(t *testing.T) {
+	f := newFakes(t)
+	f.sendLarge(t)
+	key := f.s3.Keys(testBucket)[0]
+
+	out := f.receive(t)
+	if e, a := 1, len(out.Messages); e != a {
+		t.Fatalf("expect %v message, got %v", e, a)
+	}
+	prefix := sqsextendedclient.S3BucketNameMarker + testBucket + sqsextendedclient.S3BucketNameMarker +
+		sqsextendedclient.S3KeyMaker + key + sqsextendedclient.S3KeyMaker
+	if a := aws.StringValue(out.Messages[0].ReceiptHandle); !strings.HasPrefix(a, prefix) || len(a) == len(prefix) {
+		t.Errorf("expect receipt handle to start with %v, got %v", prefix, a)
+	}
+}
+
+func TestDeleteMessageDeletesPayload(t *testing.T) {
+	f := newFakes(t)
+	f.sendLarge(t)
+	msg := f.receive(t).Messages[0]
+
+	_, err := f.svc.DeleteMessage(&sqsextendedclient.DeleteMessageInput{
+		QueueUrl:      aws.String(f.queueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 0, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+	if e, a := 0, len(f.s3.Keys(testBucket)); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+}
+
+func TestDeleteMessageDeletePayloadError(t *testing.T) {
+	f := newFakes(t)
+	f.sendLarge(t)
+	msg := f.receive(t).Messages[0]
+	f.s3.InjectFault(sqsextendedtest.Fault{Method: "DELETE", Key: "*", StatusCode: 403, Code: "AccessDenied"})
+
+	_, err := f.svc.DeleteMessage(&sqsextendedclient.DeleteMessageInput{
+		QueueUrl:      aws.String(f.queueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if e, a := sqsextendedclient.ErrCodeDeletePayload, err.(awserr.Error).Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 0, f.messages(t); e != a {
+		t.Errorf("expect message to be deleted from SQS, got %v messages", a)
+	}
+	if e, a := 1, len(f.s3.Keys(testBucket)); e != a {
+		t.Errorf("expect %v payload, got %v", e, a)
+	}
+}
+
+func TestDeleteMessageBatchDeletesPayloads(t *testing.T) {
+	f := newFakes(t)
+	f.sendLarge(t)
+	f.sendLarge(t)
+	_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String("small"),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	msgs := f.receive(t).Messages
+	if e, a := 3, len(msgs); e != a {
+		t.Fatalf("expect %v messages, got %v", e, a)
+	}
+
+	// The first offloaded message is deleted with an invalid receipt handle,
+	// so its payload must be kept.
+	var entries []*sqsextendedclient.DeleteMessageBatchRequestEntry
+	kept := ""
+	for i, msg := range msgs {
+		handle := aws.StringValue(msg.ReceiptHandle)
+		if len(kept) == 0 && strings.HasPrefix(handle, sqsextendedclient.S3BucketNameMarker) {
+			end := strings.LastIndex(handle, sqsextendedclient.S3KeyMaker) + len(sqsextendedclient.S3KeyMaker)
+			kept = handle[:end]
+			handle = kept + "invalid"
+		}
+		entries = append(entries, &sqsextendedclient.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(string(rune('a' + i))),
+			ReceiptHandle: aws.String(handle),
+		})
+	}
+	out, err := f.svc.DeleteMessageBatch(&sqsextendedclient.DeleteMessageBatchInput{
+		QueueUrl: aws.String(f.queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 2, len(out.Successful); e != a {
+		t.Errorf("expect %v successful entries, got %v", e, a)
+	}
+	if e, a := 1, len(out.Failed); e != a {
+		t.Fatalf("expect %v failed entry, got %v", e, a)
+	}
+	keys := f.s3.Keys(testBucket)
+	if e, a := 1, len(keys); e != a {
+		t.Fatalf("expect %v payload, got %v", e, a)
+	}
+	if !strings.Contains(kept, keys[0]) {
+		t.Errorf("expect payload of the failed entry to be kept, got %v", keys[0])
+	}
+}
+
+func TestChangeMessageVisibilityWrappedHandle(t *testing.T) {
+	f := newFakes(t)
+	f.sendLarge(t)
+	msg := f.receive(t).Messages[0]
+
+	_, err := f.svc.ChangeMessageVisibility(&sqsextendedclient.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(f.queueURL),
+		ReceiptHandle:     msg.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(0),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 1, len(f.receiveRaw(t)); e != a {
+		t.Errorf("expect message to be visible again, got %v messages", a)
+	}
+}
+
+func TestChangeMessageVisibilityBatchWrappedHandles(t *testing.T) {
+	f := newFakes(t)
+	f.sendLarge(t)
+	_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String("small"),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	msgs := f.receive(t).Messages
+	if e, a := 2, len(msgs); e != a {
+		t.Fatalf("expect %v messages, got %v", e, a)
+	}
+
+	entries := []*sqsextendedclient.ChangeMessageVisibilityBatchRequestEntry{
+		{
+			Id:                aws.String("invalid"),
+			ReceiptHandle:     aws.String(sqsextendedclient.S3BucketNameMarker + testBucket + sqsextendedclient.S3BucketNameMarker + "invalid"),
+			VisibilityTimeout: aws.Int64(0),
+		},
+	}
+	for _, msg := range msgs {
+		entries = append(entries, &sqsextendedclient.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                msg.MessageId,
+			ReceiptHandle:     msg.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(0),
+		})
+	}
+	out, err := f.svc.ChangeMessageVisibilityBatch(&sqsextendedclient.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String(f.queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 2, len(out.Successful); e != a {
+		t.Errorf("expect %v successful entries, got %v", e, a)
+	}
+	for _, entry := range out.Successful {
+		if a := aws.StringValue(entry.Id); a != aws.StringValue(msgs[0].MessageId) && a != aws.StringValue(msgs[1].MessageId) {
+			t.Errorf("expect successful entry ids to be the caller's, got %v", a)
+		}
+	}
+	if e, a := 1, len(out.Failed); e != a {
+		t.Fatalf("expect %v failed entry, got %v", e, a)
+	}
+	if e, a := "invalid", aws.StringValue(out.Failed[0].Id); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 2, len(f.receiveRaw(t)); e != a {
+		t.Errorf("expect messages to be visible again, got %v messages", a)
+	}
+}
@@ -0,0 +1,79 @@
+package sqsextendedclient
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// S3PayloadStore is a PayloadStore that keeps payloads as objects in an S3
+// bucket, under random keys.
+type S3PayloadStore struct {
+	// S3 client used to access the bucket.
+	Client s3iface.S3API
+
+	// Name of the bucket payloads are stored in.
+	BucketName string
+
+	// Prefix prepended to the keys of stored payloads.
+	KeyPrefix string
+}
+
+// NewS3PayloadStore returns a PayloadStore that keeps payloads in the given
+// bucket.
+func NewS3PayloadStore(s3c s3iface.S3API, bucketName string) *S3PayloadStore {
+	return &S3PayloadStore{
+		Client:     s3c,
+		BucketName: bucketName,
+	}
+}
+
+// PutPayload uploads payload to a new object in the bucket.
+func (s *S3PayloadStore) PutPayload(ctx aws.Context, payload string) (PayloadPointer, error) {
+	pointer := PayloadPointer{
+		S3BucketName: s.BucketName,
+		S3Key:        s.KeyPrefix + protocol.GetIdempotencyToken(),
+	}
+
+	_, err := s.Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(pointer.S3BucketName),
+		Key:           aws.String(pointer.S3Key),
+		Body:          strings.NewReader(payload),
+		ContentLength: aws.Int64(int64(len(payload))),
+	})
+	if err != nil {
+		return PayloadPointer{}, err
+	}
+	return pointer, nil
+}
+
+// GetPayload reads the object pointer refers to.
+func (s *S3PayloadStore) GetPayload(ctx aws.Context, pointer PayloadPointer) (string, error) {
+	resp, err := s.Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(pointer.S3BucketName),
+		Key:    aws.String(pointer.S3Key),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// DeletePayload deletes the object pointer refers to.
+func (s *S3PayloadStore) DeletePayload(ctx aws.Context, pointer PayloadPointer) error {
+	_, err := s.Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(pointer.S3BucketName),
+		Key:    aws.String(pointer.S3Key),
+	})
+	return err
+}
@@ -7,11 +7,19 @@ import (
 	"github.com/aws/aws-sdk-go/aws/request"
 	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
 	"github.com/aws/aws-sdk-go/private/protocol/query"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 )
 
 // SQSExtended struct
 type SQSExtended struct {
 	*client.Client
+
+	// Extended client settings, see ExtendedClientConfiguration.
+	config ExtendedClientConfiguration
+
+	// Store offloaded payloads are kept in, built from config, or nil if
+	// large payload support is disabled.
+	store PayloadStore
 }
 
 // Used for custom client initialization logic
@@ -27,6 +35,7 @@ const (
 	ServiceID   = "SQS"       // ServiceID is a unique identifier of a specific service.
 
 	ReservedAttributeName       = "ExtendedPayloadSize" //
+	LegacyReservedAttributeName = "SQSLargePayloadSize" // Used by Java extended client 1.x, recognised on receive
 	MaxAllowedAttributes        = 10 - 1                // 10 for SQS, 1 for the reserved attribute
 	DefaultMessageSizeThreshold = 262144                //
 	S3BucketNameMarker          = "-..s3BucketName..-"  //
@@ -95,3 +104,15 @@ func (c *SQSExtended) newRequest(op *request.Operation, params, data interface{}
 
 	return req
 }
+
+// WithLargePayloadSupport enables storing message payloads larger than the
+// message size threshold in the given S3 bucket, and returns the client for
+// chaining. Use NewWithExtendedConfig to have the settings validated.
+//
+// Example:
+//     svc := SQSExtended.New(mySession).WithLargePayloadSupport(s3.New(mySession), "my-bucket")
+func (c *SQSExtended) WithLargePayloadSupport(s3c s3iface.S3API, bucketName string) *SQSExtended {
+	c.config.WithLargePayloadSupport(s3c, bucketName)
+	c.store = c.config.newPayloadStore()
+	return c
+}
@@ -0,0 +1,41 @@
+package sqsextendedclient
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// MessageSize returns the size in bytes of a message body and its attributes,
+// as SQS counts it against the maximum message size. The name, data type and
+// every value of each attribute are counted. Message system attributes are
+// not part of the message size.
+func MessageSize(body *string, attrs map[string]*MessageAttributeValue) int {
+	size := len(aws.StringValue(body))
+	for name, v := range attrs {
+		size += len(name)
+		if v == nil {
+			continue
+		}
+		size += len(aws.StringValue(v.DataType))
+		size += len(aws.StringValue(v.StringValue))
+		size += len(v.BinaryValue)
+		for _, sv := range v.StringListValues {
+			size += len(aws.StringValue(sv))
+		}
+		for _, bv := range v.BinaryListValues {
+			size += len(bv)
+		}
+	}
+	return size
+}
+
+// MessageSize returns the size of the message as SQS counts it against the
+// maximum message size. See the MessageSize function.
+func (s *SendMessageInput) MessageSize() int {
+	return MessageSize(s.MessageBody, s.MessageAttributes)
+}
+
+// MessageSize returns the size of the entry's message as SQS counts it
+// against the maximum message size. See the MessageSize function.
+func (s *SendMessageBatchRequestEntry) MessageSize() int {
+	return MessageSize(s.MessageBody, s.MessageAttributes)
+}
@@ -0,0 +1,148 @@
+package sqsextendedclient_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+// maxSize is the maximum message size SQS accepts, which is also the default
+// message size threshold.
+const maxSize = sqsextendedclient.DefaultMessageSizeThreshold
+
+// boundaryAttributes are message attributes of each kind of value, and their
+// size as SQS counts it, to build messages around maxSize with.
+var boundaryAttributes = map[string]struct {
+	Attrs map[string]*sqsextendedclient.MessageAttributeValue
+	Size  int
+}{
+	"no attributes": {
+		Size: 0,
+	},
+	"String": {
+		Attrs: map[string]*sqsextendedclient.MessageAttributeValue{
+			"name": {DataType: aws.String("String"), StringValue: aws.String("value")},
+		},
+		Size: len("name") + len("String") + len("value"),
+	},
+	"Number": {
+		Attrs: map[string]*sqsextendedclient.MessageAttributeValue{
+			"count": {DataType: aws.String("Number.int"), StringValue: aws.String("12345")},
+		},
+		Size: len("count") + len("Number.int") + len("12345"),
+	},
+	"Binary": {
+		Attrs: map[string]*sqsextendedclient.MessageAttributeValue{
+			"blob": {DataType: aws.String("Binary"), BinaryValue: bytes.Repeat([]byte{0xff}, 1000)},
+		},
+		Size: len("blob") + len("Binary") + 1000,
+	},
+	"lists": {
+		Attrs: map[string]*sqsextendedclient.MessageAttributeValue{
+			"strings":  {DataType: aws.String("String"), StringListValues: []*string{aws.String("ab"), aws.String("cde")}},
+			"binaries": {DataType: aws.String("Binary"), BinaryListValues: [][]byte{{1, 2}, {3}}},
+		},
+		Size: len("strings") + len("String") + 5 + len("binaries") + len("Binary") + 3,
+	},
+	"multibyte": {
+		Attrs: map[string]*sqsextendedclient.MessageAttributeValue{
+			"größe": {DataType: aws.String("String"), StringValue: aws.String("日本")},
+		},
+		Size: len("größe") + len("String") + len("日本"),
+	},
+}
+
+func TestMessageSize(t *testing.T) {
+	for name, c := range boundaryAttributes {
+		for _, delta := range []int{-1, 0, 1} {
+			body := strings.Repeat("x", maxSize+delta-c.Size)
+
+			if e, a := maxSize+delta, sqsextendedclient.MessageSize(aws.String(body), c.Attrs); e != a {
+				t.Errorf("%s %+d, expect %v, got %v", name, delta, e, a)
+			}
+			in := &sqsextendedclient.SendMessageInput{MessageBody: aws.String(body), MessageAttributes: c.Attrs}
+			if e, a := maxSize+delta, in.MessageSize(); e != a {
+				t.Errorf("%s %+d, expect %v, got %v", name, delta, e, a)
+			}
+			entry := &sqsextendedclient.SendMessageBatchRequestEntry{MessageBody: aws.String(body), MessageAttributes: c.Attrs}
+			if e, a := maxSize+delta, entry.MessageSize(); e != a {
+				t.Errorf("%s %+d, expect %v, got %v", name, delta, e, a)
+			}
+		}
+	}
+}
+
+func TestMessageSizeNilValues(t *testing.T) {
+	attrs := map[string]*sqsextendedclient.MessageAttributeValue{"name": nil}
+	if e, a := len("name"), sqsextendedclient.MessageSize(nil, attrs); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+}
+
+func TestIsLarge(t *testing.T) {
+	cases := map[string]struct {
+		Config *sqsextendedclient.ExtendedClientConfiguration
+		Size   int
+		Large  bool
+	}{
+		"default threshold": {
+			Config: sqsextendedclient.NewExtendedClientConfiguration(),
+			Size:   262144,
+		},
+		"over default threshold": {
+			Config: sqsextendedclient.NewExtendedClientConfiguration(),
+			Size:   262145,
+			Large:  true,
+		},
+		"custom threshold": {
+			Config: sqsextendedclient.NewExtendedClientConfiguration().WithMessageSizeThreshold(1024),
+			Size:   1024,
+		},
+		"over custom threshold": {
+			Config: sqsextendedclient.NewExtendedClientConfiguration().WithMessageSizeThreshold(1024),
+			Size:   1025,
+			Large:  true,
+		},
+		"always through S3": {
+			Config: sqsextendedclient.NewExtendedClientConfiguration().WithAlwaysThroughS3(true),
+			Size:   1,
+			Large:  true,
+		},
+	}
+
+	for name, c := range cases {
+		if e, a := c.Large, sqsextendedclient.IsLarge(c.Config, c.Size); e != a {
+			t.Errorf("%s, expect %v, got %v", name, e, a)
+		}
+	}
+}
+
+func TestSendMessageSizeBoundary(t *testing.T) {
+	for name, c := range boundaryAttributes {
+		for _, delta := range []int{0, 1} {
+			f := newFakes(t)
+
+			body := strings.Repeat("x", maxSize+delta-c.Size)
+			_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+				QueueUrl:          aws.String(f.queueURL),
+				MessageBody:       aws.String(body),
+				MessageAttributes: c.Attrs,
+			})
+			if err != nil {
+				t.Fatalf("%s %+d, expect no error, got %v", name, delta, err)
+			}
+
+			msgs := f.receiveRaw(t)
+			if e, a := 1, len(msgs); e != a {
+				t.Fatalf("%s %+d, expect %v message, got %v", name, delta, e, a)
+			}
+			_, offloaded := msgs[0].MessageAttributes[sqsextendedclient.ReservedAttributeName]
+			if e, a := delta > 0, offloaded; e != a {
+				t.Errorf("%s %+d, expect offloaded %v, got %v", name, delta, e, a)
+			}
+		}
+	}
+}
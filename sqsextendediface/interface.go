@@ -0,0 +1,142 @@
+// Package sqsextendediface provides an interface to enable mocking the
+// SQSExtended client for testing your code.
+//
+// It is important to note that this interface will have breaking changes
+// when the service model is updated and adds new API operations, paginators,
+// and waiters.
+package sqsextendediface
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+// SQSExtendedAPI provides an interface to enable mocking the
+// sqsextendedclient.SQSExtended service client's API operation,
+// paginators, and waiters. This make unit testing your code that calls out
+// to the SDK's service client's calls easier.
+//
+// The best way to use this interface is so the SDK's service client's calls
+// can be stubbed out for unit testing your code with the SDK without needing
+// to inject custom request handlers into the SDK's request pipeline.
+//
+//	// myFunc uses an SDK service client to make a request to
+//	// Amazon Simple Queue Service.
+//	func myFunc(svc sqsextendediface.SQSExtendedAPI) bool {
+//		// Make svc.AddPermission request
+//	}
+//
+//	func main() {
+//		sess := session.New()
+//		svc := sqsextendedclient.New(sess)
+//
+//		myFunc(svc)
+//	}
+//
+// In your _test.go file:
+//
+//	// Define a mock struct to be used in your unit tests of myFunc.
+//	type mockSQSExtendedClient struct {
+//		sqsextendediface.SQSExtendedAPI
+//	}
+//	func (m *mockSQSExtendedClient) AddPermission(input *sqsextendedclient.AddPermissionInput) (*sqsextendedclient.AddPermissionOutput, error) {
+//		// mock response/functionality
+//	}
+//
+//	func TestMyFunc(t *testing.T) {
+//		// Setup Test
+//		mockSvc := &mockSQSExtendedClient{}
+//
+//		myfunc(mockSvc)
+//
+//		// Verify myFunc's functionality
+//	}
+//
+// It is important to note that this interface will have breaking changes
+// when the service model is updated and adds new API operations, paginators,
+// and waiters. Its suggested to use the pattern above for testing, or using
+// tooling to generate mocks to satisfy the interfaces.
+type SQSExtendedAPI interface {
+	AddPermission(*sqsextendedclient.AddPermissionInput) (*sqsextendedclient.AddPermissionOutput, error)
+	AddPermissionWithContext(aws.Context, *sqsextendedclient.AddPermissionInput, ...request.Option) (*sqsextendedclient.AddPermissionOutput, error)
+	AddPermissionRequest(*sqsextendedclient.AddPermissionInput) (*request.Request, *sqsextendedclient.AddPermissionOutput)
+
+	ChangeMessageVisibility(*sqsextendedclient.ChangeMessageVisibilityInput) (*sqsextendedclient.ChangeMessageVisibilityOutput, error)
+	ChangeMessageVisibilityWithContext(aws.Context, *sqsextendedclient.ChangeMessageVisibilityInput, ...request.Option) (*sqsextendedclient.ChangeMessageVisibilityOutput, error)
+	ChangeMessageVisibilityRequest(*sqsextendedclient.ChangeMessageVisibilityInput) (*request.Request, *sqsextendedclient.ChangeMessageVisibilityOutput)
+
+	ChangeMessageVisibilityBatch(*sqsextendedclient.ChangeMessageVisibilityBatchInput) (*sqsextendedclient.ChangeMessageVisibilityBatchOutput, error)
+	ChangeMessageVisibilityBatchWithContext(aws.Context, *sqsextendedclient.ChangeMessageVisibilityBatchInput, ...request.Option) (*sqsextendedclient.ChangeMessageVisibilityBatchOutput, error)
+	ChangeMessageVisibilityBatchRequest(*sqsextendedclient.ChangeMessageVisibilityBatchInput) (*request.Request, *sqsextendedclient.ChangeMessageVisibilityBatchOutput)
+
+	CreateQueue(*sqsextendedclient.CreateQueueInput) (*sqsextendedclient.CreateQueueOutput, error)
+	CreateQueueWithContext(aws.Context, *sqsextendedclient.CreateQueueInput, ...request.Option) (*sqsextendedclient.CreateQueueOutput, error)
+	CreateQueueRequest(*sqsextendedclient.CreateQueueInput) (*request.Request, *sqsextendedclient.CreateQueueOutput)
+
+	DeleteMessage(*sqsextendedclient.DeleteMessageInput) (*sqsextendedclient.DeleteMessageOutput, error)
+	DeleteMessageWithContext(aws.Context, *sqsextendedclient.DeleteMessageInput, ...request.Option) (*sqsextendedclient.DeleteMessageOutput, error)
+	DeleteMessageRequest(*sqsextendedclient.DeleteMessageInput) (*request.Request, *sqsextendedclient.DeleteMessageOutput)
+
+	DeleteMessageBatch(*sqsextendedclient.DeleteMessageBatchInput) (*sqsextendedclient.DeleteMessageBatchOutput, error)
+	DeleteMessageBatchWithContext(aws.Context, *sqsextendedclient.DeleteMessageBatchInput, ...request.Option) (*sqsextendedclient.DeleteMessageBatchOutput, error)
+	DeleteMessageBatchRequest(*sqsextendedclient.DeleteMessageBatchInput) (*request.Request, *sqsextendedclient.DeleteMessageBatchOutput)
+
+	DeleteQueue(*sqsextendedclient.DeleteQueueInput) (*sqsextendedclient.DeleteQueueOutput, error)
+	DeleteQueueWithContext(aws.Context, *sqsextendedclient.DeleteQueueInput, ...request.Option) (*sqsextendedclient.DeleteQueueOutput, error)
+	DeleteQueueRequest(*sqsextendedclient.DeleteQueueInput) (*request.Request, *sqsextendedclient.DeleteQueueOutput)
+
+	GetQueueAttributes(*sqsextendedclient.GetQueueAttributesInput) (*sqsextendedclient.GetQueueAttributesOutput, error)
+	GetQueueAttributesWithContext(aws.Context, *sqsextendedclient.GetQueueAttributesInput, ...request.Option) (*sqsextendedclient.GetQueueAttributesOutput, error)
+	GetQueueAttributesRequest(*sqsextendedclient.GetQueueAttributesInput) (*request.Request, *sqsextendedclient.GetQueueAttributesOutput)
+
+	GetQueueUrl(*sqsextendedclient.GetQueueUrlInput) (*sqsextendedclient.GetQueueUrlOutput, error)
+	GetQueueUrlWithContext(aws.Context, *sqsextendedclient.GetQueueUrlInput, ...request.Option) (*sqsextendedclient.GetQueueUrlOutput, error)
+	GetQueueUrlRequest(*sqsextendedclient.GetQueueUrlInput) (*request.Request, *sqsextendedclient.GetQueueUrlOutput)
+
+	ListDeadLetterSourceQueues(*sqsextendedclient.ListDeadLetterSourceQueuesInput) (*sqsextendedclient.ListDeadLetterSourceQueuesOutput, error)
+	ListDeadLetterSourceQueuesWithContext(aws.Context, *sqsextendedclient.ListDeadLetterSourceQueuesInput, ...request.Option) (*sqsextendedclient.ListDeadLetterSourceQueuesOutput, error)
+	ListDeadLetterSourceQueuesRequest(*sqsextendedclient.ListDeadLetterSourceQueuesInput) (*request.Request, *sqsextendedclient.ListDeadLetterSourceQueuesOutput)
+
+	ListQueueTags(*sqsextendedclient.ListQueueTagsInput) (*sqsextendedclient.ListQueueTagsOutput, error)
+	ListQueueTagsWithContext(aws.Context, *sqsextendedclient.ListQueueTagsInput, ...request.Option) (*sqsextendedclient.ListQueueTagsOutput, error)
+	ListQueueTagsRequest(*sqsextendedclient.ListQueueTagsInput) (*request.Request, *sqsextendedclient.ListQueueTagsOutput)
+
+	ListQueues(*sqsextendedclient.ListQueuesInput) (*sqsextendedclient.ListQueuesOutput, error)
+	ListQueuesWithContext(aws.Context, *sqsextendedclient.ListQueuesInput, ...request.Option) (*sqsextendedclient.ListQueuesOutput, error)
+	ListQueuesRequest(*sqsextendedclient.ListQueuesInput) (*request.Request, *sqsextendedclient.ListQueuesOutput)
+
+	PurgeQueue(*sqsextendedclient.PurgeQueueInput) (*sqsextendedclient.PurgeQueueOutput, error)
+	PurgeQueueWithContext(aws.Context, *sqsextendedclient.PurgeQueueInput, ...request.Option) (*sqsextendedclient.PurgeQueueOutput, error)
+	PurgeQueueRequest(*sqsextendedclient.PurgeQueueInput) (*request.Request, *sqsextendedclient.PurgeQueueOutput)
+
+	ReceiveMessage(*sqsextendedclient.ReceiveMessageInput) (*sqsextendedclient.ReceiveMessageOutput, error)
+	ReceiveMessageWithContext(aws.Context, *sqsextendedclient.ReceiveMessageInput, ...request.Option) (*sqsextendedclient.ReceiveMessageOutput, error)
+	ReceiveMessageRequest(*sqsextendedclient.ReceiveMessageInput) (*request.Request, *sqsextendedclient.ReceiveMessageOutput)
+
+	RemovePermission(*sqsextendedclient.RemovePermissionInput) (*sqsextendedclient.RemovePermissionOutput, error)
+	RemovePermissionWithContext(aws.Context, *sqsextendedclient.RemovePermissionInput, ...request.Option) (*sqsextendedclient.RemovePermissionOutput, error)
+	RemovePermissionRequest(*sqsextendedclient.RemovePermissionInput) (*request.Request, *sqsextendedclient.RemovePermissionOutput)
+
+	SendMessage(*sqsextendedclient.SendMessageInput) (*sqsextendedclient.SendMessageOutput, error)
+	SendMessageWithContext(aws.Context, *sqsextendedclient.SendMessageInput, ...request.Option) (*sqsextendedclient.SendMessageOutput, error)
+	SendMessageRequest(*sqsextendedclient.SendMessageInput) (*request.Request, *sqsextendedclient.SendMessageOutput)
+
+	SendMessageBatch(*sqsextendedclient.SendMessageBatchInput) (*sqsextendedclient.SendMessageBatchOutput, error)
+	SendMessageBatchWithContext(aws.Context, *sqsextendedclient.SendMessageBatchInput, ...request.Option) (*sqsextendedclient.SendMessageBatchOutput, error)
+	SendMessageBatchRequest(*sqsextendedclient.SendMessageBatchInput) (*request.Request, *sqsextendedclient.SendMessageBatchOutput)
+
+	SetQueueAttributes(*sqsextendedclient.SetQueueAttributesInput) (*sqsextendedclient.SetQueueAttributesOutput, error)
+	SetQueueAttributesWithContext(aws.Context, *sqsextendedclient.SetQueueAttributesInput, ...request.Option) (*sqsextendedclient.SetQueueAttributesOutput, error)
+	SetQueueAttributesRequest(*sqsextendedclient.SetQueueAttributesInput) (*request.Request, *sqsextendedclient.SetQueueAttributesOutput)
+
+	TagQueue(*sqsextendedclient.TagQueueInput) (*sqsextendedclient.TagQueueOutput, error)
+	TagQueueWithContext(aws.Context, *sqsextendedclient.TagQueueInput, ...request.Option) (*sqsextendedclient.TagQueueOutput, error)
+	TagQueueRequest(*sqsextendedclient.TagQueueInput) (*request.Request, *sqsextendedclient.TagQueueOutput)
+
+	UntagQueue(*sqsextendedclient.UntagQueueInput) (*sqsextendedclient.UntagQueueOutput, error)
+	UntagQueueWithContext(aws.Context, *sqsextendedclient.UntagQueueInput, ...request.Option) (*sqsextendedclient.UntagQueueOutput, error)
+	UntagQueueRequest(*sqsextendedclient.UntagQueueInput) (*request.Request, *sqsextendedclient.UntagQueueOutput)
+}
+
+var _ SQSExtendedAPI = (*sqsextendedclient.SQSExtended)(nil)
@@ -0,0 +1,376 @@
+package sqsextendedmanager
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendediface"
+)
+
+const (
+	// DefaultBatchMaxRetries is the default number of times a BatchRetryer
+	// retries an entry that failed with a retryable error.
+	DefaultBatchMaxRetries = 3
+
+	// DefaultBatchMinRetryDelay is the default delay before the first retry
+	// of a BatchRetryer.
+	DefaultBatchMinRetryDelay = 100 * time.Millisecond
+
+	// DefaultBatchMaxRetryDelay is the default maximum delay between retries
+	// of a BatchRetryer.
+	DefaultBatchMaxRetryDelay = 5 * time.Second
+)
+
+// maxBatchEntries is the maximum number of entries in a batch request.
+const maxBatchEntries = 10
+
+// ErrCodeBatchEntriesFailed is the error code of a BatchError.
+const ErrCodeBatchEntriesFailed = "BatchEntriesFailed"
+
+// BatchError is returned by a BatchRetryer when entries of a batch request
+// failed with an error that is not retryable, or ran out of retries.
+type BatchError struct {
+	// Op is the name of the batch API operation.
+	Op string
+
+	// Failed are the entries that failed permanently, in order of their Id.
+	Failed []*sqsextendedclient.BatchResultErrorEntry
+}
+
+// newBatchError returns a BatchError for the failed entries of op.
+func newBatchError(op string, failed []*sqsextendedclient.BatchResultErrorEntry) *BatchError {
+	sort.Slice(failed, func(i, j int) bool {
+		return aws.StringValue(failed[i].Id) < aws.StringValue(failed[j].Id)
+	})
+	return &BatchError{Op: op, Failed: failed}
+}
+
+// Ids returns the Ids of the failed entries.
+func (e *BatchError) Ids() []string {
+	ids := make([]string, len(e.Failed))
+	for i, entry := range e.Failed {
+		ids[i] = aws.StringValue(entry.Id)
+	}
+	return ids
+}
+
+// Code returns ErrCodeBatchEntriesFailed.
+func (e *BatchError) Code() string {
+	return ErrCodeBatchEntriesFailed
+}
+
+// Message returns the number of failed entries and the operation.
+func (e *BatchError) Message() string {
+	return fmt.Sprintf("%d %s entries failed", len(e.Failed), e.Op)
+}
+
+// Error returns the string representation of the error, listing the failed
+// entries by Id.
+func (e *BatchError) Error() string {
+	lines := make([]string, len(e.Failed))
+	for i, entry := range e.Failed {
+		lines[i] = fmt.Sprintf("%s: %v", aws.StringValue(entry.Id), batchEntryError(entry))
+	}
+	return awserr.SprintError(e.Code(), e.Message(), strings.Join(lines, "\n\t"), nil)
+}
+
+// OrigErr always returns nil; the errors of the failed entries are in Failed.
+func (e *BatchError) OrigErr() error {
+	return nil
+}
+
+var _ awserr.Error = (*BatchError)(nil)
+
+// The BatchRetryer structure that calls SendMessageBatchWithContext(),
+// DeleteMessageBatchWithContext() and ChangeMessageVisibilityBatchWithContext().
+// It sends a batch request, and sends again the entries that failed with a
+// retryable error, such as throttling or an internal error, with jittered
+// exponential backoff. It is safe to use the BatchRetryer concurrently.
+// Mutating the BatchRetryer's properties while it is in use is not safe.
+//
+// Failed requests are retried by the client's own retryer, and are not
+// retried again.
+type BatchRetryer struct {
+	// The client to send batch requests with.
+	SQS sqsextendediface.SQSExtendedAPI
+
+	// The maximum number of times an entry is retried. Defaults to
+	// DefaultBatchMaxRetries.
+	MaxRetries int
+
+	// The delay before the first retry, which doubles with each subsequent
+	// retry, up to MaxRetryDelay. Each delay is jittered down by up to half.
+	// Defaults to DefaultBatchMinRetryDelay.
+	MinRetryDelay time.Duration
+
+	// The maximum delay between retries. Defaults to
+	// DefaultBatchMaxRetryDelay.
+	MaxRetryDelay time.Duration
+}
+
+// NewBatchRetryer creates a new BatchRetryer instance to send batch requests
+// with svc. Pass in additional functional options to customize the retryer's
+// behavior.
+//
+// Example:
+//
+//	retryer := sqsextendedmanager.NewBatchRetryer(svc, func(b *sqsextendedmanager.BatchRetryer) {
+//		b.MaxRetries = 5
+//	})
+//
+//	out, err := retryer.SendMessageBatchWithContext(ctx, input)
+//	if berr, ok := err.(*sqsextendedmanager.BatchError); ok {
+//		log.Printf("failed entries: %v", berr.Ids())
+//	}
+func NewBatchRetryer(svc sqsextendediface.SQSExtendedAPI, options ...func(*BatchRetryer)) *BatchRetryer {
+	b := &BatchRetryer{
+		SQS:           svc,
+		MaxRetries:    DefaultBatchMaxRetries,
+		MinRetryDelay: DefaultBatchMinRetryDelay,
+		MaxRetryDelay: DefaultBatchMaxRetryDelay,
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// SendMessageBatchWithContext sends the entries of input with
+// SendMessageBatch, retrying the entries that failed with a retryable error.
+//
+// The output holds the result of every entry: Successful those that were
+// sent, possibly after retries, and Failed those that failed permanently. If
+// any entry failed permanently, the error is a *BatchError listing the same
+// entries. If a request fails, its error is returned along with the results
+// of the entries settled by earlier requests.
+//
+// Requests that succeed but fail to delete the offloaded payloads of failed
+// entries, with sqsextendedclient.ErrCodeDeletePayload, do not stop retries.
+// Their errors are returned, as one, if no entry failed permanently.
+//
+// Failed entries are not retried if the queue is a FIFO queue, since a
+// retried message would be sent after the messages that followed it in its
+// message group. They are returned in the *BatchError instead.
+func (b *BatchRetryer) SendMessageBatchWithContext(ctx aws.Context, input *sqsextendedclient.SendMessageBatchInput, opts ...request.Option) (*sqsextendedclient.SendMessageBatchOutput, error) {
+	out := &sqsextendedclient.SendMessageBatchOutput{}
+	ids := make([]*string, len(input.Entries))
+	for i, entry := range input.Entries {
+		if entry == nil {
+			return out, nilEntryError("SendMessageBatchInput", i)
+		}
+		ids[i] = entry.Id
+	}
+	maxRetries := b.MaxRetries
+	if isFIFOQueue(aws.StringValue(input.QueueUrl)) {
+		maxRetries = 0
+	}
+	failed, err := b.retryBatch(ctx, "SendMessageBatch", ids, maxRetries, func(pending []int) ([]*sqsextendedclient.BatchResultErrorEntry, error) {
+		params := *input
+		params.Entries = make([]*sqsextendedclient.SendMessageBatchRequestEntry, len(pending))
+		for i, j := range pending {
+			params.Entries[i] = input.Entries[j]
+		}
+		o, err := b.SQS.SendMessageBatchWithContext(ctx, &params, opts...)
+		if o == nil {
+			return nil, err
+		}
+		out.Successful = append(out.Successful, o.Successful...)
+		return o.Failed, err
+	})
+	out.Failed = failed
+	return out, err
+}
+
+// DeleteMessageBatchWithContext deletes the entries of input with
+// DeleteMessageBatch, retrying the entries that failed with a retryable
+// error. See SendMessageBatchWithContext for the output and errors; here
+// sqsextendedclient.ErrCodeDeletePayload is returned for the offloaded
+// payloads of deleted messages.
+func (b *BatchRetryer) DeleteMessageBatchWithContext(ctx aws.Context, input *sqsextendedclient.DeleteMessageBatchInput, opts ...request.Option) (*sqsextendedclient.DeleteMessageBatchOutput, error) {
+	out := &sqsextendedclient.DeleteMessageBatchOutput{}
+	ids := make([]*string, len(input.Entries))
+	for i, entry := range input.Entries {
+		if entry == nil {
+			return out, nilEntryError("DeleteMessageBatchInput", i)
+		}
+		ids[i] = entry.Id
+	}
+	failed, err := b.retryBatch(ctx, "DeleteMessageBatch", ids, b.MaxRetries, func(pending []int) ([]*sqsextendedclient.BatchResultErrorEntry, error) {
+		params := *input
+		params.Entries = make([]*sqsextendedclient.DeleteMessageBatchRequestEntry, len(pending))
+		for i, j := range pending {
+			params.Entries[i] = input.Entries[j]
+		}
+		o, err := b.SQS.DeleteMessageBatchWithContext(ctx, &params, opts...)
+		if o == nil {
+			return nil, err
+		}
+		out.Successful = append(out.Successful, o.Successful...)
+		return o.Failed, err
+	})
+	out.Failed = failed
+	return out, err
+}
+
+// ChangeMessageVisibilityBatchWithContext changes the visibility timeout of
+// the entries of input with ChangeMessageVisibilityBatch, retrying the
+// entries that failed with a retryable error. See
+// SendMessageBatchWithContext for the output and errors.
+func (b *BatchRetryer) ChangeMessageVisibilityBatchWithContext(ctx aws.Context, input *sqsextendedclient.ChangeMessageVisibilityBatchInput, opts ...request.Option) (*sqsextendedclient.ChangeMessageVisibilityBatchOutput, error) {
+	out := &sqsextendedclient.ChangeMessageVisibilityBatchOutput{}
+	ids := make([]*string, len(input.Entries))
+	for i, entry := range input.Entries {
+		if entry == nil {
+			return out, nilEntryError("ChangeMessageVisibilityBatchInput", i)
+		}
+		ids[i] = entry.Id
+	}
+	failed, err := b.retryBatch(ctx, "ChangeMessageVisibilityBatch", ids, b.MaxRetries, func(pending []int) ([]*sqsextendedclient.BatchResultErrorEntry, error) {
+		params := *input
+		params.Entries = make([]*sqsextendedclient.ChangeMessageVisibilityBatchRequestEntry, len(pending))
+		for i, j := range pending {
+			params.Entries[i] = input.Entries[j]
+		}
+		o, err := b.SQS.ChangeMessageVisibilityBatchWithContext(ctx, &params, opts...)
+		if o == nil {
+			return nil, err
+		}
+		out.Successful = append(out.Successful, o.Successful...)
+		return o.Failed, err
+	})
+	out.Failed = failed
+	return out, err
+}
+
+// retryBatch retries the entries of a batch request of op with retry, and
+// returns the entries that failed permanently along with the error the
+// BatchRetryer methods return for them.
+func (b *BatchRetryer) retryBatch(ctx aws.Context, op string, ids []*string, maxRetries int, send func(pending []int) ([]*sqsextendedclient.BatchResultErrorEntry, error)) ([]*sqsextendedclient.BatchResultErrorEntry, error) {
+	failed, payloadErr, err := b.retry(ctx, ids, maxRetries, send)
+	if err != nil {
+		return failed, err
+	}
+	if len(failed) > 0 {
+		return failed, newBatchError(op, failed)
+	}
+	return failed, payloadErr
+}
+
+// retry calls send with the indexes of the entries to send, first all of
+// them, then those that failed with a retryable error, until none are left
+// or they ran out of maxRetries. The entries of the batch have the given
+// ids, which the failed entries send returns are matched against.
+//
+// It returns the entries that failed permanently, the
+// sqsextendedclient.ErrCodeDeletePayload errors of the requests, combined,
+// and the error of the request or ctx that stopped the retries, if any.
+func (b *BatchRetryer) retry(ctx aws.Context, ids []*string, maxRetries int, send func(pending []int) ([]*sqsextendedclient.BatchResultErrorEntry, error)) (failed []*sqsextendedclient.BatchResultErrorEntry, payloadErr, err error) {
+	index := make(map[string]int, len(ids))
+	pending := make([]int, len(ids))
+	for i, id := range ids {
+		index[aws.StringValue(id)] = i
+		pending[i] = i
+	}
+
+	for retries := 0; len(pending) > 0; retries++ {
+		if retries > 0 {
+			if err := aws.SleepWithContext(ctx, b.retryDelay(retries)); err != nil {
+				return failed, payloadErr, awserr.New(request.CanceledErrorCode, "request context canceled", err)
+			}
+		}
+		out, err := send(pending)
+		if err != nil {
+			if !errCodeIs(err, sqsextendedclient.ErrCodeDeletePayload) {
+				return failed, payloadErr, err
+			}
+			payloadErr = combinePayloadErrors(payloadErr, err)
+		}
+
+		sent := make(map[int]bool, len(pending))
+		for _, i := range pending {
+			sent[i] = true
+		}
+		var next []int
+		for _, entry := range out {
+			i, ok := index[aws.StringValue(entry.Id)]
+			if !ok || !sent[i] {
+				continue
+			}
+			sent[i] = false
+			if retries < maxRetries && isBatchEntryRetryable(entry) {
+				next = append(next, i)
+				continue
+			}
+			failed = append(failed, entry)
+		}
+		sort.Ints(next)
+		pending = next
+	}
+	return failed, payloadErr, nil
+}
+
+// combinePayloadErrors returns the sqsextendedclient.ErrCodeDeletePayload
+// error of a request combined with that of earlier requests, if any.
+func combinePayloadErrors(prev, err error) error {
+	if prev == nil {
+		return err
+	}
+	var errs []error
+	for _, e := range []error{prev, err} {
+		if batch, ok := e.(awserr.BatchedErrors); ok {
+			errs = append(errs, batch.OrigErrs()...)
+		} else {
+			errs = append(errs, e)
+		}
+	}
+	return awserr.NewBatchError(sqsextendedclient.ErrCodeDeletePayload,
+		err.(awserr.Error).Message(), errs)
+}
+
+// nilEntryError returns the error for a nil entry at index i of the Entries
+// of a batch request input.
+func nilEntryError(context string, i int) error {
+	invalidParams := request.ErrInvalidParams{Context: context}
+	invalidParams.Add(request.NewErrParamRequired(fmt.Sprintf("%s[%v]", "Entries", i)))
+	return invalidParams
+}
+
+// isFIFOQueue reports whether queueURL is the URL of a FIFO queue, whose name
+// ends in ".fifo".
+func isFIFOQueue(queueURL string) bool {
+	return strings.HasSuffix(queueURL, ".fifo")
+}
+
+// retryDelay returns the jittered delay before the given retry.
+func (b *BatchRetryer) retryDelay(retries int) time.Duration {
+	delay := b.MaxRetryDelay
+	if retries < 32 {
+		if d := b.MinRetryDelay << uint(retries-1); d > 0 && d < delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// batchEntryError returns the error a batch entry failed with.
+func batchEntryError(entry *sqsextendedclient.BatchResultErrorEntry) awserr.Error {
+	return awserr.New(aws.StringValue(entry.Code), aws.StringValue(entry.Message), nil)
+}
+
+// isBatchEntryRetryable reports whether a batch entry failed with an error
+// that may not recur: any error that is not the sender's fault, or one with
+// a retryable or throttling error code.
+func isBatchEntryRetryable(entry *sqsextendedclient.BatchResultErrorEntry) bool {
+	err := batchEntryError(entry)
+	return !aws.BoolValue(entry.SenderFault) || request.IsErrorRetryable(err) || request.IsErrorThrottle(err)
+}
@@ -0,0 +1,286 @@
+package sqsextendedmanager_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendedmanager"
+	"github.com/chojy/sqsextended/sqsextendedtest"
+)
+
+// fastRetries makes a BatchRetryer retry without delay.
+func fastRetries(b *sqsextendedmanager.BatchRetryer) {
+	b.MinRetryDelay = time.Millisecond
+	b.MaxRetryDelay = time.Millisecond
+}
+
+// sendLarge sends n messages the client under test offloads, and returns
+// their receipt handles.
+func (f *fakes) sendLarge(t *testing.T, n int) []string {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+			QueueUrl:    aws.String(f.queueURL),
+			MessageBody: aws.String(strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold+1)),
+		})
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+	}
+	return f.receiveHandles(t, n)
+}
+
+func TestBatchRetryerSendMessageBatch(t *testing.T) {
+	f := newFakes(t, nil)
+	svc := &failingBatches{
+		SQSExtendedAPI: f.svc,
+		Failures: map[string]*failure{
+			"flaky": {Times: 2, Entry: sqsextendedclient.BatchResultErrorEntry{
+				Code:        aws.String("InternalError"),
+				SenderFault: aws.Bool(false),
+			}},
+			"throttled": {Times: 100, Entry: sqsextendedclient.BatchResultErrorEntry{
+				Code:        aws.String("RequestThrottled"),
+				SenderFault: aws.Bool(true),
+			}},
+		},
+	}
+	retryer := sqsextendedmanager.NewBatchRetryer(svc, fastRetries)
+
+	input := &sqsextendedclient.SendMessageBatchInput{
+		QueueUrl: aws.String(f.queueURL),
+	}
+	for _, id := range []string{"ok", "flaky", "throttled", "invalid"} {
+		entry := &sqsextendedclient.SendMessageBatchRequestEntry{
+			Id:          aws.String(id),
+			MessageBody: aws.String(id),
+		}
+		if id == "invalid" {
+			// Standard queues reject message groups.
+			entry.MessageGroupId = aws.String("group")
+		}
+		input.Entries = append(input.Entries, entry)
+	}
+	out, err := retryer.SendMessageBatchWithContext(context.Background(), input)
+
+	berr, ok := err.(*sqsextendedmanager.BatchError)
+	if !ok {
+		t.Fatalf("expect *BatchError, got %v", err)
+	}
+	if e, a := []string{"invalid", "throttled"}, berr.Ids(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	var sent []string
+	for _, entry := range out.Successful {
+		sent = append(sent, aws.StringValue(entry.Id))
+	}
+	sort.Strings(sent)
+	if e, a := []string{"flaky", "ok"}, sent; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 2, len(out.Failed); e != a {
+		t.Errorf("expect %v failed entries, got %v", e, a)
+	}
+	// The throttled entry runs out of retries.
+	if e, a := 1+sqsextendedmanager.DefaultBatchMaxRetries, svc.Calls; e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+	if e, a := 4, len(input.Entries); e != a {
+		t.Errorf("expect input to be left untouched, got %v entries", a)
+	}
+	if e, a := 2, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
+
+func TestBatchRetryerCanceled(t *testing.T) {
+	f := newFakes(t, nil)
+	svc := &failingBatches{
+		SQSExtendedAPI: f.svc,
+		Failures: map[string]*failure{
+			"flaky": {Times: 1, Entry: sqsextendedclient.BatchResultErrorEntry{
+				Code:        aws.String("InternalError"),
+				SenderFault: aws.Bool(false),
+			}},
+		},
+	}
+	retryer := sqsextendedmanager.NewBatchRetryer(svc, func(b *sqsextendedmanager.BatchRetryer) {
+		b.MinRetryDelay = time.Hour
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	out, err := retryer.SendMessageBatchWithContext(ctx, &sqsextendedclient.SendMessageBatchInput{
+		QueueUrl: aws.String(f.queueURL),
+		Entries: []*sqsextendedclient.SendMessageBatchRequestEntry{
+			{Id: aws.String("ok"), MessageBody: aws.String("ok")},
+			{Id: aws.String("flaky"), MessageBody: aws.String("flaky")},
+		},
+	})
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if e, a := request.CanceledErrorCode, err.(awserr.Error).Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 1, len(out.Successful); e != a {
+		t.Errorf("expect %v successful entries, got %v", e, a)
+	}
+}
+
+func TestBatchRetryerDeleteMessageBatchPayloadError(t *testing.T) {
+	f := newFakes(t, nil)
+	handles := f.sendLarge(t, 2)
+	f.s3.InjectFault(sqsextendedtest.Fault{Method: "DELETE", Key: "*", StatusCode: 403, Code: "AccessDenied", Times: 1})
+
+	svc := &failingBatches{
+		SQSExtendedAPI: f.svc,
+		Failures: map[string]*failure{
+			"0": {Times: 1, Entry: sqsextendedclient.BatchResultErrorEntry{
+				Code:        aws.String("InternalError"),
+				SenderFault: aws.Bool(false),
+			}},
+		},
+	}
+	retryer := sqsextendedmanager.NewBatchRetryer(svc, fastRetries)
+
+	input := &sqsextendedclient.DeleteMessageBatchInput{
+		QueueUrl: aws.String(f.queueURL),
+	}
+	for i, handle := range handles {
+		input.Entries = append(input.Entries, &sqsextendedclient.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: aws.String(handle),
+		})
+	}
+	out, err := retryer.DeleteMessageBatchWithContext(context.Background(), input)
+
+	// The payload of the first request could not be deleted, and the failed
+	// entry is still retried.
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if e, a := sqsextendedclient.ErrCodeDeletePayload, err.(awserr.Error).Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 2, len(out.Successful); e != a {
+		t.Errorf("expect %v successful entries, got %v", e, a)
+	}
+	if e, a := 0, len(out.Failed); e != a {
+		t.Errorf("expect %v failed entries, got %v", e, a)
+	}
+	if e, a := 2, svc.Calls; e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+	if e, a := 0, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+	if e, a := 1, len(f.s3.Keys(testBucket)); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+}
+
+func TestBatchRetryerFIFOQueue(t *testing.T) {
+	f := newFakes(t, map[string]string{
+		"FifoQueue":                 "true",
+		"ContentBasedDeduplication": "true",
+	})
+	svc := &failingBatches{
+		SQSExtendedAPI: f.svc,
+		Failures: map[string]*failure{
+			"flaky": {Times: 1, Entry: sqsextendedclient.BatchResultErrorEntry{
+				Code:        aws.String("InternalError"),
+				SenderFault: aws.Bool(false),
+			}},
+		},
+	}
+	retryer := sqsextendedmanager.NewBatchRetryer(svc, fastRetries)
+
+	out, err := retryer.SendMessageBatchWithContext(context.Background(), &sqsextendedclient.SendMessageBatchInput{
+		QueueUrl: aws.String(f.queueURL),
+		Entries: []*sqsextendedclient.SendMessageBatchRequestEntry{
+			{Id: aws.String("flaky"), MessageBody: aws.String("flaky"), MessageGroupId: aws.String("group")},
+			{Id: aws.String("ok"), MessageBody: aws.String("ok"), MessageGroupId: aws.String("group")},
+		},
+	})
+
+	// Retrying the failed entry would send it after the next one.
+	berr, ok := err.(*sqsextendedmanager.BatchError)
+	if !ok {
+		t.Fatalf("expect *BatchError, got %v", err)
+	}
+	if e, a := []string{"flaky"}, berr.Ids(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 1, len(out.Successful); e != a {
+		t.Errorf("expect %v successful entries, got %v", e, a)
+	}
+	if e, a := 1, svc.Calls; e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+}
+
+func TestBatchRetryerNilEntry(t *testing.T) {
+	svc := &failingBatches{}
+	retryer := sqsextendedmanager.NewBatchRetryer(svc, fastRetries)
+	cases := map[string]func() error{
+		"SendMessageBatch": func() error {
+			_, err := retryer.SendMessageBatchWithContext(context.Background(), &sqsextendedclient.SendMessageBatchInput{
+				QueueUrl: aws.String("queue"),
+				Entries: []*sqsextendedclient.SendMessageBatchRequestEntry{
+					{Id: aws.String("0"), MessageBody: aws.String("hello")},
+					nil,
+				},
+			})
+			return err
+		},
+		"DeleteMessageBatch": func() error {
+			_, err := retryer.DeleteMessageBatchWithContext(context.Background(), &sqsextendedclient.DeleteMessageBatchInput{
+				QueueUrl: aws.String("queue"),
+				Entries: []*sqsextendedclient.DeleteMessageBatchRequestEntry{
+					{Id: aws.String("0"), ReceiptHandle: aws.String("handle")},
+					nil,
+				},
+			})
+			return err
+		},
+		"ChangeMessageVisibilityBatch": func() error {
+			_, err := retryer.ChangeMessageVisibilityBatchWithContext(context.Background(), &sqsextendedclient.ChangeMessageVisibilityBatchInput{
+				QueueUrl: aws.String("queue"),
+				Entries: []*sqsextendedclient.ChangeMessageVisibilityBatchRequestEntry{
+					{Id: aws.String("0"), ReceiptHandle: aws.String("handle")},
+					nil,
+				},
+			})
+			return err
+		},
+	}
+
+	for name, call := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := call()
+			if err == nil {
+				t.Fatalf("expect error, got nil")
+			}
+			if e, a := request.InvalidParameterErrCode, err.(awserr.Error).Code(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			if !strings.Contains(err.Error(), "Entries[1]") {
+				t.Errorf("expect error to name the nil entry, got %v", err)
+			}
+		})
+	}
+	if e, a := 0, svc.Calls; e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+}
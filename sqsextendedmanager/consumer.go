@@ -0,0 +1,404 @@
+package sqsextendedmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendediface"
+)
+
+const (
+	// DefaultConsumerConcurrency is the default number of messages a Consumer
+	// handles concurrently.
+	DefaultConsumerConcurrency = 10
+
+	// DefaultMaxNumberOfMessages is the default, and the maximum, number of
+	// messages a Consumer receives per ReceiveMessage request.
+	DefaultMaxNumberOfMessages = 10
+
+	// DefaultWaitTimeSeconds is the default, and the maximum, duration a
+	// Consumer long polls for messages per ReceiveMessage request.
+	DefaultWaitTimeSeconds = 20
+)
+
+// receiveErrorDelay is how long a Consumer waits before receiving again after
+// a ReceiveMessage request failed.
+var receiveErrorDelay = time.Second
+
+// shortPollDelay is how long a Consumer using short polling waits before
+// receiving again after a ReceiveMessage request returned no messages.
+var shortPollDelay = time.Second
+
+// Handler handles a message received by a Consumer. The message is deleted
+// from the queue if the handler returns nil, and becomes visible again when
+// its visibility timeout expires otherwise.
+//
+// The context passed to the handler is not cancelled when the Consumer is
+// stopped, so that in-flight messages are handled to completion.
+type Handler func(ctx aws.Context, msg *sqsextendedclient.Message) error
+
+// MessageError is reported to the ErrorHandler of a Consumer when a message
+// could not be handled or deleted, or its visibility timeout not extended.
+type MessageError struct {
+	// Op is "Handle" if the handler failed, or the name of the API operation
+	// that failed otherwise.
+	Op string
+
+	// Message the error occurred for.
+	Message *sqsextendedclient.Message
+
+	// Err is the error returned by the handler or the API operation.
+	Err error
+}
+
+// Error returns the string representation of the error.
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("%s message %s: %v", e.Op, aws.StringValue(e.Message.MessageId), e.Err)
+}
+
+// OrigErr returns the underlying error.
+func (e *MessageError) OrigErr() error {
+	return e.Err
+}
+
+// The Consumer structure that calls Run(). It receives messages from a queue
+// with long polling, and dispatches each of them to a handler on a bounded
+// pool of goroutines. Mutating the Consumer's properties while it is running
+// is not safe.
+//
+// The Consumer receives no more messages than it has idle goroutines for,
+// so that messages do not wait for a goroutine while their visibility
+// timeout runs.
+type Consumer struct {
+	// The client to receive and delete messages with.
+	SQS sqsextendediface.SQSExtendedAPI
+
+	// URL of the queue to consume messages from.
+	QueueURL string
+
+	// The number of messages handled concurrently. If this is set to zero,
+	// the DefaultConsumerConcurrency value will be used.
+	Concurrency int
+
+	// The maximum number of messages received per ReceiveMessage request,
+	// from 1 to 10. If this is set to zero, the DefaultMaxNumberOfMessages
+	// value will be used.
+	MaxNumberOfMessages int64
+
+	// The duration, in seconds, each ReceiveMessage request long polls for
+	// messages, from 0 to 20. Defaults to DefaultWaitTimeSeconds; set
+	// ShortPoll to use short polling instead.
+	WaitTimeSeconds int64
+
+	// Use short polling instead of long polling, ignoring WaitTimeSeconds.
+	// The Consumer waits a second before receiving again when a short poll
+	// returns no messages.
+	ShortPoll bool
+
+	// The visibility timeout, in seconds, of received messages. If this is
+	// set to zero, the visibility timeout of the queue is used. Required if
+	// HeartbeatInterval is set.
+	VisibilityTimeout int64
+
+	// The interval at which the visibility timeout of the messages being
+	// handled is extended to VisibilityTimeout seconds from then, with
+	// ChangeMessageVisibilityBatch requests, so that long-running handlers
+	// do not need a long VisibilityTimeout. Extensions stop once a message is
+	// deleted or its handler fails. Must be shorter than VisibilityTimeout.
+	// If this is set to zero, the visibility timeout is not extended.
+	HeartbeatInterval time.Duration
+
+	// The maximum time a message is handled for, from when it was received.
+	// Once it has passed, the context passed to the handler is cancelled and
+	// the visibility timeout of the message is no longer extended, so it
+	// becomes visible again. If this is set to zero, the time is not limited,
+	// though SQS does not keep a message invisible for more than 12 hours.
+	MaxProcessingTime time.Duration
+
+	// Delete handled messages in batches with a BatchDeleter, with its
+	// default settings, rather than one at a time. Messages that could not
+	// be deleted are then reported as *DeleteError, and offloaded payloads
+	// that could not be deleted with the error of the DeleteMessageBatch
+	// request.
+	BatchDelete bool
+
+	// The message system attributes to receive with each message, such as
+	// ApproximateReceiveCount or All.
+	AttributeNames []*string
+
+	// The message attributes to receive with each message, or All.
+	MessageAttributeNames []*string
+
+	// Called with errors the Consumer recovers from: failed ReceiveMessage
+	// and ChangeMessageVisibilityBatch requests, and *MessageError for
+	// messages that could not be handled, deleted or extended. Errors are
+	// discarded if ErrorHandler is nil.
+	//
+	// ErrorHandler is called concurrently from the goroutines handling
+	// messages.
+	ErrorHandler func(err error)
+
+	// List of request options that will be passed down to individual API
+	// operation requests made by the consumer.
+	RequestOptions []request.Option
+}
+
+// NewConsumer creates a new Consumer instance to consume messages from the
+// queue at queueURL with svc. Pass in additional functional options to
+// customize the consumer's behavior.
+//
+// Example:
+//
+//	consumer := sqsextendedmanager.NewConsumer(svc, queueURL, func(c *sqsextendedmanager.Consumer) {
+//		c.Concurrency = 32
+//	})
+//
+//	err := consumer.Run(ctx, func(ctx aws.Context, msg *sqsextendedclient.Message) error {
+//		return process(ctx, aws.StringValue(msg.Body))
+//	})
+func NewConsumer(svc sqsextendediface.SQSExtendedAPI, queueURL string, options ...func(*Consumer)) *Consumer {
+	c := &Consumer{
+		SQS:                 svc,
+		QueueURL:            queueURL,
+		Concurrency:         DefaultConsumerConcurrency,
+		MaxNumberOfMessages: DefaultMaxNumberOfMessages,
+		WaitTimeSeconds:     DefaultWaitTimeSeconds,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Validate inspects the fields of the type to determine if they are valid.
+func (c *Consumer) Validate() error {
+	invalidParams := request.ErrInvalidParams{Context: "Consumer"}
+	if c.SQS == nil {
+		invalidParams.Add(request.NewErrParamRequired("SQS"))
+	}
+	if len(c.QueueURL) == 0 {
+		invalidParams.Add(request.NewErrParamRequired("QueueURL"))
+	}
+	if c.Concurrency < 0 {
+		invalidParams.Add(request.NewErrParamMinValue("Concurrency", 0))
+	}
+	if c.MaxNumberOfMessages < 0 {
+		invalidParams.Add(request.NewErrParamMinValue("MaxNumberOfMessages", 0))
+	}
+	if c.MaxNumberOfMessages > DefaultMaxNumberOfMessages {
+		invalidParams.Add(sqsextendedclient.NewErrParamMaxValue("MaxNumberOfMessages", DefaultMaxNumberOfMessages))
+	}
+	if c.WaitTimeSeconds < 0 {
+		invalidParams.Add(request.NewErrParamMinValue("WaitTimeSeconds", 0))
+	}
+	if c.WaitTimeSeconds > DefaultWaitTimeSeconds {
+		invalidParams.Add(sqsextendedclient.NewErrParamMaxValue("WaitTimeSeconds", DefaultWaitTimeSeconds))
+	}
+	if c.VisibilityTimeout < 0 {
+		invalidParams.Add(request.NewErrParamMinValue("VisibilityTimeout", 0))
+	}
+	if c.HeartbeatInterval < 0 {
+		invalidParams.Add(request.NewErrParamMinValue("HeartbeatInterval", 0))
+	}
+	if c.HeartbeatInterval > 0 {
+		if c.VisibilityTimeout == 0 {
+			invalidParams.Add(request.NewErrParamRequired("VisibilityTimeout"))
+		} else if minTimeout := int64(c.HeartbeatInterval/time.Second) + 1; c.VisibilityTimeout < minTimeout {
+			invalidParams.Add(request.NewErrParamMinValue("VisibilityTimeout", float64(minTimeout)))
+		}
+	}
+	if c.MaxProcessingTime < 0 {
+		invalidParams.Add(request.NewErrParamMinValue("MaxProcessingTime", 0))
+	}
+
+	if invalidParams.Len() > 0 {
+		return invalidParams
+	}
+	return nil
+}
+
+// Run receives messages from the queue and calls handler for each of them
+// until ctx is cancelled. Once ctx is cancelled, Run stops receiving,
+// waits for the messages in flight to be handled and deleted, and returns
+// nil.
+//
+// Failed ReceiveMessage requests are retried after a delay, except when the
+// queue does not exist, in which case Run returns the error once in-flight
+// messages are handled. Messages received alongside an
+// sqsextendedclient.ErrCodeRetrievePayload error are handled as usual.
+func (c *Consumer) Run(ctx aws.Context, handler Handler) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if handler == nil {
+		return awserr.New(request.ParamRequiredErrCode, "missing required handler", nil)
+	}
+
+	concurrency := c.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultConsumerConcurrency
+	}
+	maxMessages := c.MaxNumberOfMessages
+	if maxMessages == 0 {
+		maxMessages = DefaultMaxNumberOfMessages
+	}
+
+	// Each goroutine handling a message holds a slot until the message is
+	// deleted, and slots are reserved for messages before they are received.
+	slots := make(chan struct{}, concurrency)
+
+	// In-flight messages are handled and deleted after ctx is cancelled, and
+	// their visibility timeout extended until then.
+	handleCtx := detachedContext{ctx}
+	var hb *heartbeat
+	if c.HeartbeatInterval > 0 {
+		hb = startHeartbeat(handleCtx, c)
+		defer hb.close()
+	}
+	var deleter *BatchDeleter
+	if c.BatchDelete {
+		deleter = NewBatchDeleter(c.SQS, c.QueueURL, func(d *BatchDeleter) {
+			d.ErrorHandler = c.ErrorHandler
+			d.RequestOptions = c.RequestOptions
+		})
+		defer deleter.Close()
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		n := int64(1)
+	reserve:
+		for n < maxMessages {
+			select {
+			case slots <- struct{}{}:
+				n++
+			default:
+				break reserve
+			}
+		}
+
+		received := time.Now()
+		out, err := c.receive(ctx, n)
+		var msgs []*sqsextendedclient.Message
+		if out != nil {
+			msgs = out.Messages
+		}
+		for i := int64(len(msgs)); i < n; i++ {
+			<-slots
+		}
+		if hb != nil {
+			hb.track(received, msgs)
+		}
+		for _, msg := range msgs {
+			wg.Add(1)
+			go func(msg *sqsextendedclient.Message) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				c.handle(handleCtx, handler, msg, received, hb, deleter)
+			}(msg)
+		}
+
+		if err == nil {
+			if c.ShortPoll && len(msgs) == 0 {
+				if err := aws.SleepWithContext(ctx, shortPollDelay); err != nil {
+					return nil
+				}
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if sqsextendedclient.IsQueueDoesNotExist(err) {
+			return err
+		}
+		c.reportError(err)
+		if errCodeIs(err, sqsextendedclient.ErrCodeRetrievePayload) {
+			continue
+		}
+		if err := aws.SleepWithContext(ctx, receiveErrorDelay); err != nil {
+			return nil
+		}
+	}
+}
+
+// receive receives up to n messages from the queue.
+func (c *Consumer) receive(ctx aws.Context, n int64) (*sqsextendedclient.ReceiveMessageOutput, error) {
+	input := &sqsextendedclient.ReceiveMessageInput{
+		QueueUrl:              aws.String(c.QueueURL),
+		MaxNumberOfMessages:   aws.Int64(n),
+		AttributeNames:        c.AttributeNames,
+		MessageAttributeNames: c.MessageAttributeNames,
+	}
+	if !c.ShortPoll {
+		waitTime := c.WaitTimeSeconds
+		if waitTime == 0 {
+			waitTime = DefaultWaitTimeSeconds
+		}
+		input.WaitTimeSeconds = aws.Int64(waitTime)
+	}
+	if c.VisibilityTimeout > 0 {
+		input.VisibilityTimeout = aws.Int64(c.VisibilityTimeout)
+	}
+	return c.SQS.ReceiveMessageWithContext(ctx, input, c.RequestOptions...)
+}
+
+// handle calls handler for msg, and deletes msg, through deleter if any, if
+// it succeeds. The visibility timeout of msg is no longer extended by hb, if
+// any, once the handler returns.
+func (c *Consumer) handle(ctx aws.Context, handler Handler, msg *sqsextendedclient.Message, received time.Time, hb *heartbeat, deleter *BatchDeleter) {
+	handlerCtx := ctx
+	if c.MaxProcessingTime > 0 {
+		var cancel context.CancelFunc
+		handlerCtx, cancel = context.WithDeadline(ctx, received.Add(c.MaxProcessingTime))
+		defer cancel()
+	}
+	err := handler(handlerCtx, msg)
+	if hb != nil {
+		hb.untrack(msg)
+	}
+	if err != nil {
+		c.reportError(&MessageError{Op: "Handle", Message: msg, Err: err})
+		return
+	}
+	if deleter != nil {
+		deleter.Delete(aws.StringValue(msg.ReceiptHandle))
+		return
+	}
+	_, err = c.SQS.DeleteMessageWithContext(ctx, &sqsextendedclient.DeleteMessageInput{
+		QueueUrl:      aws.String(c.QueueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	}, c.RequestOptions...)
+	if err != nil {
+		c.reportError(&MessageError{Op: "DeleteMessage", Message: msg, Err: err})
+	}
+}
+
+// reportError passes err to the ErrorHandler, if any.
+func (c *Consumer) reportError(err error) {
+	if c.ErrorHandler != nil {
+		c.ErrorHandler(err)
+	}
+}
+
+// detachedContext is a context carrying the values of its parent, but not
+// its deadline or cancellation.
+type detachedContext struct {
+	aws.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
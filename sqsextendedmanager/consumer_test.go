@@ -0,0 +1,245 @@
+package sqsextendedmanager_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendedmanager"
+)
+
+// runConsumer runs c with handler until stop is called, which returns the
+// error of Run.
+func runConsumer(c *sqsextendedmanager.Consumer, handler sqsextendedmanager.Handler) (stop func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx, handler)
+	}()
+	return func() error {
+		cancel()
+		return <-done
+	}
+}
+
+// waitFor polls cond until it returns true, and fails the test if it does
+// not within 10 seconds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConsumerRun(t *testing.T) {
+	f := newFakes(t, map[string]string{"VisibilityTimeout": "1"})
+	var bodies []string
+	for i := 0; i < 30; i++ {
+		bodies = append(bodies, strconv.Itoa(i))
+	}
+	f.send(t, bodies...)
+	large := strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold+1)
+	_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String(large),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	var mu sync.Mutex
+	var inflight, maxInflight int
+	handled := map[string]int{}
+	var errs []error
+
+	consumer := sqsextendedmanager.NewConsumer(f.svc, f.queueURL, func(c *sqsextendedmanager.Consumer) {
+		c.Concurrency = 4
+		c.WaitTimeSeconds = 1
+		c.ErrorHandler = func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}
+	})
+	stop := runConsumer(consumer, func(ctx aws.Context, msg *sqsextendedclient.Message) error {
+		mu.Lock()
+		inflight++
+		if inflight > maxInflight {
+			maxInflight = inflight
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		inflight--
+		body := aws.StringValue(msg.Body)
+		handled[body]++
+		if body == "7" && handled[body] == 1 {
+			return errors.New("handler failed")
+		}
+		return nil
+	})
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == 31 && handled["7"] == 2
+	})
+	if err := stop(); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	if maxInflight > 4 {
+		t.Errorf("expect at most 4 messages in flight, got %v", maxInflight)
+	}
+	if e, a := 1, handled[large]; e != a {
+		t.Errorf("expect offloaded message to be handled %v times, got %v", e, a)
+	}
+	if e, a := 1, len(errs); e != a {
+		t.Fatalf("expect %v errors, got %v", e, errs)
+	}
+	merr, ok := errs[0].(*sqsextendedmanager.MessageError)
+	if !ok {
+		t.Fatalf("expect *MessageError, got %T", errs[0])
+	}
+	if e, a := "Handle", merr.Op; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 0, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+	if e, a := 0, len(f.s3.Keys(testBucket)); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+}
+
+func TestConsumerDrainsInFlightMessages(t *testing.T) {
+	f := newFakes(t, nil)
+	f.send(t, "hello")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	consumer := sqsextendedmanager.NewConsumer(f.svc, f.queueURL, func(c *sqsextendedmanager.Consumer) {
+		c.WaitTimeSeconds = 1
+	})
+	stop := runConsumer(consumer, func(ctx aws.Context, msg *sqsextendedclient.Message) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	})
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- stop()
+	}()
+	select {
+	case err := <-stopped:
+		t.Fatalf("expect Run to wait for in-flight messages, returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	if e, a := 0, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
+
+func TestConsumerShortPoll(t *testing.T) {
+	defer sqsextendedmanager.SetShortPollDelay(100 * time.Millisecond)()
+
+	f := newFakes(t, nil)
+	consumer := sqsextendedmanager.NewConsumer(f.svc, f.queueURL, func(c *sqsextendedmanager.Consumer) {
+		c.ShortPoll = true
+	})
+	stop := runConsumer(consumer, func(ctx aws.Context, msg *sqsextendedclient.Message) error {
+		return nil
+	})
+	time.Sleep(350 * time.Millisecond)
+	if err := stop(); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	if n := f.count("ReceiveMessage"); n < 1 || n > 5 {
+		t.Errorf("expect 1 to 5 ReceiveMessage requests, got %v", n)
+	}
+}
+
+func TestConsumerQueueDoesNotExist(t *testing.T) {
+	f := newFakes(t, nil)
+	consumer := sqsextendedmanager.NewConsumer(f.svc, f.sqs.QueueURL("missing"))
+
+	err := consumer.Run(context.Background(), func(ctx aws.Context, msg *sqsextendedclient.Message) error {
+		return nil
+	})
+	if !sqsextendedclient.IsQueueDoesNotExist(err) {
+		t.Errorf("expect queue does not exist error, got %v", err)
+	}
+}
+
+func TestConsumerValidate(t *testing.T) {
+	cases := map[string]struct {
+		Option func(*sqsextendedmanager.Consumer)
+		Code   string
+	}{
+		"default": {
+			Option: func(c *sqsextendedmanager.Consumer) {},
+		},
+		"missing queue URL": {
+			Option: func(c *sqsextendedmanager.Consumer) { c.QueueURL = "" },
+			Code:   request.InvalidParameterErrCode,
+		},
+		"too many messages": {
+			Option: func(c *sqsextendedmanager.Consumer) { c.MaxNumberOfMessages = 11 },
+			Code:   request.InvalidParameterErrCode,
+		},
+		"heartbeat without visibility timeout": {
+			Option: func(c *sqsextendedmanager.Consumer) { c.HeartbeatInterval = time.Second },
+			Code:   request.InvalidParameterErrCode,
+		},
+		"heartbeat longer than visibility timeout": {
+			Option: func(c *sqsextendedmanager.Consumer) {
+				c.HeartbeatInterval = 2 * time.Second
+				c.VisibilityTimeout = 2
+			},
+			Code: request.InvalidParameterErrCode,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			consumer := sqsextendedmanager.NewConsumer(&sqsextendedclient.SQSExtended{}, "queue", c.Option)
+
+			err := consumer.Validate()
+			if len(c.Code) == 0 {
+				if err != nil {
+					t.Fatalf("expect no error, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expect error, got nil")
+			}
+			if e, a := c.Code, err.(awserr.Error).Code(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package sqsextendedmanager
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendediface"
+)
+
+const (
+	// DefaultBatchDeleteMaxDelay is the default time a BatchDeleter holds a
+	// receipt handle for, waiting for a batch to fill up.
+	DefaultBatchDeleteMaxDelay = 100 * time.Millisecond
+
+	// DefaultBatchDeleteMaxRetries is the default number of times a
+	// BatchDeleter retries deleting a message after a retryable failure.
+	DefaultBatchDeleteMaxRetries = DefaultBatchMaxRetries
+)
+
+// DeleteError is reported to the ErrorHandler of a BatchDeleter for each
+// receipt handle that could not be deleted.
+type DeleteError struct {
+	// ReceiptHandle that could not be deleted.
+	ReceiptHandle string
+
+	// Err is an awserr.Error with the code and message of the failed batch
+	// entry, or the error of the DeleteMessageBatch request.
+	Err error
+}
+
+// Error returns the string representation of the error.
+func (e *DeleteError) Error() string {
+	return fmt.Sprintf("failed to delete message: %v", e.Err)
+}
+
+// OrigErr returns the underlying error.
+func (e *DeleteError) OrigErr() error {
+	return e.Err
+}
+
+// The BatchDeleter structure that calls Delete(). It buffers receipt handles
+// and deletes them with DeleteMessageBatch requests of up to 10 entries, so
+// that a high-throughput consumer makes one request per 10 messages instead
+// of one per message. It is safe to call Delete() concurrently. Mutating the
+// BatchDeleter's properties once Delete() was called is not safe.
+//
+// A batch is sent as soon as it holds 10 receipt handles, or MaxDelay after
+// its first receipt handle was added. Entries that fail with a retryable
+// error, such as throttling or an internal error, are retried; other
+// failures are reported to ErrorHandler.
+type BatchDeleter struct {
+	// The client to delete messages with.
+	SQS sqsextendediface.SQSExtendedAPI
+
+	// URL of the queue to delete messages from.
+	QueueURL string
+
+	// The maximum time a receipt handle is held for before it is deleted,
+	// waiting for a batch to fill up. Defaults to DefaultBatchDeleteMaxDelay.
+	MaxDelay time.Duration
+
+	// The maximum number of times a failed entry is retried. Defaults to
+	// DefaultBatchDeleteMaxRetries.
+	MaxRetries int
+
+	// Called with a *DeleteError for each receipt handle that could not be
+	// deleted, and with the sqsextendedclient.ErrCodeDeletePayload error of
+	// requests that deleted messages but not all of their offloaded
+	// payloads. Errors are discarded if ErrorHandler is nil.
+	//
+	// ErrorHandler is called concurrently from the goroutines sending
+	// batches.
+	ErrorHandler func(err error)
+
+	// List of request options that will be passed down to individual API
+	// operation requests made by the deleter.
+	RequestOptions []request.Option
+
+	mu         sync.Mutex
+	pending    []string
+	generation int
+	timer      *time.Timer
+	wg         sync.WaitGroup
+
+	// ctx is canceled to stop the batches in flight, once a close times out.
+	ctx    aws.Context
+	cancel func()
+}
+
+// NewBatchDeleter creates a new BatchDeleter instance to delete messages from
+// the queue at queueURL with svc. Pass in additional functional options to
+// customize the deleter's behavior.
+//
+// Example:
+//
+//	deleter := sqsextendedmanager.NewBatchDeleter(svc, queueURL, func(d *sqsextendedmanager.BatchDeleter) {
+//		d.MaxDelay = time.Second
+//	})
+//	defer deleter.Close()
+//
+//	deleter.Delete(aws.StringValue(msg.ReceiptHandle))
+func NewBatchDeleter(svc sqsextendediface.SQSExtendedAPI, queueURL string, options ...func(*BatchDeleter)) *BatchDeleter {
+	d := &BatchDeleter{
+		SQS:        svc,
+		QueueURL:   queueURL,
+		MaxDelay:   DefaultBatchDeleteMaxDelay,
+		MaxRetries: DefaultBatchDeleteMaxRetries,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+// Delete adds receiptHandle to the next batch. It does not wait for the
+// message to be deleted.
+func (d *BatchDeleter) Delete(receiptHandle string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pending = append(d.pending, receiptHandle)
+	if len(d.pending) == maxBatchEntries {
+		d.flush()
+	} else if len(d.pending) == 1 {
+		generation := d.generation
+		d.timer = time.AfterFunc(d.MaxDelay, func() {
+			d.flushGeneration(generation)
+		})
+	}
+}
+
+// Flush sends the receipt handles added so far, without waiting for the
+// batch to fill up. It does not wait for the messages to be deleted.
+func (d *BatchDeleter) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flush()
+}
+
+// flushGeneration is called by the timer of the given generation of pending
+// receipt handles, and flushes them unless they were flushed already.
+func (d *BatchDeleter) flushGeneration(generation int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.generation == generation {
+		d.flush()
+	}
+}
+
+// Close sends the receipt handles added so far, and waits for all batches,
+// including retries, to complete. Delete must not be called after Close.
+func (d *BatchDeleter) Close() {
+	d.CloseWithContext(aws.BackgroundContext())
+}
+
+// CloseWithContext is the same as Close, but stops waiting once ctx is done.
+// The requests and retries still in flight are then canceled, and the
+// receipt handles they had not deleted are reported to the ErrorHandler.
+// Returns an awserr.Error with code request.CanceledErrorCode in that case.
+func (d *BatchDeleter) CloseWithContext(ctx aws.Context) error {
+	d.Flush()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	d.mu.Lock()
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.mu.Unlock()
+	<-done
+	return awserr.New(request.CanceledErrorCode, "close of batch deleter canceled", ctx.Err())
+}
+
+// flush sends the pending receipt handles in a new batch. d.mu must be held.
+func (d *BatchDeleter) flush() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if len(d.pending) == 0 {
+		return
+	}
+	batch := d.pending
+	d.pending = nil
+	d.generation++
+
+	if d.ctx == nil {
+		d.ctx, d.cancel = context.WithCancel(aws.BackgroundContext())
+	}
+	ctx := d.ctx
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.send(ctx, batch)
+	}()
+}
+
+// send deletes a batch of receipt handles, retrying entries that failed with
+// a retryable error, and reporting the others.
+func (d *BatchDeleter) send(ctx aws.Context, receiptHandles []string) {
+	entries := make([]*sqsextendedclient.DeleteMessageBatchRequestEntry, len(receiptHandles))
+	ids := make([]*string, len(receiptHandles))
+	for i, receiptHandle := range receiptHandles {
+		ids[i] = aws.String(strconv.Itoa(i))
+		entries[i] = &sqsextendedclient.DeleteMessageBatchRequestEntry{
+			Id:            ids[i],
+			ReceiptHandle: aws.String(receiptHandle),
+		}
+	}
+
+	settled := make([]bool, len(receiptHandles))
+	settle := func(id *string) (int, bool) {
+		i, err := strconv.Atoi(aws.StringValue(id))
+		if err != nil || i < 0 || i >= len(receiptHandles) || settled[i] {
+			return 0, false
+		}
+		settled[i] = true
+		return i, true
+	}
+
+	failed, payloadErr, err := NewBatchRetryer(d.SQS).retry(ctx, ids, d.MaxRetries, func(pending []int) ([]*sqsextendedclient.BatchResultErrorEntry, error) {
+		params := make([]*sqsextendedclient.DeleteMessageBatchRequestEntry, len(pending))
+		for i, j := range pending {
+			params[i] = entries[j]
+		}
+		out, err := d.SQS.DeleteMessageBatchWithContext(ctx, &sqsextendedclient.DeleteMessageBatchInput{
+			QueueUrl: aws.String(d.QueueURL),
+			Entries:  params,
+		}, d.RequestOptions...)
+		if out == nil {
+			return nil, err
+		}
+		for _, entry := range out.Successful {
+			settle(entry.Id)
+		}
+		return out.Failed, err
+	})
+	if payloadErr != nil {
+		// The messages were deleted, but some of their offloaded payloads
+		// could not be.
+		d.reportError(payloadErr)
+	}
+	for _, entry := range failed {
+		if i, ok := settle(entry.Id); ok {
+			d.reportError(&DeleteError{ReceiptHandle: receiptHandles[i], Err: batchEntryError(entry)})
+		}
+	}
+	if err == nil {
+		return
+	}
+	// Report the entries that were neither deleted nor failed.
+	for i, receiptHandle := range receiptHandles {
+		if !settled[i] {
+			d.reportError(&DeleteError{ReceiptHandle: receiptHandle, Err: err})
+		}
+	}
+}
+
+// reportError passes err to the ErrorHandler, if any.
+func (d *BatchDeleter) reportError(err error) {
+	if d.ErrorHandler != nil {
+		d.ErrorHandler(err)
+	}
+}
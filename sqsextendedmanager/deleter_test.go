@@ -0,0 +1,292 @@
+package sqsextendedmanager_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendedmanager"
+	"github.com/chojy/sqsextended/sqsextendedtest"
+)
+
+// errorLog records the errors passed to an ErrorHandler, which is called
+// concurrently.
+type errorLog struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (l *errorLog) add(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errs = append(l.errs, err)
+}
+
+func (l *errorLog) errors() []error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]error(nil), l.errs...)
+}
+
+// receiveHandles receives n messages with the client under test, and returns
+// their receipt handles.
+func (f *fakes) receiveHandles(t *testing.T, n int) []string {
+	t.Helper()
+
+	var handles []string
+	for len(handles) < n {
+		out, err := f.svc.ReceiveMessage(&sqsextendedclient.ReceiveMessageInput{
+			QueueUrl:            aws.String(f.queueURL),
+			MaxNumberOfMessages: aws.Int64(10),
+			WaitTimeSeconds:     aws.Int64(1),
+		})
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+		if len(out.Messages) == 0 {
+			t.Fatalf("expect %v messages, got %v", n, len(handles))
+		}
+		for _, msg := range out.Messages {
+			handles = append(handles, aws.StringValue(msg.ReceiptHandle))
+		}
+	}
+	return handles
+}
+
+func TestBatchDeleterBatches(t *testing.T) {
+	f := newFakes(t, nil)
+	var bodies []string
+	for i := 0; i < 24; i++ {
+		bodies = append(bodies, strconv.Itoa(i))
+	}
+	f.send(t, bodies...)
+	_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String(strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold+1)),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	handles := f.receiveHandles(t, 25)
+
+	var log errorLog
+	deleter := sqsextendedmanager.NewBatchDeleter(f.svc, f.queueURL, func(d *sqsextendedmanager.BatchDeleter) {
+		d.MaxDelay = time.Hour
+		d.ErrorHandler = log.add
+	})
+	for _, handle := range handles {
+		deleter.Delete(handle)
+	}
+	deleter.Close()
+	errs := log.errors()
+
+	if e, a := 3, f.count("DeleteMessageBatch"); e != a {
+		t.Errorf("expect %v DeleteMessageBatch requests, got %v", e, a)
+	}
+	if len(errs) > 0 {
+		t.Errorf("expect no errors, got %v", errs)
+	}
+	if e, a := 0, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+	if e, a := 0, len(f.s3.Keys(testBucket)); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+}
+
+func TestBatchDeleterMaxDelay(t *testing.T) {
+	f := newFakes(t, nil)
+	f.send(t, "hello")
+	handles := f.receiveHandles(t, 1)
+
+	deleter := sqsextendedmanager.NewBatchDeleter(f.svc, f.queueURL, func(d *sqsextendedmanager.BatchDeleter) {
+		d.MaxDelay = 50 * time.Millisecond
+	})
+	defer deleter.Close()
+	deleter.Delete(handles[0])
+
+	waitFor(t, func() bool {
+		return f.messages(t) == 0
+	})
+	if e, a := 1, f.count("DeleteMessageBatch"); e != a {
+		t.Errorf("expect %v DeleteMessageBatch requests, got %v", e, a)
+	}
+}
+
+func TestBatchDeleterFailures(t *testing.T) {
+	f := newFakes(t, nil)
+	f.send(t, "ok", "flaky", "throttled")
+	handles := f.receiveHandles(t, 3)
+
+	// Entry Ids are the indexes of the receipt handles in the batch.
+	svc := &failingBatches{
+		SQSExtendedAPI: f.svc,
+		Failures: map[string]*failure{
+			"1": {Times: 2, Entry: sqsextendedclient.BatchResultErrorEntry{
+				Code:        aws.String("InternalError"),
+				SenderFault: aws.Bool(false),
+			}},
+			"2": {Times: 100, Entry: sqsextendedclient.BatchResultErrorEntry{
+				Code:        aws.String("RequestThrottled"),
+				SenderFault: aws.Bool(true),
+			}},
+		},
+	}
+	var log errorLog
+	deleter := sqsextendedmanager.NewBatchDeleter(svc, f.queueURL, func(d *sqsextendedmanager.BatchDeleter) {
+		d.MaxRetries = 2
+		d.ErrorHandler = log.add
+	})
+	for _, handle := range handles {
+		deleter.Delete(handle)
+	}
+	deleter.Delete("invalid")
+	deleter.Close()
+	errs := log.errors()
+
+	expect := map[string]string{
+		handles[2]: "RequestThrottled",
+		"invalid":  sqsextendedclient.ErrCodeReceiptHandleIsInvalid,
+	}
+	if e, a := len(expect), len(errs); e != a {
+		t.Fatalf("expect %v errors, got %v", e, errs)
+	}
+	for _, err := range errs {
+		derr, ok := err.(*sqsextendedmanager.DeleteError)
+		if !ok {
+			t.Fatalf("expect *DeleteError, got %T", err)
+		}
+		if e, a := expect[derr.ReceiptHandle], derr.Err.(awserr.Error).Code(); e != a {
+			t.Errorf("expect %v, got %v", e, a)
+		}
+	}
+	// The throttled message is retried twice, and the flaky one succeeds on
+	// the second retry.
+	if e, a := 3, svc.Calls; e != a {
+		t.Errorf("expect %v DeleteMessageBatch requests, got %v", e, a)
+	}
+	if e, a := 1, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
+
+func TestBatchDeleterDeletePayloadError(t *testing.T) {
+	f := newFakes(t, nil)
+	handles := f.sendLarge(t, 2)
+	f.s3.InjectFault(sqsextendedtest.Fault{Method: "DELETE", Key: "*", StatusCode: 403, Code: "AccessDenied", Times: 1})
+
+	var log errorLog
+	deleter := sqsextendedmanager.NewBatchDeleter(f.svc, f.queueURL, func(d *sqsextendedmanager.BatchDeleter) {
+		d.ErrorHandler = log.add
+	})
+	for _, handle := range handles {
+		deleter.Delete(handle)
+	}
+	deleter.Close()
+	errs := log.errors()
+
+	// The messages are deleted, so only the payload error is reported.
+	if e, a := 1, len(errs); e != a {
+		t.Fatalf("expect %v errors, got %v", e, errs)
+	}
+	if e, a := sqsextendedclient.ErrCodeDeletePayload, errs[0].(awserr.Error).Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 0, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+	if e, a := 1, len(f.s3.Keys(testBucket)); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+}
+
+func TestBatchDeleterStaleTimer(t *testing.T) {
+	f := newFakes(t, nil)
+	f.send(t, "first", "second")
+	handles := f.receiveHandles(t, 2)
+
+	deleter := sqsextendedmanager.NewBatchDeleter(f.svc, f.queueURL, func(d *sqsextendedmanager.BatchDeleter) {
+		d.MaxDelay = time.Hour
+	})
+	deleter.Delete(handles[0])
+	generation := deleter.Generation()
+	deleter.Flush()
+
+	// The timer of the first batch fires after the batch was flushed, and
+	// must not flush the next one.
+	deleter.Delete(handles[1])
+	deleter.FlushGeneration(generation)
+	time.Sleep(50 * time.Millisecond)
+	if e, a := 1, f.count("DeleteMessageBatch"); e != a {
+		t.Errorf("expect %v DeleteMessageBatch requests, got %v", e, a)
+	}
+
+	deleter.Close()
+	if e, a := 2, f.count("DeleteMessageBatch"); e != a {
+		t.Errorf("expect %v DeleteMessageBatch requests, got %v", e, a)
+	}
+	if e, a := 0, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
+
+func TestBatchDeleterCloseWithContext(t *testing.T) {
+	f := newFakes(t, nil)
+	f.send(t, "ok", "throttled")
+	handles := f.receiveHandles(t, 2)
+
+	svc := &failingBatches{
+		SQSExtendedAPI: f.svc,
+		Failures: map[string]*failure{
+			"1": {Times: 100, Entry: sqsextendedclient.BatchResultErrorEntry{
+				Code:        aws.String("RequestThrottled"),
+				SenderFault: aws.Bool(true),
+			}},
+		},
+	}
+	var log errorLog
+	deleter := sqsextendedmanager.NewBatchDeleter(svc, f.queueURL, func(d *sqsextendedmanager.BatchDeleter) {
+		d.MaxRetries = 100
+		d.ErrorHandler = log.add
+	})
+	for _, handle := range handles {
+		deleter.Delete(handle)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := deleter.CloseWithContext(ctx)
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if e, a := request.CanceledErrorCode, err.(awserr.Error).Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expect close to stop retrying, took %v", elapsed)
+	}
+
+	// The throttled message is reported as not deleted.
+	errs := log.errors()
+	if e, a := 1, len(errs); e != a {
+		t.Fatalf("expect %v errors, got %v", e, errs)
+	}
+	derr, ok := errs[0].(*sqsextendedmanager.DeleteError)
+	if !ok {
+		t.Fatalf("expect *DeleteError, got %T", errs[0])
+	}
+	if e, a := handles[1], derr.ReceiptHandle; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 1, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
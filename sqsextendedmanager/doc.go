@@ -0,0 +1,3 @@
+// Package sqsextendedmanager provides utilities to consume messages from and
+// produce messages to SQS queues concurrently with the SQSExtended client.
+package sqsextendedmanager
@@ -0,0 +1,39 @@
+package sqsextendedmanager
+
+import "time"
+
+// SetShortPollDelay sets how long a Consumer using short polling waits after
+// a receive returned no messages, and returns a function restoring it.
+func SetShortPollDelay(d time.Duration) (restore func()) {
+	prev := shortPollDelay
+	shortPollDelay = d
+	return func() { shortPollDelay = prev }
+}
+
+// Generation returns the generation of the messages pending in p, which
+// flushing them ends.
+func (p *Producer) Generation() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.generation
+}
+
+// FlushGeneration is what the timer p starts for the given generation of
+// pending messages calls when it fires.
+func (p *Producer) FlushGeneration(generation int) {
+	p.flushGeneration(generation)
+}
+
+// Generation returns the generation of the receipt handles pending in d,
+// which flushing them ends.
+func (d *BatchDeleter) Generation() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.generation
+}
+
+// FlushGeneration is what the timer d starts for the given generation of
+// pending receipt handles calls when it fires.
+func (d *BatchDeleter) FlushGeneration(generation int) {
+	d.flushGeneration(generation)
+}
@@ -0,0 +1,202 @@
+package sqsextendedmanager_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendediface"
+	"github.com/chojy/sqsextended/sqsextendedtest"
+)
+
+// testBucket is the bucket of the fake S3 server payloads are offloaded to.
+const testBucket = "payloads"
+
+// fakes is a client talking to fake services, and the queue under test.
+type fakes struct {
+	svc      *sqsextendedclient.SQSExtended
+	sqs      *sqsextendedtest.SQSServer
+	s3       *sqsextendedtest.S3Server
+	queueURL string
+
+	// raw is a plain SQS client, to inspect messages as they are in SQS.
+	raw *sqs.SQS
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// newFakes starts a fake SQS server with a queue with the given attributes,
+// named queue.fifo for FIFO queues and queue otherwise, and a fake S3 server
+// with testBucket, and returns a client with large payload support talking
+// to them. Requests are not retried, and counted by operation.
+func newFakes(t *testing.T, attrs map[string]string) *fakes {
+	t.Helper()
+
+	f := &fakes{
+		sqs:   sqsextendedtest.NewSQSServer(),
+		s3:    sqsextendedtest.NewS3Server(),
+		calls: map[string]int{},
+	}
+	t.Cleanup(f.sqs.Close)
+	t.Cleanup(f.s3.Close)
+
+	var err error
+	f.svc, err = sqsextendedtest.NewClient(unit.Session, f.sqs, f.s3, testBucket)
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	f.svc.Handlers.Send.PushFront(func(r *request.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.calls[r.Operation.Name]++
+	})
+	f.raw = sqs.New(unit.Session, f.sqs.Config().WithMaxRetries(0))
+
+	name := "queue"
+	if attrs["FifoQueue"] == "true" {
+		name += ".fifo"
+	}
+	out, err := f.raw.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: aws.StringMap(attrs),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	f.queueURL = aws.StringValue(out.QueueUrl)
+	return f
+}
+
+// count returns the number of op requests sent so far.
+func (f *fakes) count(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// send sends messages with the given bodies with the plain SQS client.
+func (f *fakes) send(t *testing.T, bodies ...string) {
+	t.Helper()
+
+	for _, body := range bodies {
+		_, err := f.raw.SendMessage(&sqs.SendMessageInput{
+			QueueUrl:    aws.String(f.queueURL),
+			MessageBody: aws.String(body),
+		})
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+	}
+}
+
+// attribute returns the value of a queue attribute, such as
+// ApproximateNumberOfMessages.
+func (f *fakes) attribute(t *testing.T, name string) int {
+	t.Helper()
+
+	out, err := f.raw.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(f.queueURL),
+		AttributeNames: []*string{aws.String(name)},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	v, _ := strconv.Atoi(aws.StringValue(out.Attributes[name]))
+	return v
+}
+
+// messages returns the number of messages in the queue, visible or not.
+func (f *fakes) messages(t *testing.T) int {
+	t.Helper()
+
+	return f.attribute(t, "ApproximateNumberOfMessages") +
+		f.attribute(t, "ApproximateNumberOfMessagesNotVisible") +
+		f.attribute(t, "ApproximateNumberOfMessagesDelayed")
+}
+
+// failingBatches fails the entries of batch requests whose Id is in
+// Failures, with the entry in Failures, the given number of times, and
+// passes the other entries to the client. Calls counts the batch requests.
+type failingBatches struct {
+	sqsextendediface.SQSExtendedAPI
+
+	mu       sync.Mutex
+	Failures map[string]*failure
+	Calls    int
+}
+
+type failure struct {
+	Times int
+	Entry sqsextendedclient.BatchResultErrorEntry
+}
+
+// failEntries counts a batch request of b, and returns the entries to pass
+// on to the client, and the results of those that fail.
+func failEntries[E any](b *failingBatches, entries []E, id func(E) *string) ([]E, []*sqsextendedclient.BatchResultErrorEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Calls++
+	var pass []E
+	var failed []*sqsextendedclient.BatchResultErrorEntry
+	for _, entry := range entries {
+		f, ok := b.Failures[aws.StringValue(id(entry))]
+		if !ok || f.Times == 0 {
+			pass = append(pass, entry)
+			continue
+		}
+		f.Times--
+		result := f.Entry
+		result.Id = id(entry)
+		failed = append(failed, &result)
+	}
+	return pass, failed
+}
+
+func (b *failingBatches) SendMessageBatchWithContext(ctx aws.Context, input *sqsextendedclient.SendMessageBatchInput, opts ...request.Option) (*sqsextendedclient.SendMessageBatchOutput, error) {
+	params := *input
+	var failed []*sqsextendedclient.BatchResultErrorEntry
+	params.Entries, failed = failEntries(b, input.Entries, func(e *sqsextendedclient.SendMessageBatchRequestEntry) *string { return e.Id })
+
+	out := &sqsextendedclient.SendMessageBatchOutput{}
+	var err error
+	if len(params.Entries) > 0 {
+		out, err = b.SQSExtendedAPI.SendMessageBatchWithContext(ctx, &params, opts...)
+	}
+	out.Failed = append(out.Failed, failed...)
+	return out, err
+}
+
+func (b *failingBatches) DeleteMessageBatchWithContext(ctx aws.Context, input *sqsextendedclient.DeleteMessageBatchInput, opts ...request.Option) (*sqsextendedclient.DeleteMessageBatchOutput, error) {
+	params := *input
+	var failed []*sqsextendedclient.BatchResultErrorEntry
+	params.Entries, failed = failEntries(b, input.Entries, func(e *sqsextendedclient.DeleteMessageBatchRequestEntry) *string { return e.Id })
+
+	out := &sqsextendedclient.DeleteMessageBatchOutput{}
+	var err error
+	if len(params.Entries) > 0 {
+		out, err = b.SQSExtendedAPI.DeleteMessageBatchWithContext(ctx, &params, opts...)
+	}
+	out.Failed = append(out.Failed, failed...)
+	return out, err
+}
+
+func (b *failingBatches) ChangeMessageVisibilityBatchWithContext(ctx aws.Context, input *sqsextendedclient.ChangeMessageVisibilityBatchInput, opts ...request.Option) (*sqsextendedclient.ChangeMessageVisibilityBatchOutput, error) {
+	params := *input
+	var failed []*sqsextendedclient.BatchResultErrorEntry
+	params.Entries, failed = failEntries(b, input.Entries, func(e *sqsextendedclient.ChangeMessageVisibilityBatchRequestEntry) *string { return e.Id })
+
+	out := &sqsextendedclient.ChangeMessageVisibilityBatchOutput{}
+	var err error
+	if len(params.Entries) > 0 {
+		out, err = b.SQSExtendedAPI.ChangeMessageVisibilityBatchWithContext(ctx, &params, opts...)
+	}
+	out.Failed = append(out.Failed, failed...)
+	return out, err
+}
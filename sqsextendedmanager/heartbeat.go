@@ -0,0 +1,172 @@
+package sqsextendedmanager
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+// maxVisibilityTimeout is the longest a message can be kept invisible after
+// it was received, including extensions of its visibility timeout.
+const maxVisibilityTimeout = 12 * time.Hour
+
+// inflightMessage is a message tracked by a heartbeat.
+type inflightMessage struct {
+	msg      *sqsextendedclient.Message
+	received time.Time
+}
+
+// heartbeat periodically extends the visibility timeout of the messages a
+// Consumer is handling, until they are untracked or their maximum
+// processing time runs out.
+type heartbeat struct {
+	c *Consumer
+
+	mu       sync.Mutex
+	inflight map[*sqsextendedclient.Message]*inflightMessage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startHeartbeat starts extending the visibility timeout of tracked messages
+// every c.HeartbeatInterval. The heartbeat must be stopped with close.
+func startHeartbeat(ctx aws.Context, c *Consumer) *heartbeat {
+	h := &heartbeat{
+		c:        c,
+		inflight: map[*sqsextendedclient.Message]*inflightMessage{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go h.run(ctx)
+	return h
+}
+
+// track starts extending the visibility timeout of msgs, received at the
+// given time.
+func (h *heartbeat) track(received time.Time, msgs []*sqsextendedclient.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, msg := range msgs {
+		h.inflight[msg] = &inflightMessage{msg: msg, received: received}
+	}
+}
+
+// untrack stops extending the visibility timeout of msg.
+func (h *heartbeat) untrack(msg *sqsextendedclient.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.inflight, msg)
+}
+
+// close stops the heartbeat and waits for it to return.
+func (h *heartbeat) close() {
+	close(h.stop)
+	<-h.done
+}
+
+func (h *heartbeat) run(ctx aws.Context) {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.c.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.beat(ctx, time.Now())
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// beat extends the visibility timeout of the tracked messages, in batches.
+// Messages whose maximum processing time has run out are untracked, and left
+// to become visible again.
+func (h *heartbeat) beat(ctx aws.Context, now time.Time) {
+	var entries []*sqsextendedclient.ChangeMessageVisibilityBatchRequestEntry
+	msgs := map[string]*sqsextendedclient.Message{}
+
+	h.mu.Lock()
+	for msg, m := range h.inflight {
+		timeout := h.c.visibilityExtension(m.received, now)
+		if timeout <= 0 {
+			delete(h.inflight, msg)
+			continue
+		}
+		id := strconv.Itoa(len(entries))
+		msgs[id] = msg
+		entries = append(entries, &sqsextendedclient.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                aws.String(id),
+			ReceiptHandle:     msg.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(timeout),
+		})
+	}
+	h.mu.Unlock()
+
+	for len(entries) > 0 {
+		n := len(entries)
+		if n > maxBatchEntries {
+			n = maxBatchEntries
+		}
+		h.extend(ctx, entries[:n], msgs)
+		entries = entries[n:]
+	}
+}
+
+// extend sends a batch of visibility timeout extensions. Messages whose
+// extension was rejected as invalid are untracked.
+func (h *heartbeat) extend(ctx aws.Context, entries []*sqsextendedclient.ChangeMessageVisibilityBatchRequestEntry, msgs map[string]*sqsextendedclient.Message) {
+	out, err := h.c.SQS.ChangeMessageVisibilityBatchWithContext(ctx, &sqsextendedclient.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String(h.c.QueueURL),
+		Entries:  entries,
+	}, h.c.RequestOptions...)
+	if err != nil {
+		h.c.reportError(err)
+		return
+	}
+	for _, entry := range out.Failed {
+		msg, ok := msgs[aws.StringValue(entry.Id)]
+		if !ok {
+			continue
+		}
+		// Messages are untracked before they are deleted, so extensions
+		// that raced with a delete fail for messages no longer tracked.
+		h.mu.Lock()
+		_, ok = h.inflight[msg]
+		if ok && aws.BoolValue(entry.SenderFault) {
+			delete(h.inflight, msg)
+		}
+		h.mu.Unlock()
+		if !ok {
+			continue
+		}
+		h.c.reportError(&MessageError{
+			Op:      "ChangeMessageVisibility",
+			Message: msg,
+			Err:     batchEntryError(entry),
+		})
+	}
+}
+
+// visibilityExtension returns the visibility timeout, in seconds, to extend
+// a message received at the given time to, or 0 if it must not be extended
+// any further.
+func (c *Consumer) visibilityExtension(received, now time.Time) int64 {
+	timeout := c.VisibilityTimeout
+	limit := maxVisibilityTimeout
+	if c.MaxProcessingTime > 0 && c.MaxProcessingTime < limit {
+		limit = c.MaxProcessingTime
+	}
+	remaining := int64(received.Add(limit).Sub(now) / time.Second)
+	if remaining < timeout {
+		timeout = remaining
+	}
+	if timeout <= 0 {
+		return 0
+	}
+	return timeout
+}
@@ -0,0 +1,127 @@
+package sqsextendedmanager_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendedmanager"
+)
+
+func TestConsumerHeartbeat(t *testing.T) {
+	f := newFakes(t, nil)
+	f.send(t, "small")
+	_, err := f.svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    aws.String(f.queueURL),
+		MessageBody: aws.String(strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold+1)),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	var mu sync.Mutex
+	handled := 0
+	var errs []error
+	consumer := sqsextendedmanager.NewConsumer(f.svc, f.queueURL, func(c *sqsextendedmanager.Consumer) {
+		c.WaitTimeSeconds = 1
+		c.VisibilityTimeout = 1
+		c.HeartbeatInterval = 300 * time.Millisecond
+		c.ErrorHandler = func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}
+	})
+	// Messages are handled for twice their visibility timeout, and would be
+	// received again without the heartbeat.
+	stop := runConsumer(consumer, func(ctx aws.Context, msg *sqsextendedclient.Message) error {
+		time.Sleep(2 * time.Second)
+		mu.Lock()
+		defer mu.Unlock()
+		handled++
+		return nil
+	})
+	waitFor(t, func() bool {
+		return f.messages(t) == 0
+	})
+	extensions := f.count("ChangeMessageVisibilityBatch")
+	time.Sleep(time.Second)
+	if err := stop(); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	if e, a := 2, handled; e != a {
+		t.Errorf("expect %v messages handled, got %v", e, a)
+	}
+	if extensions < 3 {
+		t.Errorf("expect at least 3 ChangeMessageVisibilityBatch requests, got %v", extensions)
+	}
+	if e, a := extensions, f.count("ChangeMessageVisibilityBatch"); e != a {
+		t.Errorf("expect no extensions once messages are deleted, got %v more", a-e)
+	}
+	if len(errs) > 0 {
+		t.Errorf("expect no errors, got %v", errs)
+	}
+	if e, a := 0, len(f.s3.Keys(testBucket)); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+}
+
+func TestConsumerMaxProcessingTime(t *testing.T) {
+	f := newFakes(t, nil)
+	f.send(t, "hello")
+
+	var mu sync.Mutex
+	var handlerErrs []error
+	var elapsed time.Duration
+	consumer := sqsextendedmanager.NewConsumer(f.svc, f.queueURL, func(c *sqsextendedmanager.Consumer) {
+		c.WaitTimeSeconds = 1
+		c.VisibilityTimeout = 1
+		c.HeartbeatInterval = 200 * time.Millisecond
+		c.MaxProcessingTime = 1500 * time.Millisecond
+	})
+	// The first attempt runs until it is cancelled, after which the message
+	// becomes visible again, and the second attempt succeeds.
+	stop := runConsumer(consumer, func(ctx aws.Context, msg *sqsextendedclient.Message) error {
+		mu.Lock()
+		first := len(handlerErrs) == 0
+		mu.Unlock()
+
+		var err error
+		if first {
+			start := time.Now()
+			<-ctx.Done()
+			elapsed = time.Since(start)
+			err = ctx.Err()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		handlerErrs = append(handlerErrs, err)
+		return err
+	})
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handlerErrs) == 2
+	})
+	if err := stop(); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	if e, a := context.DeadlineExceeded, handlerErrs[0]; e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if elapsed < time.Second || elapsed > 2*time.Second {
+		t.Errorf("expect handler to be cancelled after about 1.5s, got %v", elapsed)
+	}
+	if handlerErrs[1] != nil {
+		t.Errorf("expect no error, got %v", handlerErrs[1])
+	}
+	if e, a := 0, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
@@ -0,0 +1,471 @@
+package sqsextendedmanager
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendediface"
+)
+
+const (
+	// DefaultProducerMaxDelay is the default time a Producer holds a message
+	// for, waiting for a batch to fill up.
+	DefaultProducerMaxDelay = 20 * time.Millisecond
+
+	// DefaultProducerConcurrency is the default number of batches a Producer
+	// sends concurrently.
+	DefaultProducerConcurrency = 10
+
+	// DefaultMaxBatchBytes is the default, and the maximum, total size of the
+	// messages in a SendMessageBatch request.
+	DefaultMaxBatchBytes = sqsextendedclient.DefaultMessageSizeThreshold
+)
+
+// offloadedMessageSize is an estimate of the size of the body of an offloaded
+// message, a payload pointer, and the attribute recording the payload size.
+const offloadedMessageSize = 1024
+
+// SendResult is the result of sending a message with a Producer, which is
+// available once the batch the message was sent in completes.
+type SendResult struct {
+	done   chan struct{}
+	output *sqsextendedclient.SendMessageOutput
+	err    error
+}
+
+// newSendResult returns a pending SendResult.
+func newSendResult() *SendResult {
+	return &SendResult{done: make(chan struct{})}
+}
+
+// complete sets the result, and releases the callers waiting for it.
+func (r *SendResult) complete(output *sqsextendedclient.SendMessageOutput, err error) {
+	r.output, r.err = output, err
+	close(r.done)
+}
+
+// Done returns a channel that is closed once the result is available.
+func (r *SendResult) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait waits for the message to be sent, or ctx to be done, and returns the
+// MessageId, SequenceNumber and digests of the sent message in a
+// SendMessageOutput. The error is an awserr.Error with the code and message
+// of the failed batch entry, or the error of the SendMessageBatch request.
+//
+// The message may still be sent if ctx is done first.
+func (r *SendResult) Wait(ctx aws.Context) (*sqsextendedclient.SendMessageOutput, error) {
+	select {
+	case <-r.done:
+		return r.output, r.err
+	case <-ctx.Done():
+		return nil, awserr.New(request.CanceledErrorCode, "wait for send result canceled", ctx.Err())
+	}
+}
+
+// pendingMessage is a message waiting to be sent by a Producer.
+type pendingMessage struct {
+	input  *sqsextendedclient.SendMessageInput
+	result *SendResult
+}
+
+// The Producer structure that calls Send(). It accepts individual messages
+// and sends them in SendMessageBatch requests, which cuts the number of
+// requests by up to 10 times when sending many messages. It is safe to call
+// Send() concurrently. Mutating the Producer's properties once Send() was
+// called is not safe.
+//
+// A batch is sent as soon as it holds 10 messages, once the next message
+// would take it over MaxBatchBytes, or MaxDelay after its first message was
+// added. Messages larger than MessageSizeThreshold are offloaded by the
+// SQSExtended client when the batch is sent, and only their payload pointers
+// count towards MaxBatchBytes. Messages that fail with a retryable error,
+// such as throttling or an internal error, are retried as a BatchRetryer
+// does.
+//
+// Messages are packed in the order they are sent, and SQS preserves the
+// order of the messages within a batch. To preserve the order of the messages
+// of a group in a FIFO queue across batches, set Concurrency to 1. Messages
+// sent to a FIFO queue are not retried, since a retried message would be sent
+// after the messages that followed it in its group; they fail with the error
+// of their batch entry instead.
+type Producer struct {
+	// The client to send messages with.
+	SQS sqsextendediface.SQSExtendedAPI
+
+	// URL of the queue to send messages to.
+	QueueURL string
+
+	// The maximum time a message is held for before it is sent, waiting for
+	// a batch to fill up. Defaults to DefaultProducerMaxDelay.
+	MaxDelay time.Duration
+
+	// The maximum total size of the messages in a batch, as counted by
+	// sqsextendedclient.MessageSize. Defaults to DefaultMaxBatchBytes.
+	MaxBatchBytes int
+
+	// The size above which messages are offloaded by the client. Should be
+	// the MessageSizeThreshold of the client's ExtendedClientConfiguration.
+	// Defaults to sqsextendedclient.DefaultMessageSizeThreshold.
+	MessageSizeThreshold int
+
+	// The maximum number of message attributes of a message. Should leave
+	// room for the reserved attributes of the client's
+	// ExtendedClientConfiguration: one less again for each of compression
+	// and encryption. Defaults to sqsextendedclient.MaxAllowedAttributes.
+	MaxMessageAttributes int
+
+	// The maximum number of times a message that failed with a retryable
+	// error is retried. Defaults to DefaultBatchMaxRetries. Ignored for FIFO
+	// queues.
+	MaxRetries int
+
+	// The number of batches sent concurrently. A Send that completes a batch
+	// blocks while this many batches are in flight. Defaults to
+	// DefaultProducerConcurrency.
+	Concurrency int
+
+	// Called with errors that do not fail any message, such as offloaded
+	// payloads of failed entries that could not be deleted. Errors are
+	// discarded if ErrorHandler is nil.
+	ErrorHandler func(err error)
+
+	// List of request options that will be passed down to individual API
+	// operation requests made by the producer.
+	RequestOptions []request.Option
+
+	mu           sync.Mutex
+	pending      []*pendingMessage
+	pendingBytes int
+	generation   int
+	timer        *time.Timer
+	batches      [][]*pendingMessage
+
+	dispatchMu sync.Mutex
+	slots      chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewProducer creates a new Producer instance to send messages to the queue at
+// queueURL with svc. Pass in additional functional options to customize the
+// producer's behavior.
+//
+// Example:
+//
+//	producer := sqsextendedmanager.NewProducer(svc, queueURL, func(p *sqsextendedmanager.Producer) {
+//		p.MaxDelay = 100 * time.Millisecond
+//	})
+//	defer producer.Close()
+//
+//	result := producer.Send(&sqsextendedclient.SendMessageInput{
+//		MessageBody: aws.String("hello"),
+//	})
+//	out, err := result.Wait(ctx)
+func NewProducer(svc sqsextendediface.SQSExtendedAPI, queueURL string, options ...func(*Producer)) *Producer {
+	p := &Producer{
+		SQS:                  svc,
+		QueueURL:             queueURL,
+		MaxDelay:             DefaultProducerMaxDelay,
+		MaxBatchBytes:        DefaultMaxBatchBytes,
+		MessageSizeThreshold: sqsextendedclient.DefaultMessageSizeThreshold,
+		MaxMessageAttributes: sqsextendedclient.MaxAllowedAttributes,
+		MaxRetries:           DefaultBatchMaxRetries,
+		Concurrency:          DefaultProducerConcurrency,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// Send adds a message to the next batch, and returns its result. The
+// QueueUrl of input, if set, must be the Producer's QueueURL. The other
+// fields of input are sent as they are in SendMessage; input must not be
+// modified until the result is available.
+//
+// Inputs SendMessage would reject as not valid, including ones with reserved
+// message attributes or more than MaxMessageAttributes, are not added to a
+// batch, and their result fails at once.
+func (p *Producer) Send(input *sqsextendedclient.SendMessageInput) *SendResult {
+	result := newSendResult()
+	if input.QueueUrl != nil && aws.StringValue(input.QueueUrl) != p.QueueURL {
+		result.complete(nil, awserr.New(request.InvalidParameterErrCode,
+			"QueueUrl differs from the queue URL of the producer", nil))
+		return result
+	}
+	if err := p.validate(input); err != nil {
+		result.complete(nil, err)
+		return result
+	}
+	size := p.messageSize(input)
+
+	p.mu.Lock()
+	generation := p.generation
+	if len(p.pending) > 0 && p.pendingBytes+size > p.maxBatchBytes() {
+		p.flush()
+	}
+	p.pending = append(p.pending, &pendingMessage{input: input, result: result})
+	p.pendingBytes += size
+	if len(p.pending) == maxBatchEntries || p.pendingBytes >= p.maxBatchBytes() {
+		p.flush()
+	} else if len(p.pending) == 1 {
+		next := p.generation
+		p.timer = time.AfterFunc(p.MaxDelay, func() {
+			p.flushGeneration(next)
+		})
+	}
+	flushed := p.generation != generation
+	p.mu.Unlock()
+
+	// Only the callers that flushed a batch wait for it to be dispatched.
+	if flushed {
+		p.dispatch()
+	}
+	return result
+}
+
+// Flush sends the messages added so far, without waiting for the batch to
+// fill up. It does not wait for the messages to be sent.
+func (p *Producer) Flush() {
+	p.mu.Lock()
+	p.flush()
+	p.mu.Unlock()
+
+	p.dispatch()
+}
+
+// flushGeneration is called by the timer of the given generation of pending
+// messages, and flushes them unless they were flushed already.
+func (p *Producer) flushGeneration(generation int) {
+	p.mu.Lock()
+	if p.generation == generation {
+		p.flush()
+	}
+	p.mu.Unlock()
+
+	p.dispatch()
+}
+
+// Close sends the messages added so far, and waits for all batches to
+// complete. Send must not be called after Close.
+func (p *Producer) Close() {
+	p.Flush()
+	p.wg.Wait()
+}
+
+// validate validates input as SendMessage to the Producer's queue would, and
+// checks its message attributes leave room for the reserved attributes of
+// the client.
+func (p *Producer) validate(input *sqsextendedclient.SendMessageInput) error {
+	params := *input
+	params.QueueUrl = aws.String(p.QueueURL)
+	if err := params.Validate(); err != nil {
+		return err
+	}
+
+	invalidParams := request.ErrInvalidParams{Context: "SendMessageInput"}
+	for _, name := range []string{
+		sqsextendedclient.ReservedAttributeName,
+		sqsextendedclient.LegacyReservedAttributeName,
+		sqsextendedclient.CompressionAttributeName,
+		sqsextendedclient.EncryptionAttributeName,
+	} {
+		if _, ok := input.MessageAttributes[name]; ok {
+			invalidParams.Add(sqsextendedclient.NewErrParamReservedName(fmt.Sprintf("%s[%v]", "MessageAttributes", name), name))
+		}
+	}
+	max := p.MaxMessageAttributes
+	if max == 0 {
+		max = sqsextendedclient.MaxAllowedAttributes
+	}
+	if len(input.MessageAttributes) > max {
+		invalidParams.Add(request.NewErrParamMaxLen("MessageAttributes", max, strconv.Itoa(len(input.MessageAttributes))))
+	}
+	if invalidParams.Len() > 0 {
+		return invalidParams
+	}
+	return nil
+}
+
+// messageSize returns the size input counts for towards MaxBatchBytes.
+func (p *Producer) messageSize(input *sqsextendedclient.SendMessageInput) int {
+	size := input.MessageSize()
+	threshold := p.MessageSizeThreshold
+	if threshold == 0 {
+		threshold = sqsextendedclient.DefaultMessageSizeThreshold
+	}
+	if size > threshold {
+		size = sqsextendedclient.MessageSize(nil, input.MessageAttributes) + offloadedMessageSize
+	}
+	return size
+}
+
+// maxBatchBytes returns the maximum total size of the messages in a batch.
+func (p *Producer) maxBatchBytes() int {
+	if p.MaxBatchBytes == 0 {
+		return DefaultMaxBatchBytes
+	}
+	return p.MaxBatchBytes
+}
+
+// flush queues the pending messages as a new batch, to be sent by
+// dispatch. p.mu must be held.
+func (p *Producer) flush() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if len(p.pending) == 0 {
+		return
+	}
+	p.batches = append(p.batches, p.pending)
+	p.pending = nil
+	p.pendingBytes = 0
+	p.generation++
+}
+
+// dispatch sends the queued batches in order, each once fewer than
+// Concurrency batches are in flight. p.mu must not be held, so that messages
+// can be added while dispatch waits.
+func (p *Producer) dispatch() {
+	p.dispatchMu.Lock()
+	defer p.dispatchMu.Unlock()
+
+	if p.slots == nil {
+		concurrency := p.Concurrency
+		if concurrency == 0 {
+			concurrency = DefaultProducerConcurrency
+		}
+		p.slots = make(chan struct{}, concurrency)
+	}
+	for {
+		p.mu.Lock()
+		if len(p.batches) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		batch := p.batches[0]
+		p.batches = p.batches[1:]
+		p.mu.Unlock()
+
+		p.slots <- struct{}{}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer func() { <-p.slots }()
+			p.send(batch)
+		}()
+	}
+}
+
+// send sends a batch of messages, retrying entries that failed with a
+// retryable error, and completes their results. Batches SQS rejects as too
+// long are split in two, and sent again.
+func (p *Producer) send(batch []*pendingMessage) {
+	entries := make([]*sqsextendedclient.SendMessageBatchRequestEntry, len(batch))
+	ids := make([]*string, len(batch))
+	for i, m := range batch {
+		ids[i] = aws.String(strconv.Itoa(i))
+		entries[i] = &sqsextendedclient.SendMessageBatchRequestEntry{
+			Id:                      ids[i],
+			MessageBody:             m.input.MessageBody,
+			DelaySeconds:            m.input.DelaySeconds,
+			MessageAttributes:       m.input.MessageAttributes,
+			MessageSystemAttributes: m.input.MessageSystemAttributes,
+			MessageDeduplicationId:  m.input.MessageDeduplicationId,
+			MessageGroupId:          m.input.MessageGroupId,
+		}
+	}
+
+	settled := make([]bool, len(batch))
+	settle := func(id *string) (*pendingMessage, bool) {
+		i, err := strconv.Atoi(aws.StringValue(id))
+		if err != nil || i < 0 || i >= len(batch) || settled[i] {
+			return nil, false
+		}
+		settled[i] = true
+		return batch[i], true
+	}
+
+	maxRetries := p.MaxRetries
+	if isFIFOQueue(p.QueueURL) {
+		maxRetries = 0
+	}
+	failed, payloadErr, err := NewBatchRetryer(p.SQS).retry(aws.BackgroundContext(), ids, maxRetries, func(pending []int) ([]*sqsextendedclient.BatchResultErrorEntry, error) {
+		params := make([]*sqsextendedclient.SendMessageBatchRequestEntry, len(pending))
+		for i, j := range pending {
+			params[i] = entries[j]
+		}
+		out, err := p.SQS.SendMessageBatchWithContext(aws.BackgroundContext(), &sqsextendedclient.SendMessageBatchInput{
+			QueueUrl: aws.String(p.QueueURL),
+			Entries:  params,
+		}, p.RequestOptions...)
+		if out == nil {
+			return nil, err
+		}
+		for _, entry := range out.Successful {
+			if m, ok := settle(entry.Id); ok {
+				m.result.complete(&sqsextendedclient.SendMessageOutput{
+					MD5OfMessageAttributes:       entry.MD5OfMessageAttributes,
+					MD5OfMessageBody:             entry.MD5OfMessageBody,
+					MD5OfMessageSystemAttributes: entry.MD5OfMessageSystemAttributes,
+					MessageId:                    entry.MessageId,
+					SequenceNumber:               entry.SequenceNumber,
+				}, nil)
+			}
+		}
+		return out.Failed, err
+	})
+	if payloadErr != nil {
+		// The batch was sent, but the payloads of failed entries could not
+		// be deleted.
+		p.reportError(payloadErr)
+	}
+	for _, entry := range failed {
+		if m, ok := settle(entry.Id); ok {
+			m.result.complete(nil, batchEntryError(entry))
+		}
+	}
+
+	var rest []*pendingMessage
+	for i, m := range batch {
+		if !settled[i] {
+			rest = append(rest, m)
+		}
+	}
+	switch {
+	case len(rest) == 0:
+	case sqsextendedclient.IsBatchRequestTooLong(err) && len(rest) > 1:
+		p.send(rest[:len(rest)/2])
+		p.send(rest[len(rest)/2:])
+	case err != nil:
+		for _, m := range rest {
+			m.result.complete(nil, err)
+		}
+	default:
+		for _, m := range rest {
+			m.result.complete(nil, awserr.New(request.ErrCodeSerialization,
+				"no result for entry in SendMessageBatch response", nil))
+		}
+	}
+}
+
+// reportError passes err to the ErrorHandler, if any.
+func (p *Producer) reportError(err error) {
+	if p.ErrorHandler != nil {
+		p.ErrorHandler(err)
+	}
+}
+
+// errCodeIs reports whether err is an awserr.Error with the given code.
+func errCodeIs(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
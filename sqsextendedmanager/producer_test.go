@@ -0,0 +1,322 @@
+package sqsextendedmanager_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendediface"
+	"github.com/chojy/sqsextended/sqsextendedmanager"
+)
+
+// wait waits for result, and fails the test if it does not complete within
+// 10 seconds.
+func wait(t *testing.T, result *sqsextendedmanager.SendResult) (*sqsextendedclient.SendMessageOutput, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := result.Wait(ctx)
+	if ctx.Err() != nil {
+		t.Fatalf("timed out waiting for send result")
+	}
+	return out, err
+}
+
+// bodies returns n copies of body.
+func bodies(body string, n int) []string {
+	b := make([]string, n)
+	for i := range b {
+		b[i] = body
+	}
+	return b
+}
+
+func TestProducerBatches(t *testing.T) {
+	cases := map[string]struct {
+		Bodies   []string
+		Requests int
+	}{
+		"entries": {
+			Bodies:   bodies("hello", 25),
+			Requests: 3,
+		},
+		"bytes": {
+			Bodies:   bodies(strings.Repeat("x", 100000), 5),
+			Requests: 3,
+		},
+		"offloaded": {
+			Bodies: []string{
+				strings.Repeat("x", sqsextendedclient.DefaultMessageSizeThreshold+1),
+				strings.Repeat("y", sqsextendedclient.DefaultMessageSizeThreshold+1),
+				"hello",
+			},
+			Requests: 1,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakes(t, nil)
+			producer := sqsextendedmanager.NewProducer(f.svc, f.queueURL, func(p *sqsextendedmanager.Producer) {
+				p.MaxDelay = time.Hour
+			})
+
+			var results []*sqsextendedmanager.SendResult
+			for _, body := range c.Bodies {
+				results = append(results, producer.Send(&sqsextendedclient.SendMessageInput{
+					MessageBody: aws.String(body),
+				}))
+			}
+			producer.Close()
+
+			for _, result := range results {
+				out, err := wait(t, result)
+				if err != nil {
+					t.Fatalf("expect no error, got %v", err)
+				}
+				if len(aws.StringValue(out.MessageId)) == 0 {
+					t.Errorf("expect message ID")
+				}
+			}
+			if e, a := c.Requests, f.count("SendMessageBatch"); e != a {
+				t.Errorf("expect %v SendMessageBatch requests, got %v", e, a)
+			}
+			if e, a := len(c.Bodies), f.messages(t); e != a {
+				t.Errorf("expect %v messages, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestProducerMaxDelay(t *testing.T) {
+	f := newFakes(t, nil)
+	producer := sqsextendedmanager.NewProducer(f.svc, f.queueURL)
+	defer producer.Close()
+
+	out, err := wait(t, producer.Send(&sqsextendedclient.SendMessageInput{
+		MessageBody: aws.String("hello"),
+	}))
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if len(aws.StringValue(out.MessageId)) == 0 {
+		t.Errorf("expect message ID")
+	}
+	if e, a := 1, f.count("SendMessageBatch"); e != a {
+		t.Errorf("expect %v SendMessageBatch requests, got %v", e, a)
+	}
+}
+
+func TestProducerSequenceNumbers(t *testing.T) {
+	f := newFakes(t, map[string]string{
+		"FifoQueue":                 "true",
+		"ContentBasedDeduplication": "true",
+	})
+	producer := sqsextendedmanager.NewProducer(f.svc, f.queueURL, func(p *sqsextendedmanager.Producer) {
+		p.Concurrency = 1
+	})
+
+	var results []*sqsextendedmanager.SendResult
+	for i := 0; i < 15; i++ {
+		results = append(results, producer.Send(&sqsextendedclient.SendMessageInput{
+			MessageBody:    aws.String(strconv.Itoa(i)),
+			MessageGroupId: aws.String("group"),
+		}))
+	}
+	producer.Close()
+
+	var prev int64
+	for i, result := range results {
+		out, err := wait(t, result)
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+		seq, err := strconv.ParseInt(aws.StringValue(out.SequenceNumber), 10, 64)
+		if err != nil {
+			t.Fatalf("expect sequence number, got %q", aws.StringValue(out.SequenceNumber))
+		}
+		if i > 0 && seq <= prev {
+			t.Errorf("expect sequence numbers to increase, got %v after %v", seq, prev)
+		}
+		prev = seq
+	}
+}
+
+func TestProducerInvalidMessages(t *testing.T) {
+	attr := &sqsextendedclient.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String("value"),
+	}
+	tooMany := map[string]*sqsextendedclient.MessageAttributeValue{}
+	for i := 0; i <= sqsextendedclient.MaxAllowedAttributes; i++ {
+		tooMany["attr"+strconv.Itoa(i)] = attr
+	}
+
+	cases := map[string]struct {
+		Input *sqsextendedclient.SendMessageInput
+		Code  string
+	}{
+		"missing body": {
+			Input: &sqsextendedclient.SendMessageInput{},
+			Code:  request.InvalidParameterErrCode,
+		},
+		"reserved attribute": {
+			Input: &sqsextendedclient.SendMessageInput{
+				MessageBody: aws.String("hello"),
+				MessageAttributes: map[string]*sqsextendedclient.MessageAttributeValue{
+					sqsextendedclient.ReservedAttributeName: attr,
+				},
+			},
+			Code: request.InvalidParameterErrCode,
+		},
+		"too many attributes": {
+			Input: &sqsextendedclient.SendMessageInput{
+				MessageBody:       aws.String("hello"),
+				MessageAttributes: tooMany,
+			},
+			Code: request.InvalidParameterErrCode,
+		},
+		"other queue": {
+			Input: &sqsextendedclient.SendMessageInput{
+				QueueUrl:    aws.String("other"),
+				MessageBody: aws.String("hello"),
+			},
+			Code: request.InvalidParameterErrCode,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakes(t, nil)
+			producer := sqsextendedmanager.NewProducer(f.svc, f.queueURL, func(p *sqsextendedmanager.Producer) {
+				p.MaxDelay = time.Hour
+			})
+
+			valid := producer.Send(&sqsextendedclient.SendMessageInput{
+				MessageBody: aws.String("valid"),
+			})
+			invalid := producer.Send(c.Input)
+			select {
+			case <-invalid.Done():
+			default:
+				t.Fatalf("expect invalid message to fail at once")
+			}
+			producer.Close()
+
+			if _, err := wait(t, valid); err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			_, err := wait(t, invalid)
+			if err == nil {
+				t.Fatalf("expect error, got nil")
+			}
+			if e, a := c.Code, err.(awserr.Error).Code(); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			if e, a := 1, f.messages(t); e != a {
+				t.Errorf("expect %v messages, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestProducerStaleTimer(t *testing.T) {
+	f := newFakes(t, nil)
+	producer := sqsextendedmanager.NewProducer(f.svc, f.queueURL, func(p *sqsextendedmanager.Producer) {
+		p.MaxDelay = time.Hour
+	})
+
+	first := producer.Send(&sqsextendedclient.SendMessageInput{
+		MessageBody: aws.String("first"),
+	})
+	generation := producer.Generation()
+	producer.Flush()
+	if _, err := wait(t, first); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	// The timer of the first batch fires after the batch was flushed, and
+	// must not flush the next one.
+	second := producer.Send(&sqsextendedclient.SendMessageInput{
+		MessageBody: aws.String("second"),
+	})
+	producer.FlushGeneration(generation)
+	select {
+	case <-second.Done():
+		t.Errorf("expect next batch to wait for its own timer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	producer.Close()
+	if _, err := wait(t, second); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 2, f.count("SendMessageBatch"); e != a {
+		t.Errorf("expect %v SendMessageBatch requests, got %v", e, a)
+	}
+}
+
+// blockingBatches holds SendMessageBatch requests until release is closed.
+type blockingBatches struct {
+	sqsextendediface.SQSExtendedAPI
+	release chan struct{}
+}
+
+func (b *blockingBatches) SendMessageBatchWithContext(ctx aws.Context, input *sqsextendedclient.SendMessageBatchInput, opts ...request.Option) (*sqsextendedclient.SendMessageBatchOutput, error) {
+	<-b.release
+	return b.SQSExtendedAPI.SendMessageBatchWithContext(ctx, input, opts...)
+}
+
+func TestProducerConcurrency(t *testing.T) {
+	f := newFakes(t, nil)
+	svc := &blockingBatches{SQSExtendedAPI: f.svc, release: make(chan struct{})}
+	producer := sqsextendedmanager.NewProducer(svc, f.queueURL, func(p *sqsextendedmanager.Producer) {
+		p.MaxDelay = time.Hour
+		p.Concurrency = 1
+	})
+
+	send := func(n int) []*sqsextendedmanager.SendResult {
+		var results []*sqsextendedmanager.SendResult
+		for i := 0; i < n; i++ {
+			results = append(results, producer.Send(&sqsextendedclient.SendMessageInput{
+				MessageBody: aws.String("hello"),
+			}))
+		}
+		return results
+	}
+
+	// The first batch is in flight, and the second waits for it.
+	results := send(10)
+	blocked := make(chan []*sqsextendedmanager.SendResult)
+	go func() { blocked <- send(10) }()
+	time.Sleep(100 * time.Millisecond)
+
+	// Messages can still be added while the second batch waits.
+	added := make(chan []*sqsextendedmanager.SendResult)
+	go func() { added <- send(1) }()
+	select {
+	case more := <-added:
+		results = append(results, more...)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expect Send not to block while batches wait to be sent")
+	}
+
+	close(svc.release)
+	results = append(results, <-blocked...)
+	producer.Close()
+	for _, result := range results {
+		if _, err := wait(t, result); err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+	}
+	if e, a := 21, f.messages(t); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
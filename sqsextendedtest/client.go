@@ -0,0 +1,30 @@
+package sqsextendedtest
+
+import (
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/s3"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+// NewClient returns a client of the SQS server with large payload support,
+// offloading payloads to bucket on the S3 server. The bucket is created if it
+// does not exist yet. Requests are not retried, so that the faults a test
+// injects surface at once. Pass in options to customize the extended client
+// configuration.
+//
+// Example:
+//
+//	svc, err := sqsextendedtest.NewClient(sess, srv, s3srv, "payloads",
+//		func(c *sqsextendedclient.ExtendedClientConfiguration) {
+//			c.WithAlwaysThroughS3(true)
+//		})
+func NewClient(p client.ConfigProvider, sqsServer *SQSServer, s3Server *S3Server, bucket string, options ...func(*sqsextendedclient.ExtendedClientConfiguration)) (*sqsextendedclient.SQSExtended, error) {
+	s3Server.CreateBucket(bucket)
+	s3c := s3.New(p, s3Server.Config().WithMaxRetries(0))
+	ext := sqsextendedclient.NewExtendedClientConfiguration().
+		WithLargePayloadSupport(s3c, bucket)
+	for _, option := range options {
+		option(ext)
+	}
+	return sqsextendedclient.NewWithExtendedConfig(p, ext, sqsServer.Config().WithMaxRetries(0))
+}
@@ -0,0 +1,56 @@
+package sqsextendedtest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	sqsextendedclient "github.com/chojy/sqsextended"
+	"github.com/chojy/sqsextended/sqsextendedtest"
+)
+
+func TestNewClient(t *testing.T) {
+	srv := sqsextendedtest.NewSQSServer()
+	defer srv.Close()
+	s3srv := sqsextendedtest.NewS3Server()
+	defer s3srv.Close()
+
+	svc, err := sqsextendedtest.NewClient(unit.Session, srv, s3srv, "payloads",
+		func(c *sqsextendedclient.ExtendedClientConfiguration) {
+			c.WithAlwaysThroughS3(true)
+		})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	out, err := svc.CreateQueue(&sqsextendedclient.CreateQueueInput{QueueName: aws.String("queue")})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	// The bucket is created, and the options are applied.
+	_, err = svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    out.QueueUrl,
+		MessageBody: aws.String("hello"),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 1, len(s3srv.Keys("payloads")); e != a {
+		t.Errorf("expect %v payloads, got %v", e, a)
+	}
+
+	// Requests are not retried.
+	s3srv.InjectFault(sqsextendedtest.Fault{Method: "PUT", StatusCode: http.StatusInternalServerError, Times: 1})
+	_, err = svc.SendMessage(&sqsextendedclient.SendMessageInput{
+		QueueUrl:    out.QueueUrl,
+		MessageBody: aws.String("hello"),
+	})
+	if err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	if !sqsextendedclient.IsPayloadError(err) {
+		t.Errorf("expect payload error, got %v", err)
+	}
+}
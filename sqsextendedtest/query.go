@@ -0,0 +1,404 @@
+package sqsextendedtest
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Error codes returned by the fake SQS server, in addition to the ones
+// defined by the sqsextendedclient package.
+const (
+	errCodeInvalidAction         = "InvalidAction"
+	errCodeInvalidParameterValue = "InvalidParameterValue"
+	errCodeMissingParameter      = "MissingParameter"
+)
+
+// apiError is an error the server returns to the client in an ErrorResponse.
+type apiError struct {
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// newError returns an apiError with a formatted message.
+func newError(code, format string, args ...interface{}) *apiError {
+	return &apiError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// writeError writes err as an ErrorResponse document.
+func writeError(w http.ResponseWriter, err *apiError, requestID string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusBadRequest)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName   xml.Name `xml:"ErrorResponse"`
+		Type      string   `xml:"Error>Type"`
+		Code      string   `xml:"Error>Code"`
+		Message   string   `xml:"Error>Message"`
+		RequestID string   `xml:"RequestId"`
+	}{Type: "Sender", Code: err.Code, Message: err.Message, RequestID: requestID})
+}
+
+// writeResult writes result as the result element of the response document
+// for action. A nil result writes a response without a result element.
+func writeResult(w http.ResponseWriter, action string, result interface{}, requestID string) {
+	w.Header().Set("Content-Type", "text/xml")
+	enc := xml.NewEncoder(w)
+	start := xml.StartElement{
+		Name: xml.Name{Local: action + "Response"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: "http://queue.amazonaws.com/doc/2012-11-05/"}},
+	}
+	enc.EncodeToken(start)
+	if result != nil {
+		enc.EncodeElement(result, xml.StartElement{Name: xml.Name{Local: action + "Result"}})
+	}
+	enc.EncodeElement(struct {
+		RequestId string
+	}{requestID}, xml.StartElement{Name: xml.Name{Local: "ResponseMetadata"}})
+	enc.EncodeToken(start.End())
+	enc.Flush()
+}
+
+// Result elements of the query protocol responses.
+type (
+	queueURLResult struct {
+		QueueUrl string
+	}
+
+	queueURLsResult struct {
+		QueueUrls []string `xml:"QueueUrl"`
+		NextToken string   `xml:",omitempty"`
+	}
+
+	sendMessageResult struct {
+		MessageId                    string
+		MD5OfMessageBody             string
+		MD5OfMessageAttributes       string `xml:",omitempty"`
+		MD5OfMessageSystemAttributes string `xml:",omitempty"`
+		SequenceNumber               string `xml:",omitempty"`
+	}
+
+	sendMessageBatchResultEntry struct {
+		Id string
+		sendMessageResult
+	}
+
+	sendMessageBatchResult struct {
+		Successful []sendMessageBatchResultEntry `xml:"SendMessageBatchResultEntry"`
+		Failed     []batchResultErrorEntry       `xml:"BatchResultErrorEntry"`
+	}
+
+	batchResultEntry struct {
+		Id string
+	}
+
+	deleteMessageBatchResult struct {
+		Successful []batchResultEntry      `xml:"DeleteMessageBatchResultEntry"`
+		Failed     []batchResultErrorEntry `xml:"BatchResultErrorEntry"`
+	}
+
+	changeMessageVisibilityBatchResult struct {
+		Successful []batchResultEntry      `xml:"ChangeMessageVisibilityBatchResultEntry"`
+		Failed     []batchResultErrorEntry `xml:"BatchResultErrorEntry"`
+	}
+
+	batchResultErrorEntry struct {
+		Id          string
+		SenderFault bool
+		Code        string
+		Message     string
+	}
+
+	receiveMessageResult struct {
+		Messages []messageResult `xml:"Message"`
+	}
+
+	messageResult struct {
+		MessageId              string
+		ReceiptHandle          string
+		MD5OfBody              string
+		Body                   string
+		Attributes             []attributeResult        `xml:"Attribute"`
+		MD5OfMessageAttributes string                   `xml:",omitempty"`
+		MessageAttributes      []messageAttributeResult `xml:"MessageAttribute"`
+	}
+
+	attributeResult struct {
+		Name  string
+		Value string
+	}
+
+	messageAttributeResult struct {
+		Name  string
+		Value attributeValueResult
+	}
+
+	attributeValueResult struct {
+		StringValue      *string  `xml:",omitempty"`
+		BinaryValue      string   `xml:",omitempty"`
+		StringListValues []string `xml:"StringListValue"`
+		BinaryListValues []string `xml:"BinaryListValue"`
+		DataType         string
+	}
+
+	getQueueAttributesResult struct {
+		Attributes []attributeResult `xml:"Attribute"`
+	}
+
+	listQueueTagsResult struct {
+		Tags []tagResult `xml:"Tag"`
+	}
+
+	tagResult struct {
+		Key   string
+		Value string
+	}
+)
+
+// attributeValue is the value of a message attribute or message system
+// attribute.
+type attributeValue struct {
+	DataType         string
+	StringValue      *string
+	BinaryValue      []byte
+	StringListValues []string
+	BinaryListValues [][]byte
+}
+
+// result returns the XML representation of v.
+func (v attributeValue) result() attributeValueResult {
+	res := attributeValueResult{
+		StringValue:      v.StringValue,
+		StringListValues: v.StringListValues,
+		DataType:         v.DataType,
+	}
+	if v.BinaryValue != nil {
+		res.BinaryValue = base64.StdEncoding.EncodeToString(v.BinaryValue)
+	}
+	for _, b := range v.BinaryListValues {
+		res.BinaryListValues = append(res.BinaryListValues, base64.StdEncoding.EncodeToString(b))
+	}
+	return res
+}
+
+// size returns the number of bytes v counts toward the message size.
+func (v attributeValue) size() int {
+	n := len(v.DataType) + len(v.BinaryValue)
+	if v.StringValue != nil {
+		n += len(*v.StringValue)
+	}
+	for _, s := range v.StringListValues {
+		n += len(s)
+	}
+	for _, b := range v.BinaryListValues {
+		n += len(b)
+	}
+	return n
+}
+
+// params wraps the form values of a query protocol request.
+type params url.Values
+
+// has reports whether the parameter is present.
+func (p params) has(name string) bool {
+	_, ok := p[name]
+	return ok
+}
+
+// get returns the value of the parameter, or the empty string.
+func (p params) get(name string) string {
+	return url.Values(p).Get(name)
+}
+
+// required returns the value of the parameter, or an error if it is missing.
+func (p params) required(name string) (string, *apiError) {
+	v := p.get(name)
+	if len(v) == 0 {
+		return "", newError(errCodeMissingParameter, "The request must contain the parameter %s.", name)
+	}
+	return v, nil
+}
+
+// int returns the value of an integer parameter between min and max, or def
+// if it is missing.
+func (p params) int(name string, def, min, max int) (int, *apiError) {
+	if !p.has(name) {
+		return def, nil
+	}
+	n, err := strconv.Atoi(p.get(name))
+	if err != nil || n < min || n > max {
+		return 0, newError(errCodeInvalidParameterValue,
+			"Value %s for parameter %s is invalid. Reason: must be between %d and %d.", p.get(name), name, min, max)
+	}
+	return n, nil
+}
+
+// list returns the values of a flattened list: prefix.1, prefix.2 and so on.
+func (p params) list(prefix string) []string {
+	var values []string
+	for i := 1; p.has(prefix + "." + strconv.Itoa(i)); i++ {
+		values = append(values, p.get(prefix+"."+strconv.Itoa(i)))
+	}
+	return values
+}
+
+// stringMap returns the entries of a flattened map: prefix.N.key and
+// prefix.N.value.
+func (p params) stringMap(prefix, key, value string) map[string]string {
+	m := map[string]string{}
+	for i := 1; ; i++ {
+		n := prefix + "." + strconv.Itoa(i) + "."
+		if !p.has(n + key) {
+			return m
+		}
+		m[p.get(n+key)] = p.get(n + value)
+	}
+}
+
+// attributeMap returns the message attributes or message system attributes
+// under prefix.
+func (p params) attributeMap(prefix string) (map[string]attributeValue, *apiError) {
+	m := map[string]attributeValue{}
+	for i := 1; ; i++ {
+		n := prefix + "." + strconv.Itoa(i) + "."
+		if !p.has(n + "Name") {
+			return m, nil
+		}
+		name := p.get(n + "Name")
+		v := attributeValue{
+			DataType:         p.get(n + "Value.DataType"),
+			StringListValues: p.list(n + "Value.StringListValue"),
+		}
+		if len(v.DataType) == 0 {
+			return nil, newError(errCodeInvalidParameterValue, "The message attribute '%s' must contain a non-empty attribute type.", name)
+		}
+		if p.has(n + "Value.StringValue") {
+			s := p.get(n + "Value.StringValue")
+			v.StringValue = &s
+		}
+		if p.has(n + "Value.BinaryValue") {
+			b, err := base64.StdEncoding.DecodeString(p.get(n + "Value.BinaryValue"))
+			if err != nil {
+				return nil, newError(errCodeInvalidParameterValue, "The message attribute '%s' has an invalid binary value.", name)
+			}
+			v.BinaryValue = b
+		}
+		for _, s := range p.list(n + "Value.BinaryListValue") {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, newError(errCodeInvalidParameterValue, "The message attribute '%s' has an invalid binary value.", name)
+			}
+			v.BinaryListValues = append(v.BinaryListValues, b)
+		}
+		if v.StringValue == nil && v.BinaryValue == nil && len(v.StringListValues) == 0 && len(v.BinaryListValues) == 0 {
+			return nil, newError(errCodeInvalidParameterValue, "The message attribute '%s' must contain a non-empty message attribute value.", name)
+		}
+		m[name] = v
+	}
+}
+
+// entries returns the prefixes of the entries of a batch request:
+// prefix.1., prefix.2. and so on, for as long as the entries have an Id.
+func (p params) entries(prefix string) []string {
+	var entries []string
+	for i := 1; p.has(prefix + "." + strconv.Itoa(i) + ".Id"); i++ {
+		entries = append(entries, prefix+"."+strconv.Itoa(i)+".")
+	}
+	return entries
+}
+
+// md5Hex returns the hex encoded MD5 digest of s.
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// md5OfAttributes returns the hex encoded MD5 digest SQS computes for attrs,
+// or the empty string if there are none.
+func md5OfAttributes(attrs map[string]attributeValue) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := md5.New()
+	for _, name := range names {
+		v := attrs[name]
+		writeLengthAndBytes(h, []byte(name))
+		writeLengthAndBytes(h, []byte(v.DataType))
+		switch {
+		case v.StringValue != nil:
+			h.Write([]byte{1})
+			writeLengthAndBytes(h, []byte(*v.StringValue))
+		case v.BinaryValue != nil:
+			h.Write([]byte{2})
+			writeLengthAndBytes(h, v.BinaryValue)
+		case len(v.StringListValues) > 0:
+			h.Write([]byte{3})
+			for _, s := range v.StringListValues {
+				writeLengthAndBytes(h, []byte(s))
+			}
+		case len(v.BinaryListValues) > 0:
+			h.Write([]byte{4})
+			for _, b := range v.BinaryListValues {
+				writeLengthAndBytes(h, b)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeLengthAndBytes writes b to h, prefixed with its length as a 4 byte
+// big-endian integer.
+func writeLengthAndBytes(h hash.Hash, b []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+	h.Write(n[:])
+	h.Write(b)
+}
+
+// validMessageContents reports whether s only contains the characters SQS
+// allows in message bodies.
+func validMessageContents(s string) bool {
+	for _, r := range s {
+		switch {
+		case r == 0x9, r == 0xA, r == 0xD:
+		case r >= 0x20 && r <= 0xD7FF:
+		case r >= 0xE000 && r <= 0xFFFD:
+		case r >= 0x10000 && r <= 0x10FFFF:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAttributeName reports whether name is selected by the requested
+// attribute names, which may include "All", ".*" and prefixes ending in ".*".
+func matchesAttributeName(name string, requested []string) bool {
+	for _, r := range requested {
+		switch {
+		case r == "All", r == ".*", r == name:
+			return true
+		case strings.HasSuffix(r, ".*") && strings.HasPrefix(name, strings.TrimSuffix(r, "*")):
+			return true
+		}
+	}
+	return false
+}
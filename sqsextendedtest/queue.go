@@ -0,0 +1,492 @@
+package sqsextendedtest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+// Limits SQS applies to queues and messages.
+const (
+	maxMessageSize        = 262144
+	maxBatchEntries       = 10
+	maxVisibilityTimeout  = 43200
+	maxDelaySeconds       = 900
+	maxWaitTimeSeconds    = 20
+	deduplicationInterval = 5 * time.Minute
+	purgeInterval         = 60 * time.Second
+)
+
+// queueNamePattern matches valid queue names, without the .fifo suffix of
+// FIFO queues.
+var queueNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,80}$`)
+
+// batchEntryIDPattern matches valid batch entry ids.
+var batchEntryIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,80}$`)
+
+// defaultQueueAttributes are the settable attributes of a new queue.
+var defaultQueueAttributes = map[string]string{
+	"DelaySeconds":                  "0",
+	"MaximumMessageSize":            strconv.Itoa(maxMessageSize),
+	"MessageRetentionPeriod":        "345600",
+	"ReceiveMessageWaitTimeSeconds": "0",
+	"VisibilityTimeout":             "30",
+}
+
+// settableQueueAttributes lists the attributes CreateQueue and
+// SetQueueAttributes accept, with the range of numeric ones.
+var settableQueueAttributes = map[string][2]int{
+	"DelaySeconds":                  {0, maxDelaySeconds},
+	"MaximumMessageSize":            {1024, maxMessageSize},
+	"MessageRetentionPeriod":        {60, 1209600},
+	"ReceiveMessageWaitTimeSeconds": {0, maxWaitTimeSeconds},
+	"VisibilityTimeout":             {0, maxVisibilityTimeout},
+	"KmsDataKeyReusePeriodSeconds":  {60, 86400},
+	"RedrivePolicy":                 {},
+	"RedriveAllowPolicy":            {},
+	"Policy":                        {},
+	"KmsMasterKeyId":                {},
+	"SqsManagedSseEnabled":          {},
+	"FifoQueue":                     {},
+	"ContentBasedDeduplication":     {},
+	"DeduplicationScope":            {},
+	"FifoThroughputLimit":           {},
+}
+
+// message is a message held by a queue.
+type message struct {
+	id         string
+	body       string
+	attrs      map[string]attributeValue
+	sysAttrs   map[string]attributeValue
+	md5OfBody  string
+	md5OfAttrs string
+
+	sent         time.Time
+	visibleAt    time.Time
+	receiveCount int
+	firstReceive time.Time
+	receipt      string
+
+	groupID string
+	dedupID string
+	seq     string
+}
+
+// size returns the number of bytes the message counts toward the maximum
+// message size.
+func (m *message) size() int {
+	n := len(m.body)
+	for name, v := range m.attrs {
+		n += len(name) + v.size()
+	}
+	return n
+}
+
+// inflight reports whether the message has been received and is hidden.
+func (m *message) inflight(now time.Time) bool {
+	return m.receiveCount > 0 && now.Before(m.visibleAt)
+}
+
+// queue is a queue held by the server. Its fields are guarded by the
+// server's mutex.
+type queue struct {
+	name string
+	url  string
+	arn  string
+	fifo bool
+
+	attrs       map[string]string
+	tags        map[string]string
+	permissions map[string]bool
+	created     time.Time
+	modified    time.Time
+	purged      time.Time
+
+	messages []*message
+	receipts map[string]*message
+	dedup    map[string]dedupEntry
+	seq      int64
+}
+
+// dedupEntry records a message sent to a FIFO queue, for deduplication.
+type dedupEntry struct {
+	messageID string
+	seq       string
+	expires   time.Time
+}
+
+// redrivePolicy is the decoded RedrivePolicy queue attribute.
+type redrivePolicy struct {
+	DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+	MaxReceiveCount     json.Number `json:"maxReceiveCount"`
+}
+
+// newQueue returns an empty queue.
+func newQueue(name, url, arn string, attrs map[string]string, tags map[string]string, now time.Time) *queue {
+	q := &queue{
+		name:        name,
+		url:         url,
+		arn:         arn,
+		fifo:        attrs["FifoQueue"] == "true",
+		attrs:       map[string]string{},
+		tags:        tags,
+		permissions: map[string]bool{},
+		created:     now,
+		modified:    now,
+		receipts:    map[string]*message{},
+		dedup:       map[string]dedupEntry{},
+	}
+	for k, v := range defaultQueueAttributes {
+		q.attrs[k] = v
+	}
+	for k, v := range attrs {
+		q.attrs[k] = v
+	}
+	return q
+}
+
+// validateQueueAttributes checks attributes passed to CreateQueue or
+// SetQueueAttributes.
+func validateQueueAttributes(attrs map[string]string, create bool) *apiError {
+	for name, value := range attrs {
+		limits, ok := settableQueueAttributes[name]
+		if !ok || (name == "FifoQueue" && !create) {
+			return newError(sqsextendedclient.ErrCodeInvalidAttributeName, "Unknown Attribute %s.", name)
+		}
+		if limits != [2]int{} {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < limits[0] || n > limits[1] {
+				return newError(errCodeInvalidParameterValue, "Invalid value for the parameter %s.", name)
+			}
+		}
+		switch name {
+		case "FifoQueue", "ContentBasedDeduplication":
+			if value != "true" && value != "false" {
+				return newError(errCodeInvalidParameterValue, "Invalid value for the parameter %s.", name)
+			}
+		case "RedrivePolicy":
+			if len(value) == 0 {
+				continue
+			}
+			var p redrivePolicy
+			if err := json.Unmarshal([]byte(value), &p); err != nil || len(p.DeadLetterTargetArn) == 0 {
+				return newError(errCodeInvalidParameterValue, "Value %s for parameter RedrivePolicy is invalid.", value)
+			}
+			if n, err := p.MaxReceiveCount.Int64(); err != nil || n < 1 || n > 1000 {
+				return newError(errCodeInvalidParameterValue, "Value %s for parameter RedrivePolicy is invalid. Reason: Invalid value for maxReceiveCount.", value)
+			}
+		}
+	}
+	return nil
+}
+
+// intAttr returns the value of a numeric queue attribute.
+func (q *queue) intAttr(name string) int {
+	n, _ := strconv.Atoi(q.attrs[name])
+	return n
+}
+
+// redrivePolicy returns the dead-letter queue ARN and maximum receive count
+// of the queue, or a zero count if it has no redrive policy.
+func (q *queue) redrivePolicy() (string, int) {
+	var p redrivePolicy
+	if err := json.Unmarshal([]byte(q.attrs["RedrivePolicy"]), &p); err != nil {
+		return "", 0
+	}
+	n, _ := p.MaxReceiveCount.Int64()
+	return p.DeadLetterTargetArn, int(n)
+}
+
+// expire drops messages older than the retention period of the queue, and
+// deduplication entries past their interval.
+func (q *queue) expire(now time.Time) {
+	retention := time.Duration(q.intAttr("MessageRetentionPeriod")) * time.Second
+	msgs := q.messages[:0]
+	for _, m := range q.messages {
+		if now.Sub(m.sent) >= retention {
+			q.forget(m)
+			continue
+		}
+		msgs = append(msgs, m)
+	}
+	q.messages = msgs
+
+	for id, e := range q.dedup {
+		if !now.Before(e.expires) {
+			delete(q.dedup, id)
+		}
+	}
+}
+
+// forget removes the receipt handles of m.
+func (q *queue) forget(m *message) {
+	for handle, rm := range q.receipts {
+		if rm == m {
+			delete(q.receipts, handle)
+		}
+	}
+}
+
+// sendInput holds the parameters of a message to send.
+type sendInput struct {
+	body     string
+	attrs    map[string]attributeValue
+	sysAttrs map[string]attributeValue
+	delay    *int
+	groupID  string
+	dedupID  string
+}
+
+// send adds a message to the queue, or returns the message it duplicates.
+func (q *queue) send(in sendInput, now time.Time) (sendMessageResult, *apiError) {
+	if len(in.body) == 0 {
+		return sendMessageResult{}, newError(errCodeMissingParameter, "The request must contain the parameter MessageBody.")
+	}
+	if !validMessageContents(in.body) {
+		return sendMessageResult{}, newError(sqsextendedclient.ErrCodeInvalidMessageContents, "Invalid binary character in the message body.")
+	}
+
+	m := &message{
+		id:         newID(),
+		body:       in.body,
+		attrs:      in.attrs,
+		sysAttrs:   in.sysAttrs,
+		md5OfBody:  md5Hex(in.body),
+		md5OfAttrs: md5OfAttributes(in.attrs),
+		sent:       now,
+	}
+	if max := q.intAttr("MaximumMessageSize"); m.size() > max {
+		return sendMessageResult{}, newError(errCodeInvalidParameterValue,
+			"One or more parameters are invalid. Reason: Message must be shorter than %d bytes.", max)
+	}
+	delay := q.intAttr("DelaySeconds")
+	if in.delay != nil {
+		delay = *in.delay
+	}
+
+	if q.fifo {
+		if len(in.groupID) == 0 {
+			return sendMessageResult{}, newError(errCodeMissingParameter, "The request must contain the parameter MessageGroupId.")
+		}
+		if in.delay != nil {
+			return sendMessageResult{}, newError(errCodeInvalidParameterValue,
+				"Value %d for parameter DelaySeconds is invalid. Reason: The request include parameter that is not valid for this queue type.", *in.delay)
+		}
+		m.groupID = in.groupID
+		m.dedupID = in.dedupID
+		if len(m.dedupID) == 0 {
+			if q.attrs["ContentBasedDeduplication"] != "true" {
+				return sendMessageResult{}, newError(errCodeInvalidParameterValue,
+					"The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+			}
+			sum := sha256.Sum256([]byte(in.body))
+			m.dedupID = hex.EncodeToString(sum[:])
+		}
+		if e, ok := q.dedup[m.dedupID]; ok && now.Before(e.expires) {
+			return sendMessageResult{
+				MessageId:                    e.messageID,
+				MD5OfMessageBody:             m.md5OfBody,
+				MD5OfMessageAttributes:       m.md5OfAttrs,
+				MD5OfMessageSystemAttributes: md5OfAttributes(in.sysAttrs),
+				SequenceNumber:               e.seq,
+			}, nil
+		}
+		q.seq++
+		m.seq = fmt.Sprintf("%020d", q.seq)
+		q.dedup[m.dedupID] = dedupEntry{messageID: m.id, seq: m.seq, expires: now.Add(deduplicationInterval)}
+	} else if len(in.groupID) > 0 || len(in.dedupID) > 0 {
+		return sendMessageResult{}, newError(errCodeInvalidParameterValue,
+			"The request include parameter that is not valid for this queue type.")
+	}
+
+	m.visibleAt = now.Add(time.Duration(delay) * time.Second)
+	q.messages = append(q.messages, m)
+	return sendMessageResult{
+		MessageId:                    m.id,
+		MD5OfMessageBody:             m.md5OfBody,
+		MD5OfMessageAttributes:       m.md5OfAttrs,
+		MD5OfMessageSystemAttributes: md5OfAttributes(in.sysAttrs),
+		SequenceNumber:               m.seq,
+	}, nil
+}
+
+// receive returns up to max visible messages and hides them for the
+// visibility timeout. Messages that have been received more often than the
+// redrive policy allows are moved to the dead-letter queue, as returned by
+// lookup, instead.
+func (q *queue) receive(max int, visibility time.Duration, now time.Time, lookup func(arn string) *queue) []*message {
+	q.expire(now)
+	dlqARN, maxReceiveCount := q.redrivePolicy()
+	var dlq *queue
+	if maxReceiveCount > 0 {
+		dlq = lookup(dlqARN)
+	}
+
+	var received []*message
+	blocked := map[string]bool{}
+	msgs := q.messages[:0]
+	for i, m := range q.messages {
+		if len(received) == max {
+			msgs = append(msgs, q.messages[i:]...)
+			break
+		}
+		if q.fifo && blocked[m.groupID] {
+			msgs = append(msgs, m)
+			continue
+		}
+		if now.Before(m.visibleAt) {
+			if q.fifo {
+				blocked[m.groupID] = true
+			}
+			msgs = append(msgs, m)
+			continue
+		}
+		if dlq != nil && m.receiveCount >= maxReceiveCount {
+			q.forget(m)
+			m.visibleAt = now
+			dlq.messages = append(dlq.messages, m)
+			continue
+		}
+
+		m.receiveCount++
+		if m.receiveCount == 1 {
+			m.firstReceive = now
+		}
+		m.visibleAt = now.Add(visibility)
+		m.receipt = newReceiptHandle()
+		q.receipts[m.receipt] = m
+		received = append(received, m)
+		msgs = append(msgs, m)
+	}
+	q.messages = msgs
+	return received
+}
+
+// remove deletes the message handle was issued for. Deleting a message that
+// no longer exists succeeds, as it does in SQS.
+func (q *queue) remove(handle string) *apiError {
+	m, ok := q.receipts[handle]
+	if !ok {
+		if !receiptHandlePattern.MatchString(handle) {
+			return newError(sqsextendedclient.ErrCodeReceiptHandleIsInvalid, "The input receipt handle \"%s\" is not a valid receipt handle.", handle)
+		}
+		return nil
+	}
+	q.forget(m)
+	for i, qm := range q.messages {
+		if qm == m {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// changeVisibility sets the visibility timeout of the in flight message
+// handle was issued for.
+func (q *queue) changeVisibility(handle string, timeout int, now time.Time) *apiError {
+	if timeout < 0 || timeout > maxVisibilityTimeout {
+		return newError(errCodeInvalidParameterValue,
+			"Value %d for parameter VisibilityTimeout is invalid. Reason: must be between 0 and %d.", timeout, maxVisibilityTimeout)
+	}
+	m, ok := q.receipts[handle]
+	if !ok {
+		if !receiptHandlePattern.MatchString(handle) {
+			return newError(sqsextendedclient.ErrCodeReceiptHandleIsInvalid, "The input receipt handle \"%s\" is not a valid receipt handle.", handle)
+		}
+		return newError(sqsextendedclient.ErrCodeMessageNotInflight, "Message does not exist or is not available for visibility timeout change.")
+	}
+	if m.receipt != handle || !m.inflight(now) {
+		return newError(sqsextendedclient.ErrCodeMessageNotInflight, "Message does not exist or is not available for visibility timeout change.")
+	}
+	m.visibleAt = now.Add(time.Duration(timeout) * time.Second)
+	return nil
+}
+
+// purge deletes all messages in the queue.
+func (q *queue) purge(now time.Time) *apiError {
+	if !q.purged.IsZero() && now.Sub(q.purged) < purgeInterval {
+		return newError(sqsextendedclient.ErrCodePurgeQueueInProgress,
+			"Only one PurgeQueue operation on %s is allowed every 60 seconds.", q.name)
+	}
+	q.purged = now
+	q.messages = nil
+	q.receipts = map[string]*message{}
+	return nil
+}
+
+// attributes returns the queue attributes, including the computed ones.
+func (q *queue) attributes(now time.Time) map[string]string {
+	q.expire(now)
+	var visible, inflight, delayed int
+	for _, m := range q.messages {
+		switch {
+		case m.inflight(now):
+			inflight++
+		case now.Before(m.visibleAt):
+			delayed++
+		default:
+			visible++
+		}
+	}
+
+	attrs := map[string]string{
+		"QueueArn":                              q.arn,
+		"ApproximateNumberOfMessages":           strconv.Itoa(visible),
+		"ApproximateNumberOfMessagesNotVisible": strconv.Itoa(inflight),
+		"ApproximateNumberOfMessagesDelayed":    strconv.Itoa(delayed),
+		"CreatedTimestamp":                      strconv.FormatInt(q.created.Unix(), 10),
+		"LastModifiedTimestamp":                 strconv.FormatInt(q.modified.Unix(), 10),
+	}
+	for k, v := range q.attrs {
+		attrs[k] = v
+	}
+	return attrs
+}
+
+// systemAttributes returns the message system attributes of m, as returned
+// by ReceiveMessage.
+func (q *queue) systemAttributes(m *message, accountID string) map[string]string {
+	attrs := map[string]string{
+		"SenderId":                         accountID,
+		"SentTimestamp":                    strconv.FormatInt(m.sent.UnixNano()/int64(time.Millisecond), 10),
+		"ApproximateReceiveCount":          strconv.Itoa(m.receiveCount),
+		"ApproximateFirstReceiveTimestamp": strconv.FormatInt(m.firstReceive.UnixNano()/int64(time.Millisecond), 10),
+	}
+	if q.fifo {
+		attrs["MessageGroupId"] = m.groupID
+		attrs["MessageDeduplicationId"] = m.dedupID
+		attrs["SequenceNumber"] = m.seq
+	}
+	if v, ok := m.sysAttrs["AWSTraceHeader"]; ok && v.StringValue != nil {
+		attrs["AWSTraceHeader"] = *v.StringValue
+	}
+	return attrs
+}
+
+// receiptHandlePattern matches the receipt handles the server hands out.
+var receiptHandlePattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// newReceiptHandle returns a new random receipt handle.
+func newReceiptHandle() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newID returns a new random message id, formatted as a UUID.
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	h := hex.EncodeToString(b)
+	return strings.Join([]string{h[0:8], h[8:12], h[12:16], h[16:20], h[20:]}, "-")
+}
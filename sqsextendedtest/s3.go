@@ -0,0 +1,512 @@
+package sqsextendedtest
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// Fault is a failure the S3Server injects into the requests it matches.
+type Fault struct {
+	// Method, Bucket and Key select the requests the fault applies to. Empty
+	// values match any request. Key "*" matches requests on any object, but
+	// not requests on the bucket itself.
+	Method string
+	Bucket string
+	Key    string
+
+	// Delay is waited before the request is handled, or the fault is
+	// returned. The wait ends early if the client gives up on the request.
+	Delay time.Duration
+
+	// StatusCode, if set, is returned instead of handling the request, with
+	// an error document with the given Code. Code defaults to InternalError.
+	StatusCode int
+	Code       string
+
+	// Times limits the number of requests the fault is injected into. Zero
+	// injects it into every matching request.
+	Times int
+}
+
+// matches reports whether the fault applies to a request.
+func (f *Fault) matches(method, bucket, key string) bool {
+	if len(f.Method) > 0 && f.Method != method {
+		return false
+	}
+	if len(f.Bucket) > 0 && f.Bucket != bucket {
+		return false
+	}
+	switch f.Key {
+	case "":
+		return true
+	case "*":
+		return len(key) > 0
+	default:
+		return f.Key == key
+	}
+}
+
+// object is an object held by the S3Server.
+type object struct {
+	data         []byte
+	etag         string
+	contentType  string
+	metadata     map[string]string
+	lastModified time.Time
+}
+
+// S3Server is a fake S3 endpoint that keeps buckets and objects in memory.
+// It supports PutObject, GetObject, HeadObject, DeleteObject, ListObjectsV2,
+// CreateBucket and DeleteBucket with path-style addressing, so clients must
+// be configured with aws.Config.S3ForcePathStyle:
+//
+//	srv := sqsextendedtest.NewS3Server()
+//	defer srv.Close()
+//	srv.CreateBucket("payloads")
+//
+//	s3c := s3.New(sess, aws.NewConfig().
+//		WithEndpoint(srv.URL).
+//		WithRegion("us-east-1").
+//		WithS3ForcePathStyle(true))
+//
+// Faults can be injected with InjectFault to test the error paths of
+// offloading, and objects can be inspected and modified behind the client's
+// back with Object, SetObject and RemoveObject.
+//
+// Requests are not authenticated, and range, conditional and multipart
+// requests are not supported.
+type S3Server struct {
+	*httptest.Server
+
+	// Clock returns the current time, which the LastModified time of objects
+	// is based on. Defaults to time.Now.
+	Clock func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]map[string]*object
+	faults  []*Fault
+	nextReq int64
+}
+
+// NewS3Server starts and returns a new fake S3 server with no buckets. The
+// caller should call Close when finished, to shut it down.
+func NewS3Server() *S3Server {
+	s := &S3Server{
+		Clock:   time.Now,
+		buckets: map[string]map[string]*object{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config returns the configuration of clients of the server: its endpoint,
+// path-style addressing, and static credentials, which the server does not
+// check.
+func (s *S3Server) Config() *aws.Config {
+	return aws.NewConfig().
+		WithEndpoint(s.URL).
+		WithRegion("us-east-1").
+		WithS3ForcePathStyle(true).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", ""))
+}
+
+// CreateBucket creates an empty bucket, if it does not exist yet.
+func (s *S3Server) CreateBucket(bucket string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = map[string]*object{}
+	}
+}
+
+// Keys returns the sorted keys of the objects in bucket.
+func (s *S3Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Object returns the content of an object, and whether it exists.
+func (s *S3Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), o.data...), true
+}
+
+// SetObject creates or replaces an object, creating the bucket if needed.
+func (s *S3Server) SetObject(bucket, key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = map[string]*object{}
+	}
+	s.buckets[bucket][key] = newObject(data, "", nil, s.Clock())
+}
+
+// RemoveObject deletes an object, as a lifecycle rule or another client
+// would.
+func (s *S3Server) RemoveObject(bucket, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets[bucket], key)
+}
+
+// InjectFault adds a fault to the requests it matches. Faults are checked in
+// the order they were added, and the first match applies.
+func (s *S3Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all injected faults.
+func (s *S3Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// newObject returns an object holding data.
+func newObject(data []byte, contentType string, metadata map[string]string, now time.Time) *object {
+	sum := md5.Sum(data)
+	if len(contentType) == 0 {
+		contentType = "binary/octet-stream"
+	}
+	return &object{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		contentType:  contentType,
+		metadata:     metadata,
+		lastModified: now.UTC().Truncate(time.Second),
+	}
+}
+
+// s3Error is an error the server returns in an Error document.
+type s3Error struct {
+	status  int
+	Code    string
+	Message string
+	Key     string `xml:",omitempty"`
+}
+
+// writeS3Error writes err as an Error document. Responses to HEAD requests
+// carry no document.
+func writeS3Error(w http.ResponseWriter, r *http.Request, err *s3Error, requestID string) {
+	w.Header().Set("x-amz-request-id", requestID)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(err.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(err.status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		*s3Error
+		RequestId string
+	}{s3Error: err, RequestId: requestID})
+}
+
+func (s *S3Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.nextReq++
+	requestID := fmt.Sprintf("%016X", s.nextReq)
+	s.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, key = path[:i], path[i+1:]
+	}
+	if len(bucket) == 0 {
+		writeS3Error(w, r, &s3Error{status: http.StatusNotImplemented, Code: "NotImplemented",
+			Message: "ListBuckets is not supported."}, requestID)
+		return
+	}
+
+	if fault := s.fault(r.Method, bucket, key); fault != nil {
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.StatusCode != 0 {
+			code := fault.Code
+			if len(code) == 0 {
+				code = "InternalError"
+			}
+			writeS3Error(w, r, &s3Error{status: fault.StatusCode, Code: code,
+				Message: "Injected fault.", Key: key}, requestID)
+			return
+		}
+	}
+
+	w.Header().Set("x-amz-request-id", requestID)
+	var err *s3Error
+	switch {
+	case len(key) == 0 && r.Method == http.MethodPut:
+		s.CreateBucket(bucket)
+	case len(key) == 0 && r.Method == http.MethodDelete:
+		err = s.deleteBucket(w, bucket)
+	case len(key) == 0 && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		err = s.listObjectsV2(w, r, bucket)
+	case len(key) > 0 && r.Method == http.MethodPut:
+		err = s.putObject(w, r, bucket, key)
+	case len(key) > 0 && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		err = s.getObject(w, r, bucket, key)
+	case len(key) > 0 && r.Method == http.MethodDelete:
+		err = s.deleteObject(w, bucket, key)
+	default:
+		err = &s3Error{status: http.StatusNotImplemented, Code: "NotImplemented",
+			Message: "A header or query you provided implies functionality that is not implemented."}
+	}
+	if err != nil {
+		writeS3Error(w, r, err, requestID)
+	}
+}
+
+// fault returns the fault to inject into a request, or nil.
+func (s *S3Server) fault(method, bucket, key string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.faults {
+		if !f.matches(method, bucket, key) {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// errNoSuchBucket returns the error for requests on a missing bucket.
+func errNoSuchBucket(bucket string) *s3Error {
+	return &s3Error{status: http.StatusNotFound, Code: "NoSuchBucket",
+		Message: fmt.Sprintf("The specified bucket %s does not exist.", bucket)}
+}
+
+func (s *S3Server) deleteBucket(w http.ResponseWriter, bucket string) *s3Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return errNoSuchBucket(bucket)
+	}
+	if len(objects) > 0 {
+		return &s3Error{status: http.StatusConflict, Code: "BucketNotEmpty",
+			Message: "The bucket you tried to delete is not empty."}
+	}
+	delete(s.buckets, bucket)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *S3Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) *s3Error {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return &s3Error{status: http.StatusBadRequest, Code: "IncompleteBody", Message: err.Error()}
+	}
+	if md5B64 := r.Header.Get("Content-MD5"); len(md5B64) > 0 {
+		sum := md5.Sum(data)
+		if md5B64 != base64.StdEncoding.EncodeToString(sum[:]) {
+			return &s3Error{status: http.StatusBadRequest, Code: "BadDigest",
+				Message: "The Content-MD5 you specified did not match what we received."}
+		}
+	}
+	metadata := map[string]string{}
+	for name, values := range r.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") && len(values) > 0 {
+			metadata[name] = values[0]
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return errNoSuchBucket(bucket)
+	}
+	o := newObject(data, r.Header.Get("Content-Type"), metadata, s.Clock())
+	objects[key] = o
+	w.Header().Set("ETag", o.etag)
+	return nil
+}
+
+func (s *S3Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) *s3Error {
+	s.mu.Lock()
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		s.mu.Unlock()
+		return errNoSuchBucket(bucket)
+	}
+	o, ok := objects[key]
+	s.mu.Unlock()
+	if !ok {
+		return &s3Error{status: http.StatusNotFound, Code: "NoSuchKey",
+			Message: "The specified key does not exist.", Key: key}
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", o.contentType)
+	h.Set("Content-Length", strconv.Itoa(len(o.data)))
+	h.Set("ETag", o.etag)
+	h.Set("Last-Modified", o.lastModified.Format(http.TimeFormat))
+	for name, value := range o.metadata {
+		h.Set(name, value)
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(o.data)
+	}
+	return nil
+}
+
+func (s *S3Server) deleteObject(w http.ResponseWriter, bucket, key string) *s3Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return errNoSuchBucket(bucket)
+	}
+	delete(objects, key)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// listBucketResult is the response document of ListObjectsV2.
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	Contents              []listBucketContents
+	CommonPrefixes        []listBucketPrefix
+}
+
+type listBucketContents struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+	StorageClass string
+}
+
+type listBucketPrefix struct {
+	Prefix string
+}
+
+func (s *S3Server) listObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) *s3Error {
+	q := r.URL.Query()
+	res := listBucketResult{
+		Name:              bucket,
+		Prefix:            q.Get("prefix"),
+		Delimiter:         q.Get("delimiter"),
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+		MaxKeys:           1000,
+	}
+	if v := q.Get("max-keys"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return &s3Error{status: http.StatusBadRequest, Code: "InvalidArgument", Message: "Invalid max-keys."}
+		}
+		if n < res.MaxKeys {
+			res.MaxKeys = n
+		}
+	}
+	after := res.StartAfter
+	if len(res.ContinuationToken) > 0 {
+		b, err := base64.StdEncoding.DecodeString(res.ContinuationToken)
+		if err != nil {
+			return &s3Error{status: http.StatusBadRequest, Code: "InvalidArgument",
+				Message: "The continuation token provided is incorrect."}
+		}
+		after = string(b)
+	}
+
+	s.mu.Lock()
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		s.mu.Unlock()
+		return errNoSuchBucket(bucket)
+	}
+	var keys []string
+	for k := range objects {
+		if strings.HasPrefix(k, res.Prefix) && k > after {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	prefixes := map[string]bool{}
+	for _, k := range keys {
+		if res.KeyCount == res.MaxKeys {
+			res.IsTruncated = true
+			break
+		}
+		if len(res.Delimiter) > 0 {
+			if i := strings.Index(k[len(res.Prefix):], res.Delimiter); i >= 0 {
+				p := k[:len(res.Prefix)+i+len(res.Delimiter)]
+				if !prefixes[p] {
+					prefixes[p] = true
+					res.CommonPrefixes = append(res.CommonPrefixes, listBucketPrefix{Prefix: p})
+					res.KeyCount++
+				}
+				after = k
+				continue
+			}
+		}
+		o := objects[k]
+		res.Contents = append(res.Contents, listBucketContents{
+			Key:          k,
+			LastModified: o.lastModified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         o.etag,
+			Size:         len(o.data),
+			StorageClass: "STANDARD",
+		})
+		res.KeyCount++
+		after = k
+	}
+	s.mu.Unlock()
+
+	if res.IsTruncated {
+		res.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(after))
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(res)
+	return nil
+}
@@ -0,0 +1,479 @@
+package sqsextendedtest_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/chojy/sqsextended/sqsextendedtest"
+)
+
+// newS3Fake starts a fake S3 server and returns a client of it that does not
+// retry requests.
+func newS3Fake(t *testing.T) (*sqsextendedtest.S3Server, *s3.S3) {
+	t.Helper()
+
+	srv := sqsextendedtest.NewS3Server()
+	t.Cleanup(srv.Close)
+	return srv, s3.New(unit.Session, srv.Config().WithMaxRetries(0))
+}
+
+// expectStatus fails the test unless err is a request failure with the
+// status code.
+func expectStatus(t *testing.T, status int, err error) {
+	t.Helper()
+
+	reqErr, ok := err.(awserr.RequestFailure)
+	if !ok {
+		t.Fatalf("expect awserr.RequestFailure, got %T: %v", err, err)
+	}
+	if e, a := status, reqErr.StatusCode(); e != a {
+		t.Errorf("expect status %v, got %v", e, a)
+	}
+}
+
+func TestS3ServerObjects(t *testing.T) {
+	srv, svc := newS3Fake(t)
+
+	if _, err := svc.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	data := []byte("hello")
+	sum := md5.Sum(data)
+	put, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String("bucket"),
+		Key:         aws.String("dir/key"),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("text/plain"),
+		ContentMD5:  aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		Metadata:    aws.StringMap(map[string]string{"Owner": "test"}),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	etag := `"5d41402abc4b2a76b9719d911017c592"`
+	if e, a := etag, aws.StringValue(put.ETag); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if stored, ok := srv.Object("bucket", "dir/key"); !ok || string(stored) != "hello" {
+		t.Errorf("expect object to be stored, got %q, %v", stored, ok)
+	}
+
+	get, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/key")})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	body, err := ioutil.ReadAll(get.Body)
+	get.Body.Close()
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := "hello", string(body); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := "text/plain", aws.StringValue(get.ContentType); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := etag, aws.StringValue(get.ETag); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := "test", aws.StringValue(get.Metadata["Owner"]); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	head, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/key")})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := int64(5), aws.Int64Value(head.ContentLength); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := etag, aws.StringValue(head.ETag); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if head.LastModified == nil {
+		t.Errorf("expect last modified time")
+	}
+
+	// Deleting an object twice succeeds, as it does in S3.
+	for i := 0; i < 2; i++ {
+		if _, err := svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/key")}); err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+	}
+	if _, ok := srv.Object("bucket", "dir/key"); ok {
+		t.Errorf("expect object to be deleted")
+	}
+
+	_, err = svc.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/key")})
+	expectCode(t, s3.ErrCodeNoSuchKey, err)
+	_, err = svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/key")})
+	expectStatus(t, http.StatusNotFound, err)
+}
+
+func TestS3ServerObjectErrors(t *testing.T) {
+	cases := map[string]struct {
+		Call func(*s3.S3) error
+		Code string
+	}{
+		"put missing bucket": {
+			Call: func(svc *s3.S3) error {
+				_, err := svc.PutObject(&s3.PutObjectInput{
+					Bucket: aws.String("missing"),
+					Key:    aws.String("key"),
+					Body:   strings.NewReader("hello"),
+				})
+				return err
+			},
+			Code: s3.ErrCodeNoSuchBucket,
+		},
+		"put bad digest": {
+			Call: func(svc *s3.S3) error {
+				sum := md5.Sum([]byte("other"))
+				_, err := svc.PutObject(&s3.PutObjectInput{
+					Bucket:     aws.String("bucket"),
+					Key:        aws.String("key"),
+					Body:       strings.NewReader("hello"),
+					ContentMD5: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+				})
+				return err
+			},
+			Code: "BadDigest",
+		},
+		"get missing bucket": {
+			Call: func(svc *s3.S3) error {
+				_, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String("missing"), Key: aws.String("key")})
+				return err
+			},
+			Code: s3.ErrCodeNoSuchBucket,
+		},
+		"delete missing bucket": {
+			Call: func(svc *s3.S3) error {
+				_, err := svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("missing"), Key: aws.String("key")})
+				return err
+			},
+			Code: s3.ErrCodeNoSuchBucket,
+		},
+		"list missing bucket": {
+			Call: func(svc *s3.S3) error {
+				_, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String("missing")})
+				return err
+			},
+			Code: s3.ErrCodeNoSuchBucket,
+		},
+		"delete bucket not empty": {
+			Call: func(svc *s3.S3) error {
+				_, err := svc.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("bucket")})
+				return err
+			},
+			Code: "BucketNotEmpty",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv, svc := newS3Fake(t)
+			srv.SetObject("bucket", "object", []byte("hello"))
+
+			expectCode(t, c.Code, c.Call(svc))
+		})
+	}
+}
+
+func TestS3ServerDeleteBucket(t *testing.T) {
+	srv, svc := newS3Fake(t)
+	srv.CreateBucket("bucket")
+
+	if _, err := svc.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("bucket")}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	_, err := svc.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("bucket")})
+	expectCode(t, s3.ErrCodeNoSuchBucket, err)
+}
+
+func TestS3ServerListObjectsV2(t *testing.T) {
+	srv, svc := newS3Fake(t)
+	for _, key := range []string{"a/1", "a/2", "b/1", "b/2/x", "c"} {
+		srv.SetObject("bucket", key, []byte(key))
+	}
+
+	cases := map[string]struct {
+		Input    *s3.ListObjectsV2Input
+		Keys     []string
+		Prefixes []string
+	}{
+		"all": {
+			Input: &s3.ListObjectsV2Input{},
+			Keys:  []string{"a/1", "a/2", "b/1", "b/2/x", "c"},
+		},
+		"prefix": {
+			Input: &s3.ListObjectsV2Input{Prefix: aws.String("b/")},
+			Keys:  []string{"b/1", "b/2/x"},
+		},
+		"delimiter": {
+			Input:    &s3.ListObjectsV2Input{Delimiter: aws.String("/")},
+			Keys:     []string{"c"},
+			Prefixes: []string{"a/", "b/"},
+		},
+		"prefix and delimiter": {
+			Input:    &s3.ListObjectsV2Input{Prefix: aws.String("b/"), Delimiter: aws.String("/")},
+			Keys:     []string{"b/1"},
+			Prefixes: []string{"b/2/"},
+		},
+		"start after": {
+			Input: &s3.ListObjectsV2Input{StartAfter: aws.String("b/1")},
+			Keys:  []string{"b/2/x", "c"},
+		},
+		"pages": {
+			Input: &s3.ListObjectsV2Input{MaxKeys: aws.Int64(2)},
+			Keys:  []string{"a/1", "a/2", "b/1", "b/2/x", "c"},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			c.Input.Bucket = aws.String("bucket")
+
+			var keys, prefixes []string
+			pages := 0
+			err := svc.ListObjectsV2Pages(c.Input, func(out *s3.ListObjectsV2Output, last bool) bool {
+				pages++
+				if max := aws.Int64Value(c.Input.MaxKeys); max > 0 && aws.Int64Value(out.KeyCount) > max {
+					t.Errorf("expect at most %v keys per page, got %v", max, aws.Int64Value(out.KeyCount))
+				}
+				for _, o := range out.Contents {
+					keys = append(keys, aws.StringValue(o.Key))
+					if e, a := int64(len(aws.StringValue(o.Key))), aws.Int64Value(o.Size); e != a {
+						t.Errorf("expect size %v, got %v", e, a)
+					}
+				}
+				for _, p := range out.CommonPrefixes {
+					prefixes = append(prefixes, aws.StringValue(p.Prefix))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := c.Keys, keys; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect keys %v, got %v", e, a)
+			}
+			if e, a := c.Prefixes, prefixes; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect prefixes %v, got %v", e, a)
+			}
+			if max := aws.Int64Value(c.Input.MaxKeys); max > 0 {
+				if e, a := (len(c.Keys)+int(max)-1)/int(max), pages; e != a {
+					t.Errorf("expect %v pages, got %v", e, a)
+				}
+			}
+		})
+	}
+}
+
+// s3Call is a request made to the S3Server in a fault test, and its
+// expected outcome.
+type s3Call struct {
+	Method string
+	Bucket string
+	Key    string
+
+	// Status is the expected status code of a failed request, or zero if the
+	// request should succeed. Code is the expected error code, if any.
+	Status int
+	Code   string
+}
+
+// do makes the request described by c: an object request for a non-empty
+// key, or ListObjectsV2 on the bucket.
+func (c s3Call) do(svc *s3.S3) error {
+	bucket, key := aws.String(c.Bucket), aws.String(c.Key)
+	if len(c.Key) == 0 {
+		_, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: bucket})
+		return err
+	}
+	var err error
+	switch c.Method {
+	case "PUT":
+		_, err = svc.PutObject(&s3.PutObjectInput{Bucket: bucket, Key: key, Body: strings.NewReader("hello")})
+	case "GET":
+		var out *s3.GetObjectOutput
+		if out, err = svc.GetObject(&s3.GetObjectInput{Bucket: bucket, Key: key}); err == nil {
+			out.Body.Close()
+		}
+	case "HEAD":
+		_, err = svc.HeadObject(&s3.HeadObjectInput{Bucket: bucket, Key: key})
+	case "DELETE":
+		_, err = svc.DeleteObject(&s3.DeleteObjectInput{Bucket: bucket, Key: key})
+	}
+	return err
+}
+
+func TestS3ServerFaults(t *testing.T) {
+	cases := map[string]struct {
+		Faults []sqsextendedtest.Fault
+		Calls  []s3Call
+	}{
+		"status code and code": {
+			Faults: []sqsextendedtest.Fault{{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"}},
+			Calls: []s3Call{
+				{Method: "PUT", Bucket: "bucket", Key: "a", Status: http.StatusServiceUnavailable, Code: "SlowDown"},
+				{Method: "GET", Bucket: "bucket", Key: "a", Status: http.StatusServiceUnavailable, Code: "SlowDown"},
+				{Method: "HEAD", Bucket: "bucket", Key: "a", Status: http.StatusServiceUnavailable},
+				{Method: "DELETE", Bucket: "bucket", Key: "a", Status: http.StatusServiceUnavailable, Code: "SlowDown"},
+				{Method: "GET", Bucket: "bucket", Status: http.StatusServiceUnavailable, Code: "SlowDown"},
+			},
+		},
+		"default code": {
+			Faults: []sqsextendedtest.Fault{{StatusCode: http.StatusInternalServerError}},
+			Calls: []s3Call{
+				{Method: "GET", Bucket: "bucket", Key: "a", Status: http.StatusInternalServerError, Code: "InternalError"},
+			},
+		},
+		"times": {
+			Faults: []sqsextendedtest.Fault{{StatusCode: http.StatusInternalServerError, Times: 2}},
+			Calls: []s3Call{
+				{Method: "GET", Bucket: "bucket", Key: "a", Status: http.StatusInternalServerError},
+				{Method: "PUT", Bucket: "bucket", Key: "a", Status: http.StatusInternalServerError},
+				{Method: "GET", Bucket: "bucket", Key: "a"},
+				{Method: "PUT", Bucket: "bucket", Key: "a"},
+			},
+		},
+		"method": {
+			Faults: []sqsextendedtest.Fault{{Method: "PUT", StatusCode: http.StatusForbidden, Code: "AccessDenied"}},
+			Calls: []s3Call{
+				{Method: "PUT", Bucket: "bucket", Key: "a", Status: http.StatusForbidden, Code: "AccessDenied"},
+				{Method: "GET", Bucket: "bucket", Key: "a"},
+				{Method: "DELETE", Bucket: "bucket", Key: "a"},
+			},
+		},
+		"bucket": {
+			Faults: []sqsextendedtest.Fault{{Bucket: "other", StatusCode: http.StatusInternalServerError}},
+			Calls: []s3Call{
+				{Method: "GET", Bucket: "other", Key: "a", Status: http.StatusInternalServerError},
+				{Method: "GET", Bucket: "other", Status: http.StatusInternalServerError},
+				{Method: "GET", Bucket: "bucket", Key: "a"},
+				{Method: "GET", Bucket: "bucket"},
+			},
+		},
+		"key": {
+			Faults: []sqsextendedtest.Fault{{Key: "a", StatusCode: http.StatusInternalServerError}},
+			Calls: []s3Call{
+				{Method: "GET", Bucket: "bucket", Key: "a", Status: http.StatusInternalServerError},
+				{Method: "GET", Bucket: "other", Key: "a", Status: http.StatusInternalServerError},
+				{Method: "GET", Bucket: "bucket", Key: "b"},
+				{Method: "GET", Bucket: "bucket"},
+			},
+		},
+		"any key": {
+			Faults: []sqsextendedtest.Fault{{Key: "*", StatusCode: http.StatusInternalServerError}},
+			Calls: []s3Call{
+				{Method: "GET", Bucket: "bucket", Key: "a", Status: http.StatusInternalServerError},
+				{Method: "PUT", Bucket: "bucket", Key: "b", Status: http.StatusInternalServerError},
+				{Method: "GET", Bucket: "bucket"},
+			},
+		},
+		"first match applies": {
+			Faults: []sqsextendedtest.Fault{
+				{Method: "GET", Key: "a", StatusCode: http.StatusForbidden, Code: "AccessDenied", Times: 1},
+				{Method: "GET", StatusCode: http.StatusInternalServerError},
+			},
+			Calls: []s3Call{
+				{Method: "GET", Bucket: "bucket", Key: "a", Status: http.StatusForbidden, Code: "AccessDenied"},
+				{Method: "GET", Bucket: "bucket", Key: "a", Status: http.StatusInternalServerError, Code: "InternalError"},
+				{Method: "PUT", Bucket: "bucket", Key: "a"},
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv, svc := newS3Fake(t)
+			srv.SetObject("bucket", "a", []byte("a"))
+			srv.SetObject("bucket", "b", []byte("b"))
+			srv.SetObject("other", "a", []byte("a"))
+			for _, f := range c.Faults {
+				srv.InjectFault(f)
+			}
+
+			for i, call := range c.Calls {
+				err := call.do(svc)
+				if call.Status == 0 {
+					if err != nil {
+						t.Errorf("expect call %v to succeed, got %v", i, err)
+					}
+					continue
+				}
+				if err == nil {
+					t.Errorf("expect call %v to fail, got nil", i)
+					continue
+				}
+				expectStatus(t, call.Status, err)
+				if len(call.Code) > 0 {
+					expectCode(t, call.Code, err)
+				}
+			}
+		})
+	}
+}
+
+func TestS3ServerClearFaults(t *testing.T) {
+	srv, svc := newS3Fake(t)
+	srv.SetObject("bucket", "a", []byte("a"))
+	srv.InjectFault(sqsextendedtest.Fault{StatusCode: http.StatusInternalServerError})
+
+	call := s3Call{Method: "GET", Bucket: "bucket", Key: "a"}
+	if err := call.do(svc); err == nil {
+		t.Fatalf("expect error, got nil")
+	}
+	srv.ClearFaults()
+	if err := call.do(svc); err != nil {
+		t.Errorf("expect no error, got %v", err)
+	}
+}
+
+func TestS3ServerFaultDelay(t *testing.T) {
+	srv, svc := newS3Fake(t)
+	srv.SetObject("bucket", "a", []byte("a"))
+	srv.InjectFault(sqsextendedtest.Fault{Key: "a", Delay: 200 * time.Millisecond})
+	srv.InjectFault(sqsextendedtest.Fault{Key: "b", Delay: 200 * time.Millisecond, StatusCode: http.StatusServiceUnavailable})
+
+	// A delay without a status code slows the request down, then handles it.
+	start := time.Now()
+	if err := (s3Call{Method: "GET", Bucket: "bucket", Key: "a"}).do(svc); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expect request to be delayed, took %v", elapsed)
+	}
+
+	start = time.Now()
+	err := (s3Call{Method: "GET", Bucket: "bucket", Key: "b"}).do(svc)
+	expectStatus(t, http.StatusServiceUnavailable, err)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expect fault to be delayed, took %v", elapsed)
+	}
+
+	// The delay ends early if the client gives up.
+	srv.InjectFault(sqsextendedtest.Fault{Key: "c", Delay: 5 * time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = svc.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("c")})
+	expectCode(t, request.CanceledErrorCode, err)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expect canceled request to return early, took %v", elapsed)
+	}
+}
@@ -0,0 +1,774 @@
+// Package sqsextendedtest provides in-process fakes of the services the
+// SQSExtended client talks to, for tests that should run without Docker or
+// network access.
+//
+// SQSServer speaks the SQS query protocol the client is built on. Point a
+// client at it with aws.Config.Endpoint:
+//
+//	srv := sqsextendedtest.NewSQSServer()
+//	defer srv.Close()
+//
+//	svc := sqsextendedclient.New(sess, srv.Config())
+//
+// S3Server stands in for the bucket large payloads are offloaded to, and can
+// inject faults to exercise the paths that leave payloads orphaned:
+//
+//	s3srv := sqsextendedtest.NewS3Server()
+//	defer s3srv.Close()
+//	s3srv.CreateBucket("payloads")
+//
+//	store := sqsextendedclient.NewS3PayloadStore(s3.New(sess, s3srv.Config()), "payloads")
+//
+// NewClient returns a client of both, with large payload support.
+package sqsextendedtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	sqsextendedclient "github.com/chojy/sqsextended"
+)
+
+// pollInterval is how often a long poll checks for messages whose delay or
+// visibility timeout has expired.
+const pollInterval = 50 * time.Millisecond
+
+// SQSServer is a fake SQS endpoint that keeps queues in memory. It supports
+// queue management, attributes and tags, sending, receiving, deleting and
+// changing the visibility of messages individually and in batches, purging,
+// long polling, delays and visibility timeouts, FIFO queues with message
+// groups and deduplication, and redrive to dead-letter queues.
+//
+// Permissions are recorded but not enforced, and requests are not
+// authenticated.
+type SQSServer struct {
+	*httptest.Server
+
+	// AccountID and Region the server reports in queue URLs and ARNs.
+	AccountID string
+	Region    string
+
+	// Clock returns the current time, which visibility timeouts, delays,
+	// retention and deduplication are based on. Defaults to time.Now; tests
+	// can replace it to control time, before sending requests.
+	Clock func() time.Time
+
+	mu      sync.Mutex
+	queues  map[string]*queue
+	changed chan struct{}
+	nextReq int64
+}
+
+// NewSQSServer starts and returns a new fake SQS server with no queues. The
+// caller should call Close when finished, to shut it down.
+func NewSQSServer() *SQSServer {
+	s := &SQSServer{
+		AccountID: "000000000000",
+		Region:    "us-east-1",
+		Clock:     time.Now,
+		queues:    map[string]*queue{},
+		changed:   make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config returns the configuration of clients of the server: its endpoint
+// and region, and static credentials, which the server does not check.
+func (s *SQSServer) Config() *aws.Config {
+	return aws.NewConfig().
+		WithEndpoint(s.URL).
+		WithRegion(s.Region).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", ""))
+}
+
+// QueueURL returns the URL of the queue with the given name.
+func (s *SQSServer) QueueURL(name string) string {
+	return s.URL + "/" + s.AccountID + "/" + name
+}
+
+// queueARN returns the ARN of the queue with the given name.
+func (s *SQSServer) queueARN(name string) string {
+	return "arn:aws:sqs:" + s.Region + ":" + s.AccountID + ":" + name
+}
+
+// notify wakes up long polls. It must be called with s.mu held.
+func (s *SQSServer) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// action is the handler of a query protocol action. It returns the result
+// element of the response, or nil for actions without one.
+type action func(s *SQSServer, r *http.Request, p params) (interface{}, *apiError)
+
+// actions maps the supported query protocol actions to their handlers.
+var actions = map[string]action{
+	"AddPermission":                (*SQSServer).addPermission,
+	"ChangeMessageVisibility":      (*SQSServer).changeMessageVisibility,
+	"ChangeMessageVisibilityBatch": (*SQSServer).changeMessageVisibilityBatch,
+	"CreateQueue":                  (*SQSServer).createQueue,
+	"DeleteMessage":                (*SQSServer).deleteMessage,
+	"DeleteMessageBatch":           (*SQSServer).deleteMessageBatch,
+	"DeleteQueue":                  (*SQSServer).deleteQueue,
+	"GetQueueAttributes":           (*SQSServer).getQueueAttributes,
+	"GetQueueUrl":                  (*SQSServer).getQueueURL,
+	"ListDeadLetterSourceQueues":   (*SQSServer).listDeadLetterSourceQueues,
+	"ListQueueTags":                (*SQSServer).listQueueTags,
+	"ListQueues":                   (*SQSServer).listQueues,
+	"PurgeQueue":                   (*SQSServer).purgeQueue,
+	"ReceiveMessage":               (*SQSServer).receiveMessage,
+	"RemovePermission":             (*SQSServer).removePermission,
+	"SendMessage":                  (*SQSServer).sendMessage,
+	"SendMessageBatch":             (*SQSServer).sendMessageBatch,
+	"SetQueueAttributes":           (*SQSServer).setQueueAttributes,
+	"TagQueue":                     (*SQSServer).tagQueue,
+	"UntagQueue":                   (*SQSServer).untagQueue,
+}
+
+func (s *SQSServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.nextReq++
+	requestID := fmt.Sprintf("00000000-0000-0000-0000-%012d", s.nextReq)
+	s.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, newError(errCodeInvalidParameterValue, "%v", err), requestID)
+		return
+	}
+	p := params(r.Form)
+	name := p.get("Action")
+	fn, ok := actions[name]
+	if !ok {
+		writeError(w, newError(errCodeInvalidAction, "The action %s is not valid for this endpoint.", name), requestID)
+		return
+	}
+
+	result, err := fn(s, r, p)
+	if err != nil {
+		writeError(w, err, requestID)
+		return
+	}
+	writeResult(w, name, result, requestID)
+}
+
+// queue returns the queue the QueueUrl parameter refers to. It must be
+// called with s.mu held.
+func (s *SQSServer) queue(p params) (*queue, *apiError) {
+	u, err := p.required("QueueUrl")
+	if err != nil {
+		return nil, err
+	}
+	q, ok := s.queues[u[strings.LastIndex(u, "/")+1:]]
+	if !ok {
+		return nil, newError(sqsextendedclient.ErrCodeQueueDoesNotExist, "The specified queue does not exist for this wsdl version.")
+	}
+	return q, nil
+}
+
+// queueByARN returns the queue with the given ARN, or nil. It must be called
+// with s.mu held.
+func (s *SQSServer) queueByARN(arn string) *queue {
+	for _, q := range s.queues {
+		if q.arn == arn {
+			return q
+		}
+	}
+	return nil
+}
+
+func (s *SQSServer) createQueue(r *http.Request, p params) (interface{}, *apiError) {
+	name, err := p.required("QueueName")
+	if err != nil {
+		return nil, err
+	}
+	attrs := p.stringMap("Attribute", "Name", "Value")
+	if err := validateQueueAttributes(attrs, true); err != nil {
+		return nil, err
+	}
+	fifo := attrs["FifoQueue"] == "true"
+	if !queueNamePattern.MatchString(strings.TrimSuffix(name, ".fifo")) || fifo != strings.HasSuffix(name, ".fifo") {
+		return nil, newError(errCodeInvalidParameterValue,
+			"Can only include alphanumeric characters, hyphens, or underscores. 1 to 80 in length. FIFO queue names must end in .fifo.")
+	}
+	if _, ok := attrs["ContentBasedDeduplication"]; ok && !fifo {
+		return nil, newError(sqsextendedclient.ErrCodeInvalidAttributeName, "Unknown Attribute ContentBasedDeduplication.")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.queues[name]; ok {
+		for k, v := range attrs {
+			if q.attrs[k] != v {
+				return nil, newError(sqsextendedclient.ErrCodeQueueNameExists,
+					"A queue already exists with the same name and a different value for attribute %s", k)
+			}
+		}
+		return queueURLResult{QueueUrl: q.url}, nil
+	}
+	s.queues[name] = newQueue(name, s.QueueURL(name), s.queueARN(name), attrs, p.stringMap("Tag", "Key", "Value"), s.Clock())
+	return queueURLResult{QueueUrl: s.QueueURL(name)}, nil
+}
+
+func (s *SQSServer) deleteQueue(r *http.Request, p params) (interface{}, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.queues, q.name)
+	s.notify()
+	return nil, nil
+}
+
+func (s *SQSServer) getQueueURL(r *http.Request, p params) (interface{}, *apiError) {
+	name, err := p.required("QueueName")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.queues[name]
+	if !ok {
+		return nil, newError(sqsextendedclient.ErrCodeQueueDoesNotExist, "The specified queue does not exist for this wsdl version.")
+	}
+	return queueURLResult{QueueUrl: q.url}, nil
+}
+
+func (s *SQSServer) listQueues(r *http.Request, p params) (interface{}, *apiError) {
+	prefix := p.get("QueueNamePrefix")
+
+	s.mu.Lock()
+	var urls []string
+	for name, q := range s.queues {
+		if strings.HasPrefix(name, prefix) {
+			urls = append(urls, q.url)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Strings(urls)
+	return paginate(urls, p)
+}
+
+func (s *SQSServer) listDeadLetterSourceQueues(r *http.Request, p params) (interface{}, *apiError) {
+	s.mu.Lock()
+	dlq, err := s.queue(p)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	var urls []string
+	for _, q := range s.queues {
+		if arn, _ := q.redrivePolicy(); arn == dlq.arn {
+			urls = append(urls, q.url)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Strings(urls)
+	return paginate(urls, p)
+}
+
+// paginate returns the page of urls selected by the MaxResults and
+// NextToken parameters. The token is the offset of the page.
+func paginate(urls []string, p params) (interface{}, *apiError) {
+	max, err := p.int("MaxResults", 1000, 1, 1000)
+	if err != nil {
+		return nil, err
+	}
+	offset := 0
+	if p.has("NextToken") {
+		n, convErr := strconv.Atoi(p.get("NextToken"))
+		if convErr != nil || n < 0 || n > len(urls) {
+			return nil, newError(errCodeInvalidParameterValue, "Invalid NextToken value.")
+		}
+		offset = n
+	}
+
+	res := queueURLsResult{QueueUrls: urls[offset:]}
+	if len(res.QueueUrls) > max {
+		res.QueueUrls = res.QueueUrls[:max]
+		if p.has("MaxResults") {
+			res.NextToken = strconv.Itoa(offset + max)
+		}
+	}
+	return res, nil
+}
+
+func (s *SQSServer) getQueueAttributes(r *http.Request, p params) (interface{}, *apiError) {
+	names := p.list("AttributeName")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := q.attributes(s.Clock())
+	var res getQueueAttributesResult
+	for _, name := range names {
+		if name == "All" {
+			for k, v := range attrs {
+				res.Attributes = append(res.Attributes, attributeResult{Name: k, Value: v})
+			}
+			break
+		}
+		v, ok := attrs[name]
+		if !ok {
+			if _, settable := settableQueueAttributes[name]; !settable {
+				return nil, newError(sqsextendedclient.ErrCodeInvalidAttributeName, "Unknown Attribute %s.", name)
+			}
+			continue
+		}
+		res.Attributes = append(res.Attributes, attributeResult{Name: name, Value: v})
+	}
+	sort.Slice(res.Attributes, func(i, j int) bool {
+		return res.Attributes[i].Name < res.Attributes[j].Name
+	})
+	return res, nil
+}
+
+func (s *SQSServer) setQueueAttributes(r *http.Request, p params) (interface{}, *apiError) {
+	attrs := p.stringMap("Attribute", "Name", "Value")
+	if err := validateQueueAttributes(attrs, false); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := attrs["ContentBasedDeduplication"]; ok && !q.fifo {
+		return nil, newError(sqsextendedclient.ErrCodeInvalidAttributeName, "Unknown Attribute ContentBasedDeduplication.")
+	}
+	for k, v := range attrs {
+		q.attrs[k] = v
+	}
+	q.modified = s.Clock()
+	s.notify()
+	return nil, nil
+}
+
+func (s *SQSServer) tagQueue(r *http.Request, p params) (interface{}, *apiError) {
+	tags := p.stringMap("Tag", "Key", "Value")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range tags {
+		q.tags[k] = v
+	}
+	return nil, nil
+}
+
+func (s *SQSServer) untagQueue(r *http.Request, p params) (interface{}, *apiError) {
+	keys := p.list("TagKey")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		delete(q.tags, k)
+	}
+	return nil, nil
+}
+
+func (s *SQSServer) listQueueTags(r *http.Request, p params) (interface{}, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var res listQueueTagsResult
+	for k, v := range q.tags {
+		res.Tags = append(res.Tags, tagResult{Key: k, Value: v})
+	}
+	sort.Slice(res.Tags, func(i, j int) bool {
+		return res.Tags[i].Key < res.Tags[j].Key
+	})
+	return res, nil
+}
+
+func (s *SQSServer) addPermission(r *http.Request, p params) (interface{}, *apiError) {
+	label, err := p.required("Label")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+	if q.permissions[label] {
+		return nil, newError(errCodeInvalidParameterValue, "Value %s for parameter Label is invalid. Reason: Already exists.", label)
+	}
+	q.permissions[label] = true
+	return nil, nil
+}
+
+func (s *SQSServer) removePermission(r *http.Request, p params) (interface{}, *apiError) {
+	label, err := p.required("Label")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+	if !q.permissions[label] {
+		return nil, newError(errCodeInvalidParameterValue, "Value %s for parameter Label is invalid. Reason: can't find label.", label)
+	}
+	delete(q.permissions, label)
+	return nil, nil
+}
+
+func (s *SQSServer) purgeQueue(r *http.Request, p params) (interface{}, *apiError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+	return nil, q.purge(s.Clock())
+}
+
+// sendInputFrom returns the message to send described by the parameters
+// under prefix: the request itself, or an entry of a batch.
+func sendInputFrom(p params, prefix string) (sendInput, *apiError) {
+	in := sendInput{
+		body:    p.get(prefix + "MessageBody"),
+		groupID: p.get(prefix + "MessageGroupId"),
+		dedupID: p.get(prefix + "MessageDeduplicationId"),
+	}
+	if p.has(prefix + "DelaySeconds") {
+		delay, err := p.int(prefix+"DelaySeconds", 0, 0, maxDelaySeconds)
+		if err != nil {
+			return sendInput{}, err
+		}
+		in.delay = &delay
+	}
+	var err *apiError
+	if in.attrs, err = p.attributeMap(prefix + "MessageAttribute"); err != nil {
+		return sendInput{}, err
+	}
+	if in.sysAttrs, err = p.attributeMap(prefix + "MessageSystemAttribute"); err != nil {
+		return sendInput{}, err
+	}
+	return in, nil
+}
+
+func (s *SQSServer) sendMessage(r *http.Request, p params) (interface{}, *apiError) {
+	in, err := sendInputFrom(p, "")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+	res, err := q.send(in, s.Clock())
+	if err != nil {
+		return nil, err
+	}
+	s.notify()
+	return res, nil
+}
+
+// batchEntries returns the prefixes of the entries of a batch request, after
+// checking their number and ids.
+func batchEntries(p params, name string) ([]string, *apiError) {
+	entries := p.entries(name)
+	if len(entries) == 0 {
+		return nil, newError(sqsextendedclient.ErrCodeEmptyBatchRequest, "There should be at least one %s in the request.", name)
+	}
+	if len(entries) > maxBatchEntries {
+		return nil, newError(sqsextendedclient.ErrCodeTooManyEntriesInBatchRequest,
+			"Maximum number of entries per request are %d. You have sent %d.", maxBatchEntries, len(entries))
+	}
+	ids := map[string]bool{}
+	for _, e := range entries {
+		id := p.get(e + "Id")
+		if !batchEntryIDPattern.MatchString(id) {
+			return nil, newError(sqsextendedclient.ErrCodeInvalidBatchEntryId,
+				"A batch entry id can only contain alphanumeric characters, hyphens and underscores. It can be at most 80 letters long.")
+		}
+		if ids[id] {
+			return nil, newError(sqsextendedclient.ErrCodeBatchEntryIdsNotDistinct, "Id %s repeated.", id)
+		}
+		ids[id] = true
+	}
+	return entries, nil
+}
+
+// failedEntry returns the result of a failed batch entry.
+func failedEntry(id string, err *apiError) batchResultErrorEntry {
+	return batchResultErrorEntry{Id: id, SenderFault: true, Code: err.Code, Message: err.Message}
+}
+
+func (s *SQSServer) sendMessageBatch(r *http.Request, p params) (interface{}, *apiError) {
+	entries, err := batchEntries(p, "SendMessageBatchRequestEntry")
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	for _, e := range entries {
+		total += len(p.get(e + "MessageBody"))
+		attrs, _ := p.attributeMap(e + "MessageAttribute")
+		for name, v := range attrs {
+			total += len(name) + v.size()
+		}
+	}
+	if total > maxMessageSize {
+		return nil, newError(sqsextendedclient.ErrCodeBatchRequestTooLong,
+			"Batch requests cannot be longer than %d bytes. You have sent %d bytes.", maxMessageSize, total)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var res sendMessageBatchResult
+	now := s.Clock()
+	for _, e := range entries {
+		id := p.get(e + "Id")
+		in, err := sendInputFrom(p, e)
+		if err == nil {
+			var sent sendMessageResult
+			if sent, err = q.send(in, now); err == nil {
+				res.Successful = append(res.Successful, sendMessageBatchResultEntry{Id: id, sendMessageResult: sent})
+				continue
+			}
+		}
+		res.Failed = append(res.Failed, failedEntry(id, err))
+	}
+	s.notify()
+	return res, nil
+}
+
+func (s *SQSServer) receiveMessage(r *http.Request, p params) (interface{}, *apiError) {
+	max, err := p.int("MaxNumberOfMessages", 1, 1, maxBatchEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	q, err := s.queue(p)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	visibility, err := p.int("VisibilityTimeout", q.intAttr("VisibilityTimeout"), 0, maxVisibilityTimeout)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	wait, err := p.int("WaitTimeSeconds", q.intAttr("ReceiveMessageWaitTimeSeconds"), 0, maxWaitTimeSeconds)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.mu.Unlock()
+
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	for {
+		s.mu.Lock()
+		q, err := s.queue(p)
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		msgs := q.receive(max, time.Duration(visibility)*time.Second, s.Clock(), s.queueByARN)
+		if len(msgs) > 0 {
+			res := s.receiveResult(q, msgs, p)
+			s.mu.Unlock()
+			return res, nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return receiveMessageResult{}, nil
+		}
+		if remaining > pollInterval {
+			remaining = pollInterval
+		}
+		select {
+		case <-changed:
+		case <-time.After(remaining):
+		case <-r.Context().Done():
+			return receiveMessageResult{}, nil
+		}
+	}
+}
+
+// receiveResult returns the response to a ReceiveMessage request that
+// received msgs, with the attributes the request asked for. It must be
+// called with s.mu held.
+func (s *SQSServer) receiveResult(q *queue, msgs []*message, p params) receiveMessageResult {
+	sysNames := append(p.list("AttributeName"), p.list("MessageSystemAttributeName")...)
+	attrNames := p.list("MessageAttributeName")
+
+	var res receiveMessageResult
+	for _, m := range msgs {
+		mr := messageResult{
+			MessageId:     m.id,
+			ReceiptHandle: m.receipt,
+			MD5OfBody:     m.md5OfBody,
+			Body:          m.body,
+		}
+		for name, v := range q.systemAttributes(m, s.AccountID) {
+			if matchesAttributeName(name, sysNames) {
+				mr.Attributes = append(mr.Attributes, attributeResult{Name: name, Value: v})
+			}
+		}
+		sort.Slice(mr.Attributes, func(i, j int) bool {
+			return mr.Attributes[i].Name < mr.Attributes[j].Name
+		})
+
+		attrs := map[string]attributeValue{}
+		for name, v := range m.attrs {
+			if matchesAttributeName(name, attrNames) {
+				attrs[name] = v
+				mr.MessageAttributes = append(mr.MessageAttributes, messageAttributeResult{Name: name, Value: v.result()})
+			}
+		}
+		sort.Slice(mr.MessageAttributes, func(i, j int) bool {
+			return mr.MessageAttributes[i].Name < mr.MessageAttributes[j].Name
+		})
+		mr.MD5OfMessageAttributes = md5OfAttributes(attrs)
+
+		res.Messages = append(res.Messages, mr)
+	}
+	return res
+}
+
+func (s *SQSServer) deleteMessage(r *http.Request, p params) (interface{}, *apiError) {
+	handle, err := p.required("ReceiptHandle")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+	return nil, q.remove(handle)
+}
+
+func (s *SQSServer) deleteMessageBatch(r *http.Request, p params) (interface{}, *apiError) {
+	entries, err := batchEntries(p, "DeleteMessageBatchRequestEntry")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var res deleteMessageBatchResult
+	for _, e := range entries {
+		id := p.get(e + "Id")
+		if err := q.remove(p.get(e + "ReceiptHandle")); err != nil {
+			res.Failed = append(res.Failed, failedEntry(id, err))
+			continue
+		}
+		res.Successful = append(res.Successful, batchResultEntry{Id: id})
+	}
+	return res, nil
+}
+
+func (s *SQSServer) changeMessageVisibility(r *http.Request, p params) (interface{}, *apiError) {
+	handle, err := p.required("ReceiptHandle")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.required("VisibilityTimeout"); err != nil {
+		return nil, err
+	}
+	timeout, err := p.int("VisibilityTimeout", 0, 0, maxVisibilityTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.changeVisibility(handle, timeout, s.Clock()); err != nil {
+		return nil, err
+	}
+	s.notify()
+	return nil, nil
+}
+
+func (s *SQSServer) changeMessageVisibilityBatch(r *http.Request, p params) (interface{}, *apiError) {
+	entries, err := batchEntries(p, "ChangeMessageVisibilityBatchRequestEntry")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.queue(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var res changeMessageVisibilityBatchResult
+	now := s.Clock()
+	for _, e := range entries {
+		id := p.get(e + "Id")
+		timeout, err := p.int(e+"VisibilityTimeout", -1, 0, maxVisibilityTimeout)
+		if err == nil {
+			err = q.changeVisibility(p.get(e+"ReceiptHandle"), timeout, now)
+		}
+		if err != nil {
+			res.Failed = append(res.Failed, failedEntry(id, err))
+			continue
+		}
+		res.Successful = append(res.Successful, batchResultEntry{Id: id})
+	}
+	s.notify()
+	return res, nil
+}
@@ -0,0 +1,975 @@
+package sqsextendedtest_test
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/chojy/sqsextended/sqsextendedtest"
+)
+
+// clock is a fake clock for SQSServer.Clock, safe for concurrent use.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// sqsFake is a fake SQS server on a fake clock, and a real SQS client of it.
+type sqsFake struct {
+	srv   *sqsextendedtest.SQSServer
+	svc   *sqs.SQS
+	clock *clock
+}
+
+// newSQSFake starts a fake SQS server and returns a client of it that does
+// not retry requests.
+func newSQSFake(t *testing.T) *sqsFake {
+	t.Helper()
+
+	f := &sqsFake{
+		srv:   sqsextendedtest.NewSQSServer(),
+		clock: &clock{now: time.Unix(1700000000, 0)},
+	}
+	t.Cleanup(f.srv.Close)
+	f.srv.Clock = f.clock.Now
+	f.svc = sqs.New(unit.Session, f.srv.Config().WithMaxRetries(0))
+	return f
+}
+
+// createQueue creates a queue with the given attributes and returns its URL.
+func (f *sqsFake) createQueue(t *testing.T, name string, attrs map[string]string) string {
+	t.Helper()
+
+	out, err := f.svc.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: aws.StringMap(attrs),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	return aws.StringValue(out.QueueUrl)
+}
+
+// send sends a message with the given body and returns its id.
+func (f *sqsFake) send(t *testing.T, url, body string) string {
+	t.Helper()
+
+	out, err := f.svc.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    aws.String(url),
+		MessageBody: aws.String(body),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	return aws.StringValue(out.MessageId)
+}
+
+// receive receives up to max messages from the queue.
+func (f *sqsFake) receive(t *testing.T, url string, max int64) []*sqs.Message {
+	t.Helper()
+
+	out, err := f.svc.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(url),
+		MaxNumberOfMessages:   aws.Int64(max),
+		AttributeNames:        []*string{aws.String("All")},
+		MessageAttributeNames: []*string{aws.String("All")},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	return out.Messages
+}
+
+// attribute returns a queue attribute.
+func (f *sqsFake) attribute(t *testing.T, url, name string) string {
+	t.Helper()
+
+	out, err := f.svc.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(url),
+		AttributeNames: []*string{aws.String(name)},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	return aws.StringValue(out.Attributes[name])
+}
+
+// bodies returns the bodies of msgs.
+func bodies(msgs []*sqs.Message) []string {
+	var bs []string
+	for _, m := range msgs {
+		bs = append(bs, aws.StringValue(m.Body))
+	}
+	return bs
+}
+
+// expectCode fails the test unless err is an awserr.Error with the code.
+func expectCode(t *testing.T, code string, err error) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expect %v error, got nil", code)
+	}
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		t.Fatalf("expect awserr.Error, got %T", err)
+	}
+	if e, a := code, aerr.Code(); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+}
+
+func TestSQSServerCreateQueue(t *testing.T) {
+	cases := map[string]struct {
+		Name  string
+		Attrs map[string]string
+		Code  string
+	}{
+		"standard": {
+			Name: "queue",
+		},
+		"fifo": {
+			Name:  "queue.fifo",
+			Attrs: map[string]string{"FifoQueue": "true"},
+		},
+		"attributes": {
+			Name:  "queue",
+			Attrs: map[string]string{"VisibilityTimeout": "60", "DelaySeconds": "5"},
+		},
+		"invalid name": {
+			Name: "queue!",
+			Code: "InvalidParameterValue",
+		},
+		"fifo without suffix": {
+			Name:  "queue",
+			Attrs: map[string]string{"FifoQueue": "true"},
+			Code:  "InvalidParameterValue",
+		},
+		"suffix without fifo": {
+			Name: "queue.fifo",
+			Code: "InvalidParameterValue",
+		},
+		"unknown attribute": {
+			Name:  "queue",
+			Attrs: map[string]string{"Color": "blue"},
+			Code:  sqs.ErrCodeInvalidAttributeName,
+		},
+		"attribute out of range": {
+			Name:  "queue",
+			Attrs: map[string]string{"VisibilityTimeout": "43201"},
+			Code:  "InvalidParameterValue",
+		},
+		"content based deduplication on standard queue": {
+			Name:  "queue",
+			Attrs: map[string]string{"ContentBasedDeduplication": "true"},
+			Code:  sqs.ErrCodeInvalidAttributeName,
+		},
+		"invalid redrive policy": {
+			Name:  "queue",
+			Attrs: map[string]string{"RedrivePolicy": `{"maxReceiveCount":"1"}`},
+			Code:  "InvalidParameterValue",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newSQSFake(t)
+
+			out, err := f.svc.CreateQueue(&sqs.CreateQueueInput{
+				QueueName:  aws.String(c.Name),
+				Attributes: aws.StringMap(c.Attrs),
+			})
+			if len(c.Code) != 0 {
+				expectCode(t, c.Code, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := f.srv.QueueURL(c.Name), aws.StringValue(out.QueueUrl); e != a {
+				t.Errorf("expect %v, got %v", e, a)
+			}
+			for k, v := range c.Attrs {
+				if e, a := v, f.attribute(t, f.srv.QueueURL(c.Name), k); e != a {
+					t.Errorf("expect %v %v, got %v", k, e, a)
+				}
+			}
+		})
+	}
+}
+
+func TestSQSServerQueues(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue-a", map[string]string{"VisibilityTimeout": "60"})
+	f.createQueue(t, "queue-b", nil)
+	f.createQueue(t, "other", nil)
+
+	// Creating an existing queue with the same attributes returns its URL.
+	if e, a := url, f.createQueue(t, "queue-a", map[string]string{"VisibilityTimeout": "60"}); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	_, err := f.svc.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String("queue-a"),
+		Attributes: aws.StringMap(map[string]string{"VisibilityTimeout": "30"}),
+	})
+	expectCode(t, sqs.ErrCodeQueueNameExists, err)
+
+	got, err := f.svc.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String("queue-a")})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := url, aws.StringValue(got.QueueUrl); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	list, err := f.svc.ListQueues(&sqs.ListQueuesInput{QueueNamePrefix: aws.String("queue-")})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := []string{f.srv.QueueURL("queue-a"), f.srv.QueueURL("queue-b")}, aws.StringValueSlice(list.QueueUrls); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	var pages [][]string
+	err = f.svc.ListQueuesPages(&sqs.ListQueuesInput{MaxResults: aws.Int64(2)}, func(out *sqs.ListQueuesOutput, last bool) bool {
+		pages = append(pages, aws.StringValueSlice(out.QueueUrls))
+		return true
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 2, len(pages); e != a {
+		t.Fatalf("expect %v pages, got %v", e, a)
+	}
+	if e, a := []string{f.srv.QueueURL("other"), f.srv.QueueURL("queue-a")}, pages[0]; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := []string{f.srv.QueueURL("queue-b")}, pages[1]; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	if _, err := f.svc.DeleteQueue(&sqs.DeleteQueueInput{QueueUrl: aws.String(url)}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	_, err = f.svc.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String("queue-a")})
+	expectCode(t, sqs.ErrCodeQueueDoesNotExist, err)
+	_, err = f.svc.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(url), MessageBody: aws.String("hello")})
+	expectCode(t, sqs.ErrCodeQueueDoesNotExist, err)
+}
+
+func TestSQSServerQueueAttributes(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue", nil)
+
+	out, err := f.svc.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(url),
+		AttributeNames: []*string{aws.String("All")},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	for k, v := range map[string]string{
+		"VisibilityTimeout":           "30",
+		"DelaySeconds":                "0",
+		"MaximumMessageSize":          "262144",
+		"QueueArn":                    "arn:aws:sqs:us-east-1:000000000000:queue",
+		"ApproximateNumberOfMessages": "0",
+	} {
+		if e, a := v, aws.StringValue(out.Attributes[k]); e != a {
+			t.Errorf("expect %v %v, got %v", k, e, a)
+		}
+	}
+
+	_, err = f.svc.SetQueueAttributes(&sqs.SetQueueAttributesInput{
+		QueueUrl:   aws.String(url),
+		Attributes: aws.StringMap(map[string]string{"VisibilityTimeout": "90"}),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := "90", f.attribute(t, url, "VisibilityTimeout"); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	cases := map[string]map[string]string{
+		"unknown attribute":                             {"Color": "blue"},
+		"fifo after create":                             {"FifoQueue": "true"},
+		"content based deduplication on standard queue": {"ContentBasedDeduplication": "true"},
+	}
+	for name, attrs := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := f.svc.SetQueueAttributes(&sqs.SetQueueAttributesInput{
+				QueueUrl:   aws.String(url),
+				Attributes: aws.StringMap(attrs),
+			})
+			expectCode(t, sqs.ErrCodeInvalidAttributeName, err)
+		})
+	}
+
+	_, err = f.svc.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(url),
+		AttributeNames: []*string{aws.String("Color")},
+	})
+	expectCode(t, sqs.ErrCodeInvalidAttributeName, err)
+}
+
+func TestSQSServerTags(t *testing.T) {
+	f := newSQSFake(t)
+	out, err := f.svc.CreateQueue(&sqs.CreateQueueInput{
+		QueueName: aws.String("queue"),
+		Tags:      aws.StringMap(map[string]string{"team": "a"}),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	url := out.QueueUrl
+
+	tags := func() map[string]string {
+		t.Helper()
+		out, err := f.svc.ListQueueTags(&sqs.ListQueueTagsInput{QueueUrl: url})
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+		return aws.StringValueMap(out.Tags)
+	}
+
+	if e, a := map[string]string{"team": "a"}, tags(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	_, err = f.svc.TagQueue(&sqs.TagQueueInput{
+		QueueUrl: url,
+		Tags:     aws.StringMap(map[string]string{"team": "b", "env": "test"}),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := map[string]string{"team": "b", "env": "test"}, tags(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	_, err = f.svc.UntagQueue(&sqs.UntagQueueInput{
+		QueueUrl: url,
+		TagKeys:  []*string{aws.String("team"), aws.String("missing")},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := map[string]string{"env": "test"}, tags(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+}
+
+func TestSQSServerPermissions(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue", nil)
+
+	add := &sqs.AddPermissionInput{
+		QueueUrl:      aws.String(url),
+		Label:         aws.String("send"),
+		AWSAccountIds: []*string{aws.String("111111111111")},
+		Actions:       []*string{aws.String("SendMessage")},
+	}
+	if _, err := f.svc.AddPermission(add); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	_, err := f.svc.AddPermission(add)
+	expectCode(t, "InvalidParameterValue", err)
+
+	remove := &sqs.RemovePermissionInput{QueueUrl: aws.String(url), Label: aws.String("send")}
+	if _, err := f.svc.RemovePermission(remove); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	_, err = f.svc.RemovePermission(remove)
+	expectCode(t, "InvalidParameterValue", err)
+}
+
+func TestSQSServerSendReceiveDelete(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue", nil)
+
+	// The client validates the MD5 digests of the body and attributes the
+	// server returns.
+	sent, err := f.svc.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    aws.String(url),
+		MessageBody: aws.String("hello"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"string": {DataType: aws.String("String"), StringValue: aws.String("value")},
+			"number": {DataType: aws.String("Number.int"), StringValue: aws.String("42")},
+			"binary": {DataType: aws.String("Binary"), BinaryValue: []byte{0, 1, 0xff}},
+		},
+		MessageSystemAttributes: map[string]*sqs.MessageSystemAttributeValue{
+			"AWSTraceHeader": {DataType: aws.String("String"), StringValue: aws.String("Root=1-5759e988-bd862e3fe1be46a994272793")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	msgs := f.receive(t, url, 10)
+	if e, a := 1, len(msgs); e != a {
+		t.Fatalf("expect %v messages, got %v", e, a)
+	}
+	msg := msgs[0]
+	if e, a := aws.StringValue(sent.MessageId), aws.StringValue(msg.MessageId); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := "hello", aws.StringValue(msg.Body); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 3, len(msg.MessageAttributes); e != a {
+		t.Errorf("expect %v attributes, got %v", e, a)
+	}
+	if e, a := []byte{0, 1, 0xff}, msg.MessageAttributes["binary"].BinaryValue; string(e) != string(a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	for k, v := range map[string]string{
+		"ApproximateReceiveCount": "1",
+		"SenderId":                "000000000000",
+		"SentTimestamp":           "1700000000000",
+		"AWSTraceHeader":          "Root=1-5759e988-bd862e3fe1be46a994272793",
+	} {
+		if e, a := v, aws.StringValue(msg.Attributes[k]); e != a {
+			t.Errorf("expect %v %v, got %v", k, e, a)
+		}
+	}
+
+	// The message is hidden for the visibility timeout of the queue.
+	if msgs := f.receive(t, url, 10); len(msgs) != 0 {
+		t.Errorf("expect no messages, got %v", bodies(msgs))
+	}
+	if e, a := "1", f.attribute(t, url, "ApproximateNumberOfMessagesNotVisible"); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	f.clock.Advance(30 * time.Second)
+	msgs = f.receive(t, url, 10)
+	if e, a := 1, len(msgs); e != a {
+		t.Fatalf("expect %v messages, got %v", e, a)
+	}
+	if e, a := "2", aws.StringValue(msgs[0].Attributes["ApproximateReceiveCount"]); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	// Each receive issues a new receipt handle; deleting with the stale one
+	// succeeds without deleting the message.
+	if _, err := f.svc.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(url), ReceiptHandle: msg.ReceiptHandle}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if _, err := f.svc.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(url), ReceiptHandle: msgs[0].ReceiptHandle}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	f.clock.Advance(30 * time.Second)
+	if msgs := f.receive(t, url, 10); len(msgs) != 0 {
+		t.Errorf("expect no messages, got %v", bodies(msgs))
+	}
+
+	_, err = f.svc.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(url), ReceiptHandle: aws.String("invalid")})
+	expectCode(t, sqs.ErrCodeReceiptHandleIsInvalid, err)
+}
+
+func TestSQSServerSendMessageErrors(t *testing.T) {
+	cases := map[string]struct {
+		Input *sqs.SendMessageInput
+		Code  string
+	}{
+		"invalid contents": {
+			Input: &sqs.SendMessageInput{MessageBody: aws.String("\x00")},
+			Code:  sqs.ErrCodeInvalidMessageContents,
+		},
+		"too large": {
+			Input: &sqs.SendMessageInput{MessageBody: aws.String(strings.Repeat("x", 262145))},
+			Code:  "InvalidParameterValue",
+		},
+		"group id on standard queue": {
+			Input: &sqs.SendMessageInput{MessageBody: aws.String("hello"), MessageGroupId: aws.String("group")},
+			Code:  "InvalidParameterValue",
+		},
+		"attribute without type": {
+			Input: &sqs.SendMessageInput{
+				MessageBody: aws.String("hello"),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"a": {DataType: aws.String(""), StringValue: aws.String("value")},
+				},
+			},
+			Code: "InvalidParameterValue",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newSQSFake(t)
+			c.Input.QueueUrl = aws.String(f.createQueue(t, "queue", nil))
+
+			_, err := f.svc.SendMessage(c.Input)
+			expectCode(t, c.Code, err)
+		})
+	}
+}
+
+func TestSQSServerBatches(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue", nil)
+
+	sent, err := f.svc.SendMessageBatch(&sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(url),
+		Entries: []*sqs.SendMessageBatchRequestEntry{
+			{Id: aws.String("a"), MessageBody: aws.String("a")},
+			{Id: aws.String("b"), MessageBody: aws.String("\x00")},
+			{Id: aws.String("c"), MessageBody: aws.String("c")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 2, len(sent.Successful); e != a {
+		t.Errorf("expect %v successful entries, got %v", e, a)
+	}
+	if e, a := 1, len(sent.Failed); e != a {
+		t.Fatalf("expect %v failed entries, got %v", e, a)
+	}
+	if e, a := "b", aws.StringValue(sent.Failed[0].Id); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := sqs.ErrCodeInvalidMessageContents, aws.StringValue(sent.Failed[0].Code); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if !aws.BoolValue(sent.Failed[0].SenderFault) {
+		t.Errorf("expect sender fault")
+	}
+
+	msgs := f.receive(t, url, 10)
+	if e, a := []string{"a", "c"}, bodies(msgs); !reflect.DeepEqual(e, a) {
+		t.Fatalf("expect %v, got %v", e, a)
+	}
+
+	changed, err := f.svc.ChangeMessageVisibilityBatch(&sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String(url),
+		Entries: []*sqs.ChangeMessageVisibilityBatchRequestEntry{
+			{Id: aws.String("a"), ReceiptHandle: msgs[0].ReceiptHandle, VisibilityTimeout: aws.Int64(0)},
+			{Id: aws.String("invalid"), ReceiptHandle: aws.String("invalid"), VisibilityTimeout: aws.Int64(0)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 1, len(changed.Successful); e != a {
+		t.Errorf("expect %v successful entries, got %v", e, a)
+	}
+	if e, a := 1, len(changed.Failed); e != a {
+		t.Fatalf("expect %v failed entries, got %v", e, a)
+	}
+	if e, a := sqs.ErrCodeReceiptHandleIsInvalid, aws.StringValue(changed.Failed[0].Code); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	again := f.receive(t, url, 10)
+	if e, a := []string{"a"}, bodies(again); !reflect.DeepEqual(e, a) {
+		t.Fatalf("expect %v, got %v", e, a)
+	}
+
+	deleted, err := f.svc.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(url),
+		Entries: []*sqs.DeleteMessageBatchRequestEntry{
+			{Id: aws.String("a"), ReceiptHandle: again[0].ReceiptHandle},
+			{Id: aws.String("c"), ReceiptHandle: msgs[1].ReceiptHandle},
+			{Id: aws.String("invalid"), ReceiptHandle: aws.String("invalid")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 2, len(deleted.Successful); e != a {
+		t.Errorf("expect %v successful entries, got %v", e, a)
+	}
+	if e, a := 1, len(deleted.Failed); e != a {
+		t.Fatalf("expect %v failed entries, got %v", e, a)
+	}
+	if e, a := "0", f.attribute(t, url, "ApproximateNumberOfMessagesNotVisible"); e != a {
+		t.Errorf("expect %v messages in flight, got %v", e, a)
+	}
+}
+
+func TestSQSServerBatchErrors(t *testing.T) {
+	entries := func(ids ...string) []*sqs.SendMessageBatchRequestEntry {
+		var es []*sqs.SendMessageBatchRequestEntry
+		for _, id := range ids {
+			es = append(es, &sqs.SendMessageBatchRequestEntry{Id: aws.String(id), MessageBody: aws.String("hello")})
+		}
+		return es
+	}
+
+	cases := map[string]struct {
+		Entries []*sqs.SendMessageBatchRequestEntry
+		Code    string
+	}{
+		"too many entries": {
+			Entries: entries("0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10"),
+			Code:    sqs.ErrCodeTooManyEntriesInBatchRequest,
+		},
+		"ids not distinct": {
+			Entries: entries("0", "0"),
+			Code:    sqs.ErrCodeBatchEntryIdsNotDistinct,
+		},
+		"invalid id": {
+			Entries: entries("a.b"),
+			Code:    sqs.ErrCodeInvalidBatchEntryId,
+		},
+		"too long": {
+			Entries: []*sqs.SendMessageBatchRequestEntry{
+				{Id: aws.String("0"), MessageBody: aws.String(strings.Repeat("x", 200000))},
+				{Id: aws.String("1"), MessageBody: aws.String(strings.Repeat("x", 200000))},
+			},
+			Code: sqs.ErrCodeBatchRequestTooLong,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newSQSFake(t)
+			url := f.createQueue(t, "queue", nil)
+
+			_, err := f.svc.SendMessageBatch(&sqs.SendMessageBatchInput{
+				QueueUrl: aws.String(url),
+				Entries:  c.Entries,
+			})
+			expectCode(t, c.Code, err)
+		})
+	}
+}
+
+func TestSQSServerChangeMessageVisibility(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue", nil)
+	f.send(t, url, "hello")
+
+	msgs := f.receive(t, url, 1)
+	if e, a := 1, len(msgs); e != a {
+		t.Fatalf("expect %v messages, got %v", e, a)
+	}
+	handle := msgs[0].ReceiptHandle
+
+	_, err := f.svc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(url),
+		ReceiptHandle:     handle,
+		VisibilityTimeout: aws.Int64(120),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	f.clock.Advance(60 * time.Second)
+	if msgs := f.receive(t, url, 1); len(msgs) != 0 {
+		t.Errorf("expect no messages, got %v", bodies(msgs))
+	}
+
+	_, err = f.svc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(url),
+		ReceiptHandle:     handle,
+		VisibilityTimeout: aws.Int64(43201),
+	})
+	expectCode(t, "InvalidParameterValue", err)
+
+	_, err = f.svc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(url),
+		ReceiptHandle:     handle,
+		VisibilityTimeout: aws.Int64(0),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	// Once visible again, the message is no longer in flight.
+	_, err = f.svc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(url),
+		ReceiptHandle:     handle,
+		VisibilityTimeout: aws.Int64(30),
+	})
+	expectCode(t, sqs.ErrCodeMessageNotInflight, err)
+
+	if e, a := 1, len(f.receive(t, url, 1)); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
+
+func TestSQSServerDelay(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue", map[string]string{"DelaySeconds": "10"})
+
+	f.send(t, url, "queue delay")
+	_, err := f.svc.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:     aws.String(url),
+		MessageBody:  aws.String("message delay"),
+		DelaySeconds: aws.Int64(20),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	_, err = f.svc.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:     aws.String(url),
+		MessageBody:  aws.String("no delay"),
+		DelaySeconds: aws.Int64(0),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+
+	if e, a := "2", f.attribute(t, url, "ApproximateNumberOfMessagesDelayed"); e != a {
+		t.Errorf("expect %v delayed messages, got %v", e, a)
+	}
+
+	steps := []struct {
+		Advance time.Duration
+		Bodies  []string
+	}{
+		{0, []string{"no delay"}},
+		{10 * time.Second, []string{"queue delay"}},
+		{10 * time.Second, []string{"message delay"}},
+	}
+	for _, step := range steps {
+		f.clock.Advance(step.Advance)
+		if e, a := step.Bodies, bodies(f.receive(t, url, 10)); !reflect.DeepEqual(e, a) {
+			t.Errorf("expect %v after %v, got %v", e, step.Advance, a)
+		}
+	}
+}
+
+func TestSQSServerLongPoll(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue", nil)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		f.svc.SendMessage(&sqs.SendMessageInput{
+			QueueUrl:    aws.String(url),
+			MessageBody: aws.String("hello"),
+		})
+	}()
+
+	start := time.Now()
+	out, err := f.svc.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:        aws.String(url),
+		WaitTimeSeconds: aws.Int64(5),
+	})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := []string{"hello"}, bodies(out.Messages); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("expect long poll to return on send, took %v", elapsed)
+	}
+}
+
+func TestSQSServerRetention(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue", map[string]string{"MessageRetentionPeriod": "60"})
+	f.send(t, url, "hello")
+
+	f.clock.Advance(60 * time.Second)
+	if msgs := f.receive(t, url, 10); len(msgs) != 0 {
+		t.Errorf("expect expired message to be dropped, got %v", bodies(msgs))
+	}
+}
+
+func TestSQSServerPurgeQueue(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue", nil)
+	f.send(t, url, "visible")
+	f.send(t, url, "in flight")
+	f.receive(t, url, 1)
+
+	if _, err := f.svc.PurgeQueue(&sqs.PurgeQueueInput{QueueUrl: aws.String(url)}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	for _, name := range []string{"ApproximateNumberOfMessages", "ApproximateNumberOfMessagesNotVisible"} {
+		if e, a := "0", f.attribute(t, url, name); e != a {
+			t.Errorf("expect %v %v, got %v", name, e, a)
+		}
+	}
+
+	_, err := f.svc.PurgeQueue(&sqs.PurgeQueueInput{QueueUrl: aws.String(url)})
+	expectCode(t, sqs.ErrCodePurgeQueueInProgress, err)
+
+	f.clock.Advance(60 * time.Second)
+	if _, err := f.svc.PurgeQueue(&sqs.PurgeQueueInput{QueueUrl: aws.String(url)}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+}
+
+func TestSQSServerRedrive(t *testing.T) {
+	f := newSQSFake(t)
+	dlq := f.createQueue(t, "dlq", nil)
+	url := f.createQueue(t, "queue", map[string]string{
+		"RedrivePolicy": `{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:dlq","maxReceiveCount":"2"}`,
+	})
+	f.send(t, url, "poison")
+
+	// The message can be received maxReceiveCount times, then moves to the
+	// dead-letter queue on the next receive.
+	for i := 0; i < 2; i++ {
+		if e, a := []string{"poison"}, bodies(f.receive(t, url, 1)); !reflect.DeepEqual(e, a) {
+			t.Fatalf("expect %v on receive %v, got %v", e, i+1, a)
+		}
+		f.clock.Advance(30 * time.Second)
+	}
+	if msgs := f.receive(t, url, 1); len(msgs) != 0 {
+		t.Errorf("expect no messages, got %v", bodies(msgs))
+	}
+
+	msgs := f.receive(t, dlq, 1)
+	if e, a := []string{"poison"}, bodies(msgs); !reflect.DeepEqual(e, a) {
+		t.Fatalf("expect %v, got %v", e, a)
+	}
+	if e, a := "3", aws.StringValue(msgs[0].Attributes["ApproximateReceiveCount"]); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	sources, err := f.svc.ListDeadLetterSourceQueues(&sqs.ListDeadLetterSourceQueuesInput{QueueUrl: aws.String(dlq)})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := []string{url}, aws.StringValueSlice(sources.QueueUrls); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+}
+
+func TestSQSServerFIFO(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue.fifo", map[string]string{"FifoQueue": "true"})
+
+	send := func(body, group, dedup string) *sqs.SendMessageOutput {
+		t.Helper()
+		out, err := f.svc.SendMessage(&sqs.SendMessageInput{
+			QueueUrl:               aws.String(url),
+			MessageBody:            aws.String(body),
+			MessageGroupId:         aws.String(group),
+			MessageDeduplicationId: aws.String(dedup),
+		})
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+		return out
+	}
+
+	a1 := send("a1", "a", "a1")
+	a2 := send("a2", "a", "a2")
+	send("b1", "b", "b1")
+	if aws.StringValue(a1.SequenceNumber) >= aws.StringValue(a2.SequenceNumber) {
+		t.Errorf("expect increasing sequence numbers, got %v and %v", aws.StringValue(a1.SequenceNumber), aws.StringValue(a2.SequenceNumber))
+	}
+
+	// A duplicate within the deduplication interval is accepted, but not
+	// enqueued again.
+	dup := send("a1 again", "a", "a1")
+	if e, a := aws.StringValue(a1.MessageId), aws.StringValue(dup.MessageId); e != a {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := "3", f.attribute(t, url, "ApproximateNumberOfMessages"); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+
+	// A message group is blocked while one of its messages is in flight.
+	first := f.receive(t, url, 1)
+	if e, a := []string{"a1"}, bodies(first); !reflect.DeepEqual(e, a) {
+		t.Fatalf("expect %v, got %v", e, a)
+	}
+	for k, v := range map[string]string{"MessageGroupId": "a", "MessageDeduplicationId": "a1", "SequenceNumber": aws.StringValue(a1.SequenceNumber)} {
+		if e, a := v, aws.StringValue(first[0].Attributes[k]); e != a {
+			t.Errorf("expect %v %v, got %v", k, e, a)
+		}
+	}
+	if e, a := []string{"b1"}, bodies(f.receive(t, url, 10)); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if _, err := f.svc.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(url), ReceiptHandle: first[0].ReceiptHandle}); err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := []string{"a2"}, bodies(f.receive(t, url, 10)); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	// After the deduplication interval the id can be used again.
+	f.clock.Advance(5 * time.Minute)
+	if again := send("a1 later", "a", "a1"); aws.StringValue(again.MessageId) == aws.StringValue(a1.MessageId) {
+		t.Errorf("expect a new message after the deduplication interval")
+	}
+}
+
+func TestSQSServerFIFOContentBasedDeduplication(t *testing.T) {
+	f := newSQSFake(t)
+	url := f.createQueue(t, "queue.fifo", map[string]string{"FifoQueue": "true", "ContentBasedDeduplication": "true"})
+
+	var ids []string
+	for _, body := range []string{"hello", "hello", "world"} {
+		out, err := f.svc.SendMessage(&sqs.SendMessageInput{
+			QueueUrl:       aws.String(url),
+			MessageBody:    aws.String(body),
+			MessageGroupId: aws.String("group"),
+		})
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+		ids = append(ids, aws.StringValue(out.MessageId))
+	}
+	if ids[0] != ids[1] {
+		t.Errorf("expect identical bodies to be deduplicated, got %v", ids)
+	}
+	if ids[0] == ids[2] {
+		t.Errorf("expect different bodies not to be deduplicated, got %v", ids)
+	}
+	if e, a := "2", f.attribute(t, url, "ApproximateNumberOfMessages"); e != a {
+		t.Errorf("expect %v messages, got %v", e, a)
+	}
+}
+
+func TestSQSServerFIFOErrors(t *testing.T) {
+	cases := map[string]*sqs.SendMessageInput{
+		"missing group": {
+			MessageBody:            aws.String("hello"),
+			MessageDeduplicationId: aws.String("dedup"),
+		},
+		"missing deduplication id": {
+			MessageBody:    aws.String("hello"),
+			MessageGroupId: aws.String("group"),
+		},
+		"delay": {
+			MessageBody:            aws.String("hello"),
+			MessageGroupId:         aws.String("group"),
+			MessageDeduplicationId: aws.String("dedup"),
+			DelaySeconds:           aws.Int64(5),
+		},
+	}
+
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newSQSFake(t)
+			input.QueueUrl = aws.String(f.createQueue(t, "queue.fifo", map[string]string{"FifoQueue": "true"}))
+
+			_, err := f.svc.SendMessage(input)
+			if err == nil {
+				t.Fatalf("expect error, got nil")
+			}
+			if code := err.(awserr.Error).Code(); code != "MissingParameter" && code != "InvalidParameterValue" {
+				t.Errorf("expect parameter error, got %v", code)
+			}
+		})
+	}
+}
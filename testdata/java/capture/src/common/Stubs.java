@@ -0,0 +1,69 @@
+import java.io.ByteArrayOutputStream;
+import java.io.IOException;
+import java.io.InputStream;
+import java.util.Map;
+
+/** Values the SQS stubs hand out, and the golden file encoding. */
+final class Stubs {
+    // An opaque handle in the shape SQS issues. The Go tests expect it inside
+    // the captured receipt handle.
+    static final String RECEIPT_HANDLE = "AQEBpzt3TP3+/YQY+MDDtjdqI1EvrirShZHFIMaA0OAO9WLHn4NB8ti1CoGSlqjgYoEAOPyEtf4cg6btRhvvVPRPK8VwHEXoiCY/aMYVnyjcCWJZ0GOTOZ/0M6epmp2jRfTur5RzEmeNFlp2l2jvzhT+CpIhw0XTNN5UoBsylgQR/CGKEIDz";
+
+    static final String MESSAGE_ID = "5fea7756-0ea4-451a-a703-a558b933e274";
+
+    private Stubs() {
+    }
+
+    static byte[] read(InputStream in) throws IOException {
+        ByteArrayOutputStream out = new ByteArrayOutputStream();
+        byte[] buf = new byte[4096];
+        for (int n; (n = in.read(buf)) > 0;) {
+            out.write(buf, 0, n);
+        }
+        return out.toByteArray();
+    }
+
+    /**
+     * Returns a message golden file: the body and attributes the client sent
+     * to SQS, and the payload it offloaded. Attributes map names to their data
+     * type and string value.
+     */
+    static String message(String body, Map<String, String[]> attrs, String payload) {
+        StringBuilder b = new StringBuilder();
+        b.append("{\n  \"Body\": ").append(quote(body)).append(",\n  \"MessageAttributes\": {");
+        String sep = "\n";
+        for (Map.Entry<String, String[]> e : attrs.entrySet()) {
+            b.append(sep).append("    ").append(quote(e.getKey())).append(": {\n")
+                .append("      \"DataType\": ").append(quote(e.getValue()[0])).append(",\n")
+                .append("      \"StringValue\": ").append(quote(e.getValue()[1])).append("\n")
+                .append("    }");
+            sep = ",\n";
+        }
+        b.append("\n  },\n  \"Payload\": ").append(quote(payload)).append("\n}\n");
+        return b.toString();
+    }
+
+    static String quote(String s) {
+        StringBuilder b = new StringBuilder("\"");
+        for (char c : s.toCharArray()) {
+            switch (c) {
+            case '"':
+                b.append("\\\"");
+                break;
+            case '\\':
+                b.append("\\\\");
+                break;
+            case '\n':
+                b.append("\\n");
+                break;
+            default:
+                if (c < 0x20) {
+                    b.append(String.format("\\u%04x", (int) c));
+                } else {
+                    b.append(c);
+                }
+            }
+        }
+        return b.append('"').toString();
+    }
+}
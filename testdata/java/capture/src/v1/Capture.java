@@ -0,0 +1,103 @@
+import java.io.ByteArrayInputStream;
+import java.io.IOException;
+import java.lang.reflect.Proxy;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.nio.file.Paths;
+import java.util.HashMap;
+import java.util.Map;
+import java.util.TreeMap;
+
+import com.amazon.sqs.javamessaging.AmazonSQSExtendedClient;
+import com.amazon.sqs.javamessaging.ExtendedClientConfiguration;
+import com.amazonaws.services.s3.AmazonS3;
+import com.amazonaws.services.s3.model.GetObjectRequest;
+import com.amazonaws.services.s3.model.PutObjectRequest;
+import com.amazonaws.services.s3.model.PutObjectResult;
+import com.amazonaws.services.s3.model.S3Object;
+import com.amazonaws.services.sqs.AmazonSQS;
+import com.amazonaws.services.sqs.model.Message;
+import com.amazonaws.services.sqs.model.ReceiveMessageRequest;
+import com.amazonaws.services.sqs.model.ReceiveMessageResult;
+import com.amazonaws.services.sqs.model.SendMessageRequest;
+import com.amazonaws.services.sqs.model.SendMessageResult;
+
+/**
+ * Sends a message through the 1.0.x extended client to in-memory SQS and S3
+ * stubs, receives it back, and writes what went over the wire:
+ * message_s3_pointer.json and sqs_large_payload_size_message.json.
+ */
+public class Capture {
+    static final String QUEUE_URL = "https://sqs.us-east-1.amazonaws.com/000000000000/queue";
+    static final String BUCKET = "payloads";
+    static final String PAYLOAD = "{\"report\":\"daily\",\"rows\":[1,2,3,4,5,6,7]}\n";
+
+    public static void main(String[] args) throws IOException {
+        Path out = Paths.get(args.length > 0 ? args[0] : ".");
+        Map<String, byte[]> objects = new HashMap<>();
+        SendMessageRequest[] sent = new SendMessageRequest[1];
+
+        AmazonS3 s3 = (AmazonS3) Proxy.newProxyInstance(AmazonS3.class.getClassLoader(), new Class<?>[] {AmazonS3.class},
+            (proxy, method, a) -> {
+                switch (method.getName()) {
+                case "putObject":
+                    PutObjectRequest put = (PutObjectRequest) a[0];
+                    objects.put(put.getKey(), Stubs.read(put.getInputStream()));
+                    return new PutObjectResult();
+                case "getObject":
+                    GetObjectRequest get = (GetObjectRequest) a[0];
+                    S3Object object = new S3Object();
+                    object.setBucketName(get.getBucketName());
+                    object.setKey(get.getKey());
+                    object.setObjectContent(new ByteArrayInputStream(objects.get(get.getKey())));
+                    return object;
+                case "deleteObject":
+                    return null;
+                default:
+                    throw new UnsupportedOperationException(method.getName());
+                }
+            });
+
+        AmazonSQS sqs = (AmazonSQS) Proxy.newProxyInstance(AmazonSQS.class.getClassLoader(), new Class<?>[] {AmazonSQS.class},
+            (proxy, method, a) -> {
+                switch (method.getName()) {
+                case "sendMessage":
+                    sent[0] = (SendMessageRequest) a[0];
+                    return new SendMessageResult().withMessageId(Stubs.MESSAGE_ID);
+                case "receiveMessage":
+                    return new ReceiveMessageResult().withMessages(new Message()
+                        .withMessageId(Stubs.MESSAGE_ID)
+                        .withReceiptHandle(Stubs.RECEIPT_HANDLE)
+                        .withBody(sent[0].getMessageBody())
+                        .withMessageAttributes(sent[0].getMessageAttributes()));
+                default:
+                    throw new UnsupportedOperationException(method.getName());
+                }
+            });
+
+        ExtendedClientConfiguration config = new ExtendedClientConfiguration()
+            .withLargePayloadSupportEnabled(s3, BUCKET)
+            .withAlwaysThroughS3(true);
+        AmazonSQSExtendedClient client = new AmazonSQSExtendedClient(sqs, config);
+
+        client.sendMessage(new SendMessageRequest(QUEUE_URL, PAYLOAD));
+
+        Message received = client.receiveMessage(new ReceiveMessageRequest(QUEUE_URL)
+            .withMessageAttributeNames("All")).getMessages().get(0);
+        if (!PAYLOAD.equals(received.getBody())) {
+            throw new IllegalStateException("payload did not round trip: " + received.getBody());
+        }
+
+        Map<String, String[]> sentAttrs = new TreeMap<>();
+        sent[0].getMessageAttributes().forEach((name, v) -> sentAttrs.put(name, new String[] {v.getDataType(), v.getStringValue()}));
+
+        write(out.resolve("message_s3_pointer.json"), sent[0].getMessageBody() + "\n");
+        write(out.resolve("sqs_large_payload_size_message.json"), Stubs.message(sent[0].getMessageBody(), sentAttrs, PAYLOAD));
+    }
+
+    static void write(Path path, String content) throws IOException {
+        Files.write(path, content.getBytes(StandardCharsets.UTF_8));
+        System.out.println("wrote " + path);
+    }
+}
@@ -0,0 +1,132 @@
+import java.io.ByteArrayInputStream;
+import java.io.IOException;
+import java.lang.reflect.Proxy;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.nio.file.Paths;
+import java.util.HashMap;
+import java.util.Map;
+import java.util.TreeMap;
+
+import com.amazon.sqs.javamessaging.AmazonSQSExtendedClient;
+import com.amazon.sqs.javamessaging.ExtendedClientConfiguration;
+
+import software.amazon.awssdk.core.ResponseBytes;
+import software.amazon.awssdk.core.sync.RequestBody;
+import software.amazon.awssdk.core.sync.ResponseTransformer;
+import software.amazon.awssdk.http.AbortableInputStream;
+import software.amazon.awssdk.services.s3.S3Client;
+import software.amazon.awssdk.services.s3.model.DeleteObjectResponse;
+import software.amazon.awssdk.services.s3.model.GetObjectRequest;
+import software.amazon.awssdk.services.s3.model.GetObjectResponse;
+import software.amazon.awssdk.services.s3.model.PutObjectRequest;
+import software.amazon.awssdk.services.s3.model.PutObjectResponse;
+import software.amazon.awssdk.services.sqs.SqsClient;
+import software.amazon.awssdk.services.sqs.model.Message;
+import software.amazon.awssdk.services.sqs.model.MessageAttributeValue;
+import software.amazon.awssdk.services.sqs.model.ReceiveMessageRequest;
+import software.amazon.awssdk.services.sqs.model.ReceiveMessageResponse;
+import software.amazon.awssdk.services.sqs.model.SendMessageRequest;
+import software.amazon.awssdk.services.sqs.model.SendMessageResponse;
+
+/**
+ * Sends a message through the 2.x extended client to in-memory SQS and S3
+ * stubs, receives it back, and writes what went over the wire:
+ * payload_s3_pointer.json, extended_payload_size_message.json and
+ * receipt_handle.txt.
+ */
+public class Capture {
+    static final String QUEUE_URL = "https://sqs.us-east-1.amazonaws.com/000000000000/queue";
+    static final String BUCKET = "payloads";
+    static final String PAYLOAD = "{\"report\":\"daily\",\"rows\":[1,2,3,4,5,6,7]}\n";
+
+    public static void main(String[] args) throws IOException {
+        Path out = Paths.get(args.length > 0 ? args[0] : ".");
+        Map<String, byte[]> objects = new HashMap<>();
+        SendMessageRequest[] sent = new SendMessageRequest[1];
+
+        S3Client s3 = (S3Client) Proxy.newProxyInstance(S3Client.class.getClassLoader(), new Class<?>[] {S3Client.class},
+            (proxy, method, a) -> {
+                switch (method.getName()) {
+                case "putObject":
+                    PutObjectRequest put = (PutObjectRequest) a[0];
+                    objects.put(put.key(), Stubs.read(((RequestBody) a[1]).contentStreamProvider().newStream()));
+                    return PutObjectResponse.builder().build();
+                case "getObject":
+                    byte[] data = objects.get(((GetObjectRequest) a[0]).key());
+                    return ((ResponseTransformer<GetObjectResponse, ?>) a[1]).transform(
+                        GetObjectResponse.builder().contentLength((long) data.length).build(),
+                        AbortableInputStream.create(new ByteArrayInputStream(data)));
+                case "getObjectAsBytes":
+                    byte[] bytes = objects.get(((GetObjectRequest) a[0]).key());
+                    return ResponseBytes.fromByteArray(GetObjectResponse.builder().build(), bytes);
+                case "deleteObject":
+                    return DeleteObjectResponse.builder().build();
+                case "serviceName":
+                    return "s3";
+                case "close":
+                    return null;
+                default:
+                    throw new UnsupportedOperationException(method.getName());
+                }
+            });
+
+        SqsClient sqs = (SqsClient) Proxy.newProxyInstance(SqsClient.class.getClassLoader(), new Class<?>[] {SqsClient.class},
+            (proxy, method, a) -> {
+                switch (method.getName()) {
+                case "sendMessage":
+                    sent[0] = (SendMessageRequest) a[0];
+                    return SendMessageResponse.builder().messageId(Stubs.MESSAGE_ID).build();
+                case "receiveMessage":
+                    return ReceiveMessageResponse.builder().messages(Message.builder()
+                        .messageId(Stubs.MESSAGE_ID)
+                        .receiptHandle(Stubs.RECEIPT_HANDLE)
+                        .body(sent[0].messageBody())
+                        .messageAttributes(sent[0].messageAttributes())
+                        .build()).build();
+                case "serviceName":
+                    return "sqs";
+                case "close":
+                    return null;
+                default:
+                    throw new UnsupportedOperationException(method.getName());
+                }
+            });
+
+        ExtendedClientConfiguration config = new ExtendedClientConfiguration()
+            .withPayloadSupportEnabled(s3, BUCKET)
+            .withAlwaysThroughS3(true)
+            .withLegacyReservedAttributeNameDisabled()
+            .withS3KeyPrefix("reports/");
+        AmazonSQSExtendedClient client = new AmazonSQSExtendedClient(sqs, config);
+
+        Map<String, MessageAttributeValue> attrs = new HashMap<>();
+        attrs.put("ReportType", MessageAttributeValue.builder().dataType("String").stringValue("daily").build());
+        client.sendMessage(SendMessageRequest.builder()
+            .queueUrl(QUEUE_URL)
+            .messageBody(PAYLOAD)
+            .messageAttributes(attrs)
+            .build());
+
+        Message received = client.receiveMessage(ReceiveMessageRequest.builder()
+            .queueUrl(QUEUE_URL)
+            .messageAttributeNames("All")
+            .build()).messages().get(0);
+        if (!PAYLOAD.equals(received.body())) {
+            throw new IllegalStateException("payload did not round trip: " + received.body());
+        }
+
+        Map<String, String[]> sentAttrs = new TreeMap<>();
+        sent[0].messageAttributes().forEach((name, v) -> sentAttrs.put(name, new String[] {v.dataType(), v.stringValue()}));
+
+        write(out.resolve("payload_s3_pointer.json"), sent[0].messageBody() + "\n");
+        write(out.resolve("extended_payload_size_message.json"), Stubs.message(sent[0].messageBody(), sentAttrs, PAYLOAD));
+        write(out.resolve("receipt_handle.txt"), received.receiptHandle() + "\n");
+    }
+
+    static void write(Path path, String content) throws IOException {
+        Files.write(path, content.getBytes(StandardCharsets.UTF_8));
+        System.out.println("wrote " + path);
+    }
+}
@@ -0,0 +1,190 @@
+package sqsextendedclient
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// maxMessageAttributes is the number of message attributes SQS accepts per
+// message.
+const maxMessageAttributes = 10
+
+// Error codes of the invalid parameter errors defined by the extended client,
+// in addition to the ones in the request package.
+const (
+	// ParamMaxValueErrCode is the error code for values above the maximum.
+	ParamMaxValueErrCode = "ParamMaxValueError"
+
+	// ParamReservedNameErrCode is the error code for names reserved by the
+	// extended client.
+	ParamReservedNameErrCode = "ParamReservedNameError"
+)
+
+// errInvalidParam is the base of the invalid parameter errors defined by the
+// extended client. It implements request.ErrInvalidParam, so that the errors
+// can be collected in a request.ErrInvalidParams.
+type errInvalidParam struct {
+	context       string
+	nestedContext string
+	field         string
+	code          string
+	msg           string
+}
+
+// Code returns the error code for the type of invalid parameter.
+func (e *errInvalidParam) Code() string {
+	return e.code
+}
+
+// Message returns the reason the parameter was invalid, and its context.
+func (e *errInvalidParam) Message() string {
+	return fmt.Sprintf("%s, %s.", e.msg, e.Field())
+}
+
+// Error returns the string version of the invalid parameter error.
+func (e *errInvalidParam) Error() string {
+	return fmt.Sprintf("%s: %s", e.code, e.Message())
+}
+
+// OrigErr returns nil, Implemented for awserr.Error interface.
+func (e *errInvalidParam) OrigErr() error {
+	return nil
+}
+
+// Field Returns the field and context the error occurred.
+func (e *errInvalidParam) Field() string {
+	field := e.context
+	if len(field) > 0 {
+		field += "."
+	}
+	if len(e.nestedContext) > 0 {
+		field += fmt.Sprintf("%s.", e.nestedContext)
+	}
+	field += e.field
+
+	return field
+}
+
+// SetContext updates the base context of the error.
+func (e *errInvalidParam) SetContext(ctx string) {
+	e.context = ctx
+}
+
+// AddNestedContext prepends a context to the field's path.
+func (e *errInvalidParam) AddNestedContext(ctx string) {
+	if len(e.nestedContext) == 0 {
+		e.nestedContext = ctx
+	} else {
+		e.nestedContext = fmt.Sprintf("%s.%s", ctx, e.nestedContext)
+	}
+}
+
+// An ErrParamMaxValue represents a maximum value parameter error.
+type ErrParamMaxValue struct {
+	errInvalidParam
+	max float64
+}
+
+// NewErrParamMaxValue creates a new maximum value parameter error.
+func NewErrParamMaxValue(field string, max float64) *ErrParamMaxValue {
+	return &ErrParamMaxValue{
+		errInvalidParam: errInvalidParam{
+			code:  ParamMaxValueErrCode,
+			field: field,
+			msg:   fmt.Sprintf("maximum field value of %v", max),
+		},
+		max: max,
+	}
+}
+
+// MaxValue returns the field's allowed maximum value.
+//
+// float64 is returned for both int and float max values.
+func (e *ErrParamMaxValue) MaxValue() float64 {
+	return e.max
+}
+
+var _ request.ErrInvalidParam = (*ErrParamMaxValue)(nil)
+
+// An ErrParamReservedName represents a parameter error for a name reserved by
+// the extended client, such as ReservedAttributeName.
+type ErrParamReservedName struct {
+	errInvalidParam
+	name string
+}
+
+// NewErrParamReservedName creates a new reserved name parameter error.
+func NewErrParamReservedName(field string, name string) *ErrParamReservedName {
+	return &ErrParamReservedName{
+		errInvalidParam: errInvalidParam{
+			code:  ParamReservedNameErrCode,
+			field: field,
+			msg:   fmt.Sprintf("name %q is reserved", name),
+		},
+		name: name,
+	}
+}
+
+// Name returns the reserved name that was used.
+func (e *ErrParamReservedName) Name() string {
+	return e.name
+}
+
+// validateMessageAttributes adds errors to invalidParams for attrs that use a
+// reserved attribute name, or number more than max.
+func validateMessageAttributes(invalidParams *request.ErrInvalidParams, attrs map[string]*MessageAttributeValue, max int) {
+	for _, name := range []string{ReservedAttributeName, LegacyReservedAttributeName, CompressionAttributeName, EncryptionAttributeName} {
+		if _, ok := attrs[name]; ok {
+			invalidParams.Add(NewErrParamReservedName(fmt.Sprintf("%s[%v]", "MessageAttributes", name), name))
+		}
+	}
+	if len(attrs) > max {
+		invalidParams.Add(request.NewErrParamMaxLen("MessageAttributes", max, strconv.Itoa(len(attrs))))
+	}
+}
+
+// validateSendMessageHandler is a Validate handler that limits the number of
+// message attributes of a SendMessage request to leave room for the reserved
+// attributes the client adds: MaxAllowedAttributes while large payload
+// support is enabled, and one less again for each of compression and
+// encryption.
+func (c *SQSExtended) validateSendMessageHandler(r *request.Request) {
+	max := c.config.maxAllowedAttributes()
+	if r.Error != nil || max == maxMessageAttributes {
+		return
+	}
+
+	in := r.Params.(*SendMessageInput)
+	invalidParams := request.ErrInvalidParams{Context: "SendMessageInput"}
+	validateMessageAttributes(&invalidParams, in.MessageAttributes, max)
+	if invalidParams.Len() > 0 {
+		r.Error = invalidParams
+	}
+}
+
+// validateSendMessageBatchHandler is the SendMessageBatch equivalent of
+// validateSendMessageHandler.
+func (c *SQSExtended) validateSendMessageBatchHandler(r *request.Request) {
+	max := c.config.maxAllowedAttributes()
+	if r.Error != nil || max == maxMessageAttributes {
+		return
+	}
+
+	in := r.Params.(*SendMessageBatchInput)
+	invalidParams := request.ErrInvalidParams{Context: "SendMessageBatchInput"}
+	for i, e := range in.Entries {
+		if e == nil {
+			continue
+		}
+		entryParams := request.ErrInvalidParams{Context: "SendMessageBatchRequestEntry"}
+		validateMessageAttributes(&entryParams, e.MessageAttributes, max)
+		if entryParams.Len() > 0 {
+			invalidParams.AddNested(fmt.Sprintf("%s[%v]", "Entries", i), entryParams)
+		}
+	}
+	if invalidParams.Len() > 0 {
+		r.Error = invalidParams
+	}
+}